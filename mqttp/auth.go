@@ -98,3 +98,8 @@ func (msg *Auth) encodeMessage(to []byte) (int, error) {
 func (msg *Auth) size() int {
 	return 1 + msg.properties.FullLen()
 }
+
+func (msg *Auth) reset() {
+	msg.resetHeader()
+	msg.authReason = CodeSuccess
+}
@@ -0,0 +1,98 @@
+// Package capture implements compact on-disk format of raw MQTT frames
+// exchanged over one or many connections along with reader which replays
+// them through mqttp decoder.
+//
+// File starts with 4 bytes magic "VMQC" followed by format version byte.
+// Each record is
+//
+//	kind       byte
+//	connection uvarint
+//	time       varint, nanoseconds elapsed since time of previous record
+//	           (unix epoch for the first one)
+//
+// followed by kind specific data
+//
+//	recordVersion: protocol version byte
+//	recordFrame:   direction byte, uvarint length, frame bytes
+//	recordClose:   none
+package capture
+
+import (
+	"errors"
+	"time"
+
+	"github.com/VolantMQ/vlapi/mqttp"
+)
+
+const (
+	formatVersion byte = 0x01
+
+	recordVersion byte = 0x01
+	recordFrame   byte = 0x02
+	recordClose   byte = 0x03
+
+	// maxFrameSize frame is whole MQTT packet thus can't exceed 256MB + fixed header
+	maxFrameSize = 256*1024*1024 + 5
+
+	// frameChunk frames up to this size are allocated at once, bigger ones grow
+	// as data is read, thus corrupted length does not cause huge allocation
+	frameChunk = 64 * 1024
+)
+
+var magic = [4]byte{'V', 'M', 'Q', 'C'}
+
+// nolint: golint
+var (
+	ErrInvalidFormat    = errors.New("capture: invalid file format")
+	ErrInvalidDirection = errors.New("capture: invalid frame direction")
+	ErrFrameTooLarge    = errors.New("capture: frame too large")
+)
+
+// Direction of the frame relative to the broker
+type Direction byte
+
+const (
+	// DirInbound frame sent by client to broker
+	DirInbound Direction = iota + 1
+	// DirOutbound frame sent by broker to client
+	DirOutbound
+)
+
+// String representation of direction
+func (d Direction) String() string {
+	switch d {
+	case DirInbound:
+		return "in"
+	case DirOutbound:
+		return "out"
+	default:
+		return "invalid"
+	}
+}
+
+// IsValid check if direction is one of defined values
+func (d Direction) IsValid() bool {
+	return d == DirInbound || d == DirOutbound
+}
+
+// Frame raw MQTT packet as seen on the wire
+type Frame struct {
+	// Conn identifies connection frame belongs to
+	Conn uint64
+	// Time when frame has been captured
+	Time time.Time
+	// Dir direction of the frame
+	Dir Direction
+	// Version protocol version of connection at the moment frame has been captured
+	// mqttp.ProtocolAuto if not known yet
+	Version mqttp.ProtocolVersion
+	// Data whole packet including fixed header
+	Data []byte
+}
+
+// Decode frame with mqttp.Decode
+// for frames with unknown version packet must be CONNECT
+func (f *Frame) Decode() (mqttp.IFace, error) {
+	pkt, _, err := mqttp.Decode(f.Version, f.Data)
+	return pkt, err
+}
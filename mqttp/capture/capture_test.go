@@ -0,0 +1,190 @@
+package capture
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/VolantMQ/vlapi/mqttp"
+)
+
+func encode(t *testing.T, p mqttp.IFace) []byte {
+	buf, err := mqttp.Encode(p)
+	require.NoError(t, err)
+
+	return buf
+}
+
+func testConnect(t *testing.T, v mqttp.ProtocolVersion) []byte {
+	pkt := mqttp.NewConnect(v)
+	pkt.SetClean(true)
+	require.NoError(t, pkt.SetClientID([]byte("client")))
+
+	return encode(t, pkt)
+}
+
+func testPublish(t *testing.T, v mqttp.ProtocolVersion, payload string) []byte {
+	pkt := mqttp.NewPublish(v)
+	require.NoError(t, pkt.Set("a/b", []byte(payload), mqttp.QoS1, false, false))
+	pkt.SetPacketID(1)
+
+	return encode(t, pkt)
+}
+
+func TestWriteRead(t *testing.T) {
+	buf := &bytes.Buffer{}
+
+	w, err := NewWriter(buf)
+	require.NoError(t, err)
+
+	start := time.Unix(1000, 500)
+
+	frames := []*Frame{
+		{Conn: 1, Time: start, Dir: DirInbound, Data: testConnect(t, mqttp.ProtocolV50)},
+		{Conn: 2, Time: start.Add(time.Millisecond), Dir: DirInbound, Version: mqttp.ProtocolV311, Data: testPublish(t, mqttp.ProtocolV311, "v3")},
+		{Conn: 1, Time: start.Add(2 * time.Millisecond), Dir: DirOutbound, Data: encode(t, mqttp.NewConnAck(mqttp.ProtocolV50))},
+		{Conn: 1, Time: start.Add(time.Second), Dir: DirInbound, Data: testPublish(t, mqttp.ProtocolV50, "v5")},
+	}
+
+	for _, f := range frames {
+		require.NoError(t, w.WriteFrame(f))
+	}
+
+	require.NoError(t, w.CloseConn(1, start.Add(2*time.Second)))
+	require.NoError(t, w.Flush())
+
+	r, err := NewReader(bytes.NewReader(buf.Bytes()))
+	require.NoError(t, err)
+
+	var pkts []mqttp.IFace
+
+	for i := range frames {
+		f, pkt, e := r.Next()
+		require.NoError(t, e)
+		require.Equal(t, frames[i].Conn, f.Conn)
+		require.Equal(t, frames[i].Dir, f.Dir)
+		require.Equal(t, frames[i].Data, f.Data)
+		require.True(t, frames[i].Time.Equal(f.Time))
+
+		pkts = append(pkts, pkt)
+	}
+
+	_, _, err = r.Next()
+	require.Equal(t, io.EOF, err)
+
+	require.Equal(t, mqttp.CONNECT, pkts[0].Type())
+	require.Equal(t, mqttp.ProtocolV50, pkts[0].Version())
+	require.Equal(t, mqttp.ProtocolV311, pkts[1].Version())
+	// version of connection 1 switched by CONNECT
+	require.Equal(t, mqttp.ProtocolV50, pkts[2].Version())
+	require.Equal(t, []byte("v5"), pkts[3].(*mqttp.Publish).Payload())
+}
+
+func TestReplay(t *testing.T) {
+	buf := &bytes.Buffer{}
+
+	w, err := NewWriter(buf)
+	require.NoError(t, err)
+
+	require.NoError(t, w.SetVersion(1, time.Now(), mqttp.ProtocolV311))
+	require.NoError(t, w.WriteFrame(&Frame{Conn: 1, Time: time.Now(), Dir: DirInbound, Data: testPublish(t, mqttp.ProtocolV311, "a")}))
+	require.NoError(t, w.WriteFrame(&Frame{Conn: 1, Time: time.Now(), Dir: DirInbound, Data: testPublish(t, mqttp.ProtocolV311, "b")}))
+	require.NoError(t, w.Flush())
+
+	var payloads []string
+
+	err = Replay(bytes.NewReader(buf.Bytes()), func(f *Frame, pkt mqttp.IFace) error {
+		payloads = append(payloads, string(pkt.(*mqttp.Publish).Payload()))
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{"a", "b"}, payloads)
+}
+
+func TestInvalid(t *testing.T) {
+	_, err := NewReader(bytes.NewReader([]byte("VMQ")))
+	require.Equal(t, ErrInvalidFormat, err)
+
+	_, err = NewReader(bytes.NewReader([]byte("VMQC\x02")))
+	require.Equal(t, ErrInvalidFormat, err)
+
+	w, err := NewWriter(&bytes.Buffer{})
+	require.NoError(t, err)
+	require.Equal(t, ErrInvalidDirection, w.WriteFrame(&Frame{Conn: 1, Data: []byte{0xC0, 0x00}}))
+
+	// record cut in the middle
+	buf := &bytes.Buffer{}
+	w, err = NewWriter(buf)
+	require.NoError(t, err)
+	require.NoError(t, w.WriteFrame(&Frame{Conn: 1, Time: time.Now(), Dir: DirInbound, Data: []byte{0xC0, 0x00}}))
+	require.NoError(t, w.Flush())
+
+	r, err := NewReader(bytes.NewReader(buf.Bytes()[:buf.Len()-1]))
+	require.NoError(t, err)
+
+	_, err = r.ReadFrame()
+	require.Equal(t, io.ErrUnexpectedEOF, err)
+
+	// corrupted length must not allocate before data is read
+	var hdr []byte
+	hdr = append(hdr, magic[:]...)
+	hdr = append(hdr, formatVersion, recordFrame, 0x01, 0x00, byte(DirInbound))
+	var size [binary.MaxVarintLen64]byte
+	hdr = append(hdr, size[:binary.PutUvarint(size[:], maxFrameSize)]...)
+	hdr = append(hdr, 0xC0, 0x00)
+
+	r, err = NewReader(bytes.NewReader(hdr))
+	require.NoError(t, err)
+
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+
+	_, err = r.ReadFrame()
+	require.Equal(t, io.ErrUnexpectedEOF, err)
+
+	runtime.ReadMemStats(&after)
+	require.Less(t, after.TotalAlloc-before.TotalAlloc, uint64(1024*1024))
+
+	// PUBLISH with no version known can't be decoded
+	buf.Reset()
+	w, err = NewWriter(buf)
+	require.NoError(t, err)
+	require.NoError(t, w.WriteFrame(&Frame{Conn: 1, Time: time.Now(), Dir: DirInbound, Data: testPublish(t, mqttp.ProtocolV311, "a")}))
+	require.NoError(t, w.Flush())
+
+	r, err = NewReader(bytes.NewReader(buf.Bytes()))
+	require.NoError(t, err)
+
+	f, _, err := r.Next()
+	require.Error(t, err)
+	require.NotNil(t, f)
+}
+
+func TestLargeFrame(t *testing.T) {
+	data := bytes.Repeat([]byte{0xAB}, frameChunk*3+7)
+
+	buf := &bytes.Buffer{}
+	w, err := NewWriter(buf)
+	require.NoError(t, err)
+	require.NoError(t, w.WriteFrame(&Frame{Conn: 1, Time: time.Now(), Dir: DirOutbound, Data: data}))
+	require.NoError(t, w.Flush())
+
+	r, err := NewReader(bytes.NewReader(buf.Bytes()))
+	require.NoError(t, err)
+
+	f, err := r.ReadFrame()
+	require.NoError(t, err)
+	require.Equal(t, data, f.Data)
+
+	// cut in the middle of big frame
+	r, err = NewReader(bytes.NewReader(buf.Bytes()[:buf.Len()-1]))
+	require.NoError(t, err)
+
+	_, err = r.ReadFrame()
+	require.Equal(t, io.ErrUnexpectedEOF, err)
+}
@@ -0,0 +1,287 @@
+package capture
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"math"
+	"time"
+)
+
+// DefaultPort MQTT over TCP port assigned by IANA
+const DefaultPort = 1883
+
+const (
+	pcapMagicMicro    = 0xA1B2C3D4
+	pcapMagicNano     = 0xA1B23C4D
+	pcapngBlockSHB    = 0x0A0D0D0A
+	pcapngBlockIDB    = 0x00000001
+	pcapngBlockSPB    = 0x00000003
+	pcapngBlockEPB    = 0x00000006
+	pcapngByteOrder   = 0x1A2B3C4D
+	pcapngOptEnd      = 0
+	pcapngOptTSResol  = 9
+	pcapMaxPacketSize = 256 * 1024
+	pcapngMaxBlock    = 16 * 1024 * 1024
+)
+
+// ImportPcap reads pcap or pcapng capture from r, reassembles TCP streams to or from
+// the port and records MQTT frames carried by them into w.
+// Client to port traffic is recorded as DirInbound. Each TCP connection gets its own
+// connection id, protocol version is detected from CONNECT packet.
+// port 0 means DefaultPort
+func ImportPcap(r io.Reader, w *Writer, port uint16) error {
+	if port == 0 {
+		port = DefaultPort
+	}
+
+	br := bufio.NewReader(r)
+
+	hdr, err := br.Peek(4)
+	if err != nil {
+		return ErrInvalidFormat
+	}
+
+	imp := newTCPImporter(w, port)
+
+	if binary.BigEndian.Uint32(hdr) == pcapngBlockSHB {
+		err = readPcapng(br, imp.packet)
+	} else {
+		err = readPcap(br, imp.packet)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return w.Flush()
+}
+
+// linkPacket handles packet of given link type captured at tm
+type linkPacket func(link uint32, tm time.Time, data []byte) error
+
+func readPcap(r io.Reader, fn linkPacket) error {
+	var hdr [24]byte
+
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return ErrInvalidFormat
+	}
+
+	var order binary.ByteOrder
+	var nano bool
+
+	switch {
+	case binary.BigEndian.Uint32(hdr[:]) == pcapMagicMicro:
+		order = binary.BigEndian
+	case binary.LittleEndian.Uint32(hdr[:]) == pcapMagicMicro:
+		order = binary.LittleEndian
+	case binary.BigEndian.Uint32(hdr[:]) == pcapMagicNano:
+		order, nano = binary.BigEndian, true
+	case binary.LittleEndian.Uint32(hdr[:]) == pcapMagicNano:
+		order, nano = binary.LittleEndian, true
+	default:
+		return ErrInvalidFormat
+	}
+
+	link := order.Uint32(hdr[20:]) & 0x0FFFFFFF
+
+	var rec [16]byte
+	var data []byte
+
+	for {
+		if _, err := io.ReadFull(r, rec[:]); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return ErrInvalidFormat
+		}
+
+		sec := int64(order.Uint32(rec[0:]))
+		frac := int64(order.Uint32(rec[4:]))
+		size := order.Uint32(rec[8:])
+
+		if size > pcapMaxPacketSize {
+			return ErrInvalidFormat
+		}
+
+		if !nano {
+			frac *= int64(time.Microsecond)
+		}
+
+		if cap(data) < int(size) {
+			data = make([]byte, size)
+		}
+		data = data[:size]
+
+		if _, err := io.ReadFull(r, data); err != nil {
+			return ErrInvalidFormat
+		}
+
+		if err := fn(link, time.Unix(sec, frac), data); err != nil {
+			return err
+		}
+	}
+}
+
+type pcapngInterface struct {
+	link uint32
+	// units of timestamp per second
+	resolution uint64
+}
+
+func readPcapng(r io.Reader, fn linkPacket) error {
+	var order binary.ByteOrder = binary.LittleEndian
+	var ifaces []pcapngInterface
+	var hdr [8]byte
+
+	for {
+		if _, err := io.ReadFull(r, hdr[:]); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return ErrInvalidFormat
+		}
+
+		blockType := binary.BigEndian.Uint32(hdr[0:])
+
+		if blockType == pcapngBlockSHB {
+			// section header defines byte order of the whole section
+			var bom [4]byte
+			if _, err := io.ReadFull(r, bom[:]); err != nil {
+				return ErrInvalidFormat
+			}
+
+			switch {
+			case binary.BigEndian.Uint32(bom[:]) == pcapngByteOrder:
+				order = binary.BigEndian
+			case binary.LittleEndian.Uint32(bom[:]) == pcapngByteOrder:
+				order = binary.LittleEndian
+			default:
+				return ErrInvalidFormat
+			}
+
+			ifaces = ifaces[:0]
+
+			size := order.Uint32(hdr[4:])
+			if size < 16 || size > pcapngMaxBlock || size%4 != 0 {
+				return ErrInvalidFormat
+			}
+
+			if _, err := io.CopyN(ioutil.Discard, r, int64(size)-12); err != nil {
+				return ErrInvalidFormat
+			}
+
+			continue
+		}
+
+		blockType = order.Uint32(hdr[0:])
+		size := order.Uint32(hdr[4:])
+		if size < 12 || size > pcapngMaxBlock || size%4 != 0 {
+			return ErrInvalidFormat
+		}
+
+		body := make([]byte, size-8)
+		if _, err := io.ReadFull(r, body); err != nil {
+			return ErrInvalidFormat
+		}
+
+		// strip trailing block length
+		body = body[:len(body)-4]
+
+		switch blockType {
+		case pcapngBlockIDB:
+			if len(body) < 8 {
+				return ErrInvalidFormat
+			}
+
+			ifaces = append(ifaces, pcapngInterface{
+				link:       uint32(order.Uint16(body[0:])),
+				resolution: pcapngResolution(order, body[8:]),
+			})
+		case pcapngBlockEPB:
+			if len(body) < 20 {
+				return ErrInvalidFormat
+			}
+
+			id := order.Uint32(body[0:])
+			if int(id) >= len(ifaces) {
+				return ErrInvalidFormat
+			}
+
+			ts := uint64(order.Uint32(body[4:]))<<32 | uint64(order.Uint32(body[8:]))
+			caplen := order.Uint32(body[12:])
+
+			if uint64(caplen) > uint64(len(body)-20) {
+				return ErrInvalidFormat
+			}
+
+			iface := ifaces[id]
+
+			if err := fn(iface.link, pcapngTime(ts, iface.resolution), body[20:20+caplen]); err != nil {
+				return err
+			}
+		case pcapngBlockSPB:
+			// simple packet block carries no timestamp
+			if len(body) < 4 || len(ifaces) == 0 {
+				return ErrInvalidFormat
+			}
+
+			caplen := order.Uint32(body[0:])
+			if uint64(caplen) > uint64(len(body)-4) {
+				caplen = uint32(len(body) - 4)
+			}
+
+			if err := fn(ifaces[0].link, time.Unix(0, 0), body[4:4+caplen]); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// pcapngResolution parses if_tsresol option, default resolution is microseconds
+func pcapngResolution(order binary.ByteOrder, opts []byte) uint64 {
+	for len(opts) >= 4 {
+		code := order.Uint16(opts[0:])
+		size := int(order.Uint16(opts[2:]))
+		opts = opts[4:]
+
+		if code == pcapngOptEnd || size > len(opts) {
+			break
+		}
+
+		if code == pcapngOptTSResol && size >= 1 {
+			v := opts[0]
+			if v&0x80 != 0 {
+				if v&0x7F < 64 {
+					return 1 << (v & 0x7F)
+				}
+			} else if v <= 19 {
+				return uint64(math.Pow10(int(v)))
+			}
+		}
+
+		size = (size + 3) &^ 3
+		if size > len(opts) {
+			break
+		}
+
+		opts = opts[size:]
+	}
+
+	return uint64(time.Second / time.Microsecond)
+}
+
+// pcapngTime converts timestamp in units of given resolution
+func pcapngTime(ts, resolution uint64) time.Time {
+	frac := ts % resolution
+
+	var nsec uint64
+	if resolution <= math.MaxUint64/uint64(time.Second) {
+		nsec = frac * uint64(time.Second) / resolution
+	} else {
+		nsec = frac / (resolution / uint64(time.Second))
+	}
+
+	return time.Unix(int64(ts/resolution), int64(nsec))
+}
@@ -0,0 +1,210 @@
+package capture
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/VolantMQ/vlapi/mqttp"
+)
+
+var (
+	testClient = []byte{10, 0, 0, 1}
+	testServer = []byte{10, 0, 0, 2}
+)
+
+type testSegment struct {
+	inbound bool
+	seq     uint32
+	flags   byte
+	data    []byte
+}
+
+// ethernet + IPv4 + TCP
+func testPacket(s testSegment) []byte {
+	srcIP, dstIP := testClient, testServer
+	srcPort, dstPort := uint16(50000), uint16(DefaultPort)
+
+	if !s.inbound {
+		srcIP, dstIP = dstIP, srcIP
+		srcPort, dstPort = dstPort, srcPort
+	}
+
+	pkt := make([]byte, 14+20+20+len(s.data))
+
+	binary.BigEndian.PutUint16(pkt[12:], etherTypeIPv4)
+
+	ip := pkt[14:]
+	ip[0] = 0x45
+	binary.BigEndian.PutUint16(ip[2:], uint16(20+20+len(s.data)))
+	ip[8] = 64
+	ip[9] = ipProtoTCP
+	copy(ip[12:], srcIP)
+	copy(ip[16:], dstIP)
+
+	tcp := ip[20:]
+	binary.BigEndian.PutUint16(tcp[0:], srcPort)
+	binary.BigEndian.PutUint16(tcp[2:], dstPort)
+	binary.BigEndian.PutUint32(tcp[4:], s.seq)
+	tcp[12] = 5 << 4
+	tcp[13] = s.flags
+	copy(tcp[20:], s.data)
+
+	return pkt
+}
+
+func testPcap(segments []testSegment, start time.Time) []byte {
+	buf := &bytes.Buffer{}
+
+	hdr := make([]byte, 24)
+	binary.LittleEndian.PutUint32(hdr[0:], pcapMagicMicro)
+	binary.LittleEndian.PutUint16(hdr[4:], 2)
+	binary.LittleEndian.PutUint16(hdr[6:], 4)
+	binary.LittleEndian.PutUint32(hdr[16:], 65535)
+	binary.LittleEndian.PutUint32(hdr[20:], linkEthernet)
+	buf.Write(hdr)
+
+	for i, s := range segments {
+		pkt := testPacket(s)
+		tm := start.Add(time.Duration(i) * time.Millisecond)
+
+		rec := make([]byte, 16)
+		binary.LittleEndian.PutUint32(rec[0:], uint32(tm.Unix()))
+		binary.LittleEndian.PutUint32(rec[4:], uint32(tm.Nanosecond()/1000))
+		binary.LittleEndian.PutUint32(rec[8:], uint32(len(pkt)))
+		binary.LittleEndian.PutUint32(rec[12:], uint32(len(pkt)))
+		buf.Write(rec)
+		buf.Write(pkt)
+	}
+
+	return buf.Bytes()
+}
+
+func testPcapngBlock(buf *bytes.Buffer, blockType uint32, body []byte) {
+	for len(body)%4 != 0 {
+		body = append(body, 0)
+	}
+
+	size := uint32(12 + len(body))
+
+	hdr := make([]byte, 8)
+	binary.BigEndian.PutUint32(hdr[0:], blockType)
+	binary.BigEndian.PutUint32(hdr[4:], size)
+	buf.Write(hdr)
+	buf.Write(body)
+	buf.Write(hdr[4:])
+}
+
+// big endian section with nanosecond resolution interface
+func testPcapng(segments []testSegment, start time.Time) []byte {
+	buf := &bytes.Buffer{}
+
+	shb := make([]byte, 16)
+	binary.BigEndian.PutUint32(shb[0:], pcapngByteOrder)
+	binary.BigEndian.PutUint16(shb[4:], 1)
+	binary.BigEndian.PutUint64(shb[8:], 0xFFFFFFFFFFFFFFFF)
+	testPcapngBlock(buf, pcapngBlockSHB, shb)
+
+	idb := make([]byte, 8, 20)
+	binary.BigEndian.PutUint16(idb[0:], linkEthernet)
+	binary.BigEndian.PutUint32(idb[4:], 65535)
+	idb = append(idb, 0, pcapngOptTSResol, 0, 1, 9, 0, 0, 0, 0, 0, 0, 0)
+	testPcapngBlock(buf, pcapngBlockIDB, idb)
+
+	for i, s := range segments {
+		pkt := testPacket(s)
+		ts := uint64(start.Add(time.Duration(i) * time.Millisecond).UnixNano())
+
+		epb := make([]byte, 20)
+		binary.BigEndian.PutUint32(epb[4:], uint32(ts>>32))
+		binary.BigEndian.PutUint32(epb[8:], uint32(ts))
+		binary.BigEndian.PutUint32(epb[12:], uint32(len(pkt)))
+		binary.BigEndian.PutUint32(epb[16:], uint32(len(pkt)))
+		testPcapngBlock(buf, pcapngBlockEPB, append(epb, pkt...))
+	}
+
+	return buf.Bytes()
+}
+
+func testSegments(t *testing.T) []testSegment {
+	connect := testConnect(t, mqttp.ProtocolV50)
+	connAck := encode(t, mqttp.NewConnAck(mqttp.ProtocolV50))
+	pub1 := testPublish(t, mqttp.ProtocolV50, "first")
+	pub2 := testPublish(t, mqttp.ProtocolV50, "second")
+
+	cSeq := uint32(1000)
+	sSeq := uint32(5000)
+
+	// CONNECT split into two segments, second PUBLISH arrives before the first one
+	// and the first one is retransmitted
+	pubs := append(append([]byte(nil), pub1...), pub2...)
+
+	return []testSegment{
+		{inbound: true, seq: cSeq, flags: tcpFlagSYN},
+		{inbound: false, seq: sSeq, flags: tcpFlagSYN},
+		{inbound: true, seq: cSeq + 1, data: connect[:3]},
+		{inbound: true, seq: cSeq + 4, data: connect[3:]},
+		{inbound: false, seq: sSeq + 1, data: connAck},
+		{inbound: true, seq: cSeq + 1 + uint32(len(connect)+len(pub1)), data: pub2},
+		{inbound: true, seq: cSeq + 1 + uint32(len(connect)), data: pub1},
+		{inbound: true, seq: cSeq + 1 + uint32(len(connect)), data: pubs},
+		{inbound: true, seq: cSeq + 1 + uint32(len(connect)+len(pubs)), flags: tcpFlagFIN},
+		{inbound: false, seq: sSeq + 1 + uint32(len(connAck)), flags: tcpFlagFIN},
+	}
+}
+
+func requireImported(t *testing.T, data []byte, start time.Time) {
+	buf := &bytes.Buffer{}
+
+	w, err := NewWriter(buf)
+	require.NoError(t, err)
+	require.NoError(t, ImportPcap(bytes.NewReader(data), w, 0))
+
+	var frames []*Frame
+	var pkts []mqttp.IFace
+
+	err = Replay(bytes.NewReader(buf.Bytes()), func(f *Frame, pkt mqttp.IFace) error {
+		frames = append(frames, f)
+		pkts = append(pkts, pkt)
+		return nil
+	})
+	require.NoError(t, err)
+	require.Len(t, pkts, 4)
+
+	require.Equal(t, mqttp.CONNECT, pkts[0].Type())
+	require.Equal(t, DirInbound, frames[0].Dir)
+	require.Equal(t, mqttp.ProtocolV50, frames[0].Version)
+	require.True(t, start.Add(3*time.Millisecond).Equal(frames[0].Time))
+
+	require.Equal(t, mqttp.CONNACK, pkts[1].Type())
+	require.Equal(t, DirOutbound, frames[1].Dir)
+	require.Equal(t, mqttp.ProtocolV50, frames[1].Version)
+
+	require.Equal(t, []byte("first"), pkts[2].(*mqttp.Publish).Payload())
+	require.Equal(t, []byte("second"), pkts[3].(*mqttp.Publish).Payload())
+
+	for _, f := range frames {
+		require.Equal(t, uint64(1), f.Conn)
+	}
+}
+
+func TestImportPcap(t *testing.T) {
+	start := time.Unix(1600000000, 123000)
+	requireImported(t, testPcap(testSegments(t), start), start)
+}
+
+func TestImportPcapng(t *testing.T) {
+	start := time.Unix(1600000000, 123456789)
+	requireImported(t, testPcapng(testSegments(t), start), start)
+}
+
+func TestImportPcapInvalid(t *testing.T) {
+	w, err := NewWriter(&bytes.Buffer{})
+	require.NoError(t, err)
+
+	require.Equal(t, ErrInvalidFormat, ImportPcap(bytes.NewReader([]byte{1, 2, 3, 4, 5}), w, 0))
+	require.Equal(t, ErrInvalidFormat, ImportPcap(bytes.NewReader(nil), w, 0))
+}
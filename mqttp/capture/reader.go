@@ -0,0 +1,189 @@
+package capture
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"time"
+
+	"github.com/VolantMQ/vlapi/mqttp"
+)
+
+// Reader reads frames recorded by Writer
+type Reader struct {
+	r        *bufio.Reader
+	versions map[uint64]mqttp.ProtocolVersion
+	last     int64
+}
+
+// NewReader validates file header and returns reader
+func NewReader(r io.Reader) (*Reader, error) {
+	rd := &Reader{
+		r:        bufio.NewReader(r),
+		versions: make(map[uint64]mqttp.ProtocolVersion),
+	}
+
+	var hdr [len(magic) + 1]byte
+
+	if _, err := io.ReadFull(rd.r, hdr[:]); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			err = ErrInvalidFormat
+		}
+		return nil, err
+	}
+
+	if [4]byte{hdr[0], hdr[1], hdr[2], hdr[3]} != magic || hdr[4] != formatVersion {
+		return nil, ErrInvalidFormat
+	}
+
+	return rd, nil
+}
+
+// ReadFrame returns next frame
+// returns io.EOF when there is no more records
+func (r *Reader) ReadFrame() (*Frame, error) {
+	for {
+		kind, err := r.r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+
+		conn, err := binary.ReadUvarint(r.r)
+		if err != nil {
+			return nil, unexpected(err)
+		}
+
+		delta, err := binary.ReadVarint(r.r)
+		if err != nil {
+			return nil, unexpected(err)
+		}
+
+		r.last += delta
+
+		switch kind {
+		case recordVersion:
+			var v byte
+			if v, err = r.r.ReadByte(); err != nil {
+				return nil, unexpected(err)
+			}
+
+			r.versions[conn] = mqttp.ProtocolVersion(v)
+		case recordClose:
+			delete(r.versions, conn)
+		case recordFrame:
+			return r.readFrame(conn)
+		default:
+			return nil, ErrInvalidFormat
+		}
+	}
+}
+
+// Next reads and decodes next frame
+// CONNECT packets switch version of the connection used to decode subsequent frames
+// decode error is returned along with frame, thus caller can decide either
+// to skip it or to stop
+func (r *Reader) Next() (*Frame, mqttp.IFace, error) {
+	f, err := r.ReadFrame()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	pkt, err := f.Decode()
+	if err != nil {
+		return f, nil, err
+	}
+
+	if pkt.Type() == mqttp.CONNECT {
+		r.versions[f.Conn] = pkt.Version()
+	}
+
+	return f, pkt, nil
+}
+
+// Replay decodes all frames from r and invokes fn for each of them
+// iteration stops on first decode error or error returned by fn
+func Replay(r io.Reader, fn func(*Frame, mqttp.IFace) error) error {
+	rd, err := NewReader(r)
+	if err != nil {
+		return err
+	}
+
+	for {
+		f, pkt, err := rd.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		if err = fn(f, pkt); err != nil {
+			return err
+		}
+	}
+}
+
+func (r *Reader) readFrame(conn uint64) (*Frame, error) {
+	dir, err := r.r.ReadByte()
+	if err != nil {
+		return nil, unexpected(err)
+	}
+
+	if !Direction(dir).IsValid() {
+		return nil, ErrInvalidDirection
+	}
+
+	size, err := binary.ReadUvarint(r.r)
+	if err != nil {
+		return nil, unexpected(err)
+	}
+
+	if size > maxFrameSize {
+		return nil, ErrFrameTooLarge
+	}
+
+	data, err := r.readData(int64(size))
+	if err != nil {
+		return nil, err
+	}
+
+	f := &Frame{
+		Conn:    conn,
+		Time:    time.Unix(0, r.last),
+		Dir:     Direction(dir),
+		Version: r.versions[conn],
+		Data:    data,
+	}
+
+	return f, nil
+}
+
+// readData reads size bytes of frame
+// length comes from the file thus is not trusted, big frames grow as data arrives
+func (r *Reader) readData(size int64) ([]byte, error) {
+	if size <= frameChunk {
+		data := make([]byte, size)
+		if _, err := io.ReadFull(r.r, data); err != nil {
+			return nil, unexpected(err)
+		}
+
+		return data, nil
+	}
+
+	buf := bytes.NewBuffer(make([]byte, 0, frameChunk))
+
+	if _, err := io.CopyN(buf, r.r, size); err != nil {
+		return nil, unexpected(err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// unexpected record has been cut in the middle
+func unexpected(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+
+	return err
+}
@@ -0,0 +1,337 @@
+package capture
+
+import (
+	"encoding/binary"
+	"time"
+
+	"github.com/VolantMQ/vlapi/mqttp"
+)
+
+const (
+	linkNull      = 0
+	linkEthernet  = 1
+	linkRaw       = 101
+	linkLinuxSLL  = 113
+	linkLoop      = 108
+	linkIPv4      = 228
+	linkIPv6      = 229
+	linkLinuxSLL2 = 276
+
+	etherTypeIPv4 = 0x0800
+	etherTypeIPv6 = 0x86DD
+	etherTypeVLAN = 0x8100
+
+	ipProtoTCP = 6
+
+	tcpFlagFIN = 0x01
+	tcpFlagSYN = 0x02
+	tcpFlagRST = 0x04
+)
+
+// tcpFlow one direction of TCP connection
+type tcpFlow struct {
+	pending  map[uint32][]byte
+	buf      []byte
+	next     uint32
+	synced   bool
+	finished bool
+}
+
+type tcpConn struct {
+	id      uint64
+	version mqttp.ProtocolVersion
+	flows   [2]tcpFlow
+}
+
+// tcpImporter reassembles TCP streams of MQTT connections and splits them into frames
+type tcpImporter struct {
+	w      *Writer
+	conns  map[string]*tcpConn
+	lastID uint64
+	port   uint16
+}
+
+func newTCPImporter(w *Writer, port uint16) *tcpImporter {
+	return &tcpImporter{
+		w:     w,
+		conns: make(map[string]*tcpConn),
+		port:  port,
+	}
+}
+
+// packet strips link layer and hands IP packet over
+// packets of unsupported link or network types are ignored
+func (imp *tcpImporter) packet(link uint32, tm time.Time, data []byte) error {
+	switch link {
+	case linkEthernet:
+		if len(data) < 14 {
+			return nil
+		}
+
+		etherType := binary.BigEndian.Uint16(data[12:])
+		data = data[14:]
+
+		for etherType == etherTypeVLAN && len(data) >= 4 {
+			etherType = binary.BigEndian.Uint16(data[2:])
+			data = data[4:]
+		}
+
+		if etherType != etherTypeIPv4 && etherType != etherTypeIPv6 {
+			return nil
+		}
+	case linkNull, linkLoop:
+		if len(data) < 4 {
+			return nil
+		}
+		data = data[4:]
+	case linkLinuxSLL:
+		if len(data) < 16 {
+			return nil
+		}
+		data = data[16:]
+	case linkLinuxSLL2:
+		if len(data) < 20 {
+			return nil
+		}
+		data = data[20:]
+	case linkRaw, linkIPv4, linkIPv6:
+	default:
+		return nil
+	}
+
+	return imp.ip(tm, data)
+}
+
+func (imp *tcpImporter) ip(tm time.Time, data []byte) error {
+	if len(data) < 1 {
+		return nil
+	}
+
+	var src, dst []byte
+
+	switch data[0] >> 4 {
+	case 4:
+		if len(data) < 20 {
+			return nil
+		}
+
+		ihl := int(data[0]&0x0F) * 4
+		total := int(binary.BigEndian.Uint16(data[2:]))
+
+		// fragmented packets are not supported
+		if ihl < 20 || total < ihl || total > len(data) || data[9] != ipProtoTCP ||
+			binary.BigEndian.Uint16(data[6:])&0x3FFF != 0 {
+			return nil
+		}
+
+		src, dst = data[12:16], data[16:20]
+		data = data[ihl:total]
+	case 6:
+		if len(data) < 40 {
+			return nil
+		}
+
+		total := 40 + int(binary.BigEndian.Uint16(data[4:]))
+
+		// extension headers are not supported
+		if total > len(data) || data[6] != ipProtoTCP {
+			return nil
+		}
+
+		src, dst = data[8:24], data[24:40]
+		data = data[40:total]
+	default:
+		return nil
+	}
+
+	return imp.tcp(tm, src, dst, data)
+}
+
+func (imp *tcpImporter) tcp(tm time.Time, src, dst []byte, data []byte) error {
+	if len(data) < 20 {
+		return nil
+	}
+
+	srcPort := binary.BigEndian.Uint16(data[0:])
+	dstPort := binary.BigEndian.Uint16(data[2:])
+	seq := binary.BigEndian.Uint32(data[4:])
+	offset := int(data[12]>>4) * 4
+	flags := data[13]
+
+	if offset < 20 || offset > len(data) {
+		return nil
+	}
+
+	var dir Direction
+	var key string
+
+	switch imp.port {
+	case dstPort:
+		dir = DirInbound
+		key = endpoint(src, srcPort) + "-" + endpoint(dst, dstPort)
+	case srcPort:
+		dir = DirOutbound
+		key = endpoint(dst, dstPort) + "-" + endpoint(src, srcPort)
+	default:
+		return nil
+	}
+
+	conn := imp.conns[key]
+	if conn == nil {
+		// capture started in the middle of connection without SYN seen
+		// still makes sense to try as long as it starts on packet boundary
+		imp.lastID++
+		conn = &tcpConn{
+			id: imp.lastID,
+		}
+		imp.conns[key] = conn
+	}
+
+	flow := &conn.flows[dir-1]
+
+	if flags&tcpFlagSYN != 0 {
+		flow.next = seq + 1
+		flow.synced = true
+		seq++
+	}
+
+	if err := imp.payload(tm, conn, dir, flow, seq, data[offset:]); err != nil {
+		return err
+	}
+
+	if flags&tcpFlagFIN != 0 {
+		flow.finished = true
+	}
+
+	if flags&tcpFlagRST != 0 || (conn.flows[0].finished && conn.flows[1].finished) {
+		delete(imp.conns, key)
+		return imp.w.CloseConn(conn.id, tm)
+	}
+
+	return nil
+}
+
+// payload puts segment into stream order and emits all complete frames
+func (imp *tcpImporter) payload(tm time.Time, conn *tcpConn, dir Direction, flow *tcpFlow, seq uint32, data []byte) error {
+	if len(data) == 0 {
+		return nil
+	}
+
+	if !flow.synced {
+		flow.next = seq
+		flow.synced = true
+	}
+
+	if diff := int32(seq - flow.next); diff > 0 {
+		// out of order segment, keep it until gap is filled
+		if flow.pending == nil {
+			flow.pending = make(map[uint32][]byte)
+		}
+
+		flow.pending[seq] = append([]byte(nil), data...)
+
+		return nil
+	}
+
+	flow.append(seq, data)
+
+	for len(flow.pending) > 0 {
+		progress := false
+
+		for s, d := range flow.pending {
+			if int32(s-flow.next) <= 0 {
+				delete(flow.pending, s)
+				flow.append(s, d)
+				progress = true
+			}
+		}
+
+		if !progress {
+			break
+		}
+	}
+
+	return imp.frames(tm, conn, dir, flow)
+}
+
+// append segment starting at or before next expected sequence number
+// retransmitted data is skipped
+func (f *tcpFlow) append(seq uint32, data []byte) {
+	overlap := int(f.next - seq)
+	if overlap >= len(data) {
+		return
+	}
+
+	data = data[overlap:]
+	f.buf = append(f.buf, data...)
+	f.next += uint32(len(data))
+}
+
+func (imp *tcpImporter) frames(tm time.Time, conn *tcpConn, dir Direction, flow *tcpFlow) error {
+	for len(flow.buf) > 1 {
+		var remLen uint32
+		var shift uint
+
+		fhLen := 1
+		complete := false
+
+		// [MQTT-1.5.5] variable byte integer
+		for fhLen < len(flow.buf) && fhLen <= 4 {
+			b := flow.buf[fhLen]
+			fhLen++
+
+			remLen |= uint32(b&0x7F) << shift
+			shift += 7
+
+			if b < 0x80 {
+				complete = true
+				break
+			}
+		}
+
+		if !complete {
+			if fhLen > 4 {
+				// stream is not MQTT or out of sync, nothing can be done
+				flow.buf = flow.buf[:0]
+			}
+
+			return nil
+		}
+
+		total := fhLen + int(remLen)
+		if total > len(flow.buf) {
+			return nil
+		}
+
+		f := &Frame{
+			Conn:    conn.id,
+			Time:    tm,
+			Dir:     dir,
+			Version: conn.version,
+			Data:    append([]byte(nil), flow.buf[:total]...),
+		}
+
+		if dir == DirInbound && mqttp.Type(f.Data[0]>>4) == mqttp.CONNECT {
+			if pkt, _, err := mqttp.DecodeWithOptions(f.Data, mqttp.DecodeOptions{Lenient: true}); err == nil {
+				conn.version = pkt.Version()
+				f.Version = conn.version
+			}
+		}
+
+		flow.buf = flow.buf[:copy(flow.buf, flow.buf[total:])]
+
+		if err := imp.w.WriteFrame(f); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func endpoint(addr []byte, port uint16) string {
+	b := make([]byte, 0, len(addr)+2)
+	b = append(b, addr...)
+	b = append(b, byte(port>>8), byte(port))
+
+	return string(b)
+}
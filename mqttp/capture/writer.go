@@ -0,0 +1,141 @@
+package capture
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/VolantMQ/vlapi/mqttp"
+)
+
+// Writer records frames into capture file
+// It is safe to write frames of different connections concurrently
+type Writer struct {
+	w        *bufio.Writer
+	versions map[uint64]mqttp.ProtocolVersion
+	last     int64
+	tmp      [binary.MaxVarintLen64]byte
+	lock     sync.Mutex
+}
+
+// NewWriter writes file header into w and returns writer
+// Writer is buffered, Flush must be called when capture finished
+func NewWriter(w io.Writer) (*Writer, error) {
+	wr := &Writer{
+		w:        bufio.NewWriter(w),
+		versions: make(map[uint64]mqttp.ProtocolVersion),
+	}
+
+	if _, err := wr.w.Write(magic[:]); err != nil {
+		return nil, err
+	}
+
+	if err := wr.w.WriteByte(formatVersion); err != nil {
+		return nil, err
+	}
+
+	return wr, nil
+}
+
+// SetVersion record protocol version of the connection
+// frames written after this call with mqttp.ProtocolAuto version inherit it
+func (w *Writer) SetVersion(conn uint64, tm time.Time, v mqttp.ProtocolVersion) error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	return w.writeVersion(conn, tm, v)
+}
+
+// WriteFrame record single frame
+// if frame version differs from version recorded for connection version record
+// is written first
+func (w *Writer) WriteFrame(f *Frame) error {
+	if !f.Dir.IsValid() {
+		return ErrInvalidDirection
+	}
+
+	if len(f.Data) > maxFrameSize {
+		return ErrFrameTooLarge
+	}
+
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if f.Version != mqttp.ProtocolAuto && f.Version != w.versions[f.Conn] {
+		if err := w.writeVersion(f.Conn, f.Time, f.Version); err != nil {
+			return err
+		}
+	}
+
+	if err := w.writeRecord(recordFrame, f.Conn, f.Time); err != nil {
+		return err
+	}
+
+	if err := w.w.WriteByte(byte(f.Dir)); err != nil {
+		return err
+	}
+
+	if err := w.writeUvarint(uint64(len(f.Data))); err != nil {
+		return err
+	}
+
+	_, err := w.w.Write(f.Data)
+
+	return err
+}
+
+// CloseConn record connection has been closed
+// connection id might be reused after this call
+func (w *Writer) CloseConn(conn uint64, tm time.Time) error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	delete(w.versions, conn)
+
+	return w.writeRecord(recordClose, conn, tm)
+}
+
+// Flush buffered records into underlying writer
+func (w *Writer) Flush() error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	return w.w.Flush()
+}
+
+func (w *Writer) writeVersion(conn uint64, tm time.Time, v mqttp.ProtocolVersion) error {
+	if err := w.writeRecord(recordVersion, conn, tm); err != nil {
+		return err
+	}
+
+	w.versions[conn] = v
+
+	return w.w.WriteByte(byte(v))
+}
+
+func (w *Writer) writeRecord(kind byte, conn uint64, tm time.Time) error {
+	if err := w.w.WriteByte(kind); err != nil {
+		return err
+	}
+
+	if err := w.writeUvarint(conn); err != nil {
+		return err
+	}
+
+	ts := tm.UnixNano()
+	n := binary.PutVarint(w.tmp[:], ts-w.last)
+	w.last = ts
+
+	_, err := w.w.Write(w.tmp[:n])
+
+	return err
+}
+
+func (w *Writer) writeUvarint(v uint64) error {
+	n := binary.PutUvarint(w.tmp[:], v)
+	_, err := w.w.Write(w.tmp[:n])
+
+	return err
+}
@@ -151,3 +151,9 @@ func (msg *ConnAck) size() int {
 
 	return total
 }
+
+func (msg *ConnAck) reset() {
+	msg.resetHeader()
+	msg.sessionPresent = false
+	msg.returnCode = CodeSuccess
+}
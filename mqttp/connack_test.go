@@ -161,7 +161,7 @@ func TestConnAckDecodeEncodeEquiv(t *testing.T) {
 	require.Equal(t, buf, dst[:n2], "Error decoding message.")
 
 	_, _, err = Decode(ProtocolV311, dst)
-	require.EqualError(t, err, CodeProtocolError.Error(), "Error decoding message")
+	requireErrorIs(t, err, CodeProtocolError)
 
 	_, n3, err := Decode(ProtocolV311, dst[:n2])
 	require.NoError(t, err, "Error decoding message.")
@@ -15,6 +15,7 @@
 package mqttp
 
 import (
+	"bytes"
 	"encoding/binary"
 	"regexp"
 	"unicode/utf8"
@@ -329,7 +330,7 @@ func (msg *Connect) decodeMessage(from []byte) (int, error) {
 	// V3.1.1 [MQTT-3.1.2-1]
 	// V5.0   [MQTT-3.1.2-1]
 	if !utf8.Valid(protoName) {
-		return offset, ErrProtocolInvalidName
+		return offset, violation(ErrProtocolInvalidName, "MQTT-3.1.2-1")
 	}
 
 	// V3.1.1 [MQTT-3.1.2.2]
@@ -340,7 +341,7 @@ func (msg *Connect) decodeMessage(from []byte) (int, error) {
 	// V3.1.1 [MQTT-3.1.2-2]
 	// V5.0   [MQTT-3.1.2-2]
 	if verStr, ok := SupportedVersions[msg.version]; !ok || verStr != string(protoName) {
-		return offset, ErrInvalidProtocolVersion
+		return offset, violation(ErrInvalidProtocolVersion, "MQTT-3.1.2-2")
 	}
 
 	// V3.1.1 [MQTT-3.1.2.3]
@@ -358,7 +359,7 @@ func (msg *Connect) decodeMessage(from []byte) (int, error) {
 			rejectCode = CodeRefusedServerUnavailable
 		}
 
-		return offset, rejectCode
+		return offset, violation(rejectCode, "MQTT-3.1.2-3")
 	}
 
 	// V3.1.1 [MQTT-3.1.2-14]
@@ -371,23 +372,27 @@ func (msg *Connect) decodeMessage(from []byte) (int, error) {
 			rejectCode = CodeRefusedServerUnavailable
 		}
 
-		return offset, rejectCode
+		return offset, violation(rejectCode, "MQTT-3.1.2-14")
 	}
 
+	// V3.1.1 [MQTT-3.1.2-13] [MQTT-3.1.2-15]
+	// V5.0   [MQTT-3.1.2-11] [MQTT-3.1.2-13]
 	if !msg.willFlag() && (msg.willRetain() || (msg.willQos() != QoS0)) {
 		var rejectCode ReasonCode
+		rule := "MQTT-3.1.2-13"
 		if msg.version == ProtocolV50 {
 			rejectCode = CodeMalformedPacket
+			rule = "MQTT-3.1.2-11"
 		} else {
 			rejectCode = CodeRefusedServerUnavailable
 		}
 
-		return offset, rejectCode
+		return offset, violation(rejectCode, rule)
 	}
 
 	// V3.1.1 [MQTT-3.1.2-22].
 	if (!msg.usernameFlag() && msg.passwordFlag()) && msg.version < ProtocolV50 {
-		return offset, CodeRefusedBadUsernameOrPassword
+		return offset, violation(CodeRefusedBadUsernameOrPassword, "MQTT-3.1.2-22")
 	}
 
 	// V3.1.1 [MQTT-3.1.2.10]
@@ -415,7 +420,7 @@ func (msg *Connect) decodeMessage(from []byte) (int, error) {
 	// v5.0    [MQTT-3.1.3.1]
 	// If the Client supplies a zero-byte ClientId, the Client MUST also set CleanSession to 1
 	if len(msg.clientID) == 0 && msg.version < ProtocolV50 && !msg.IsClean() {
-		return offset, CodeRefusedIdentifierRejected
+		return offset, violation(CodeRefusedIdentifierRejected, "MQTT-3.1.3-7")
 	}
 
 	// The ClientId must contain only characters 0-9, a-z, and A-Z
@@ -429,7 +434,7 @@ func (msg *Connect) decodeMessage(from []byte) (int, error) {
 			rejectCode = CodeRefusedIdentifierRejected
 		}
 
-		return offset, rejectCode
+		return offset, violation(rejectCode, "MQTT-3.1.3-5")
 	}
 
 	if msg.willFlag() {
@@ -503,11 +508,11 @@ func (msg *Connect) decodeMessage(from []byte) (int, error) {
 		offset += n
 
 		// [MQTT-3.1.3-11]
-		if !IsValidUTF(msg.username) {
+		if !msg.validString(msg.username) {
 			if msg.version < ProtocolV50 {
-				return offset, CodeRefusedBadUsernameOrPassword
+				return offset, violation(CodeRefusedBadUsernameOrPassword, "MQTT-3.1.3-11")
 			}
-			return offset, CodeBadUserOrPassword
+			return offset, violation(CodeBadUserOrPassword, "MQTT-3.1.3-11")
 		}
 	}
 
@@ -595,5 +600,26 @@ func (msg *Connect) validClientID(cid []byte) bool {
 
 	// V3.1.1  [MQTT-3.1.3-4]      [MQTT-3.1.3-5]
 	// V5.0    [MQTT-3.1.3-4]      [MQTT-3.1.3-5]
-	return IsValidUTF(cid) && clientIDRegexp.Match(cid)
+	return msg.validString(cid) && (msg.lenient || clientIDRegexp.Match(cid))
+}
+
+// validString checks UTF-8 string against [MQTT-1.5.3]
+// in lenient mode control characters other than U+0000 are allowed
+func (msg *Connect) validString(s []byte) bool {
+	if msg.lenient {
+		// [MQTT-1.5.3-2]
+		return utf8.Valid(s) && bytes.IndexByte(s, 0) < 0
+	}
+
+	return IsValidUTF(s)
+}
+
+func (msg *Connect) reset() {
+	msg.resetHeader()
+	msg.keepAlive = 0
+	msg.connectFlags = 0
+	msg.clientID = nil
+	msg.username = nil
+	msg.password = nil
+	msg.will = nil
 }
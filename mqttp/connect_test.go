@@ -211,10 +211,10 @@ func TestConnectMessageDecode2(t *testing.T) {
 	}
 
 	_, _, err := Decode(ProtocolV311, buf)
-	require.EqualError(t, err, ErrInsufficientDataSize.Error())
+	requireErrorIs(t, err, ErrInsufficientDataSize)
 
 	_, _, err = Decode(ProtocolV50, buf)
-	require.EqualError(t, err, ErrInsufficientDataSize.Error())
+	requireErrorIs(t, err, ErrInsufficientDataSize)
 
 	// missing last byte 't'
 	buf = []byte{
@@ -280,10 +280,10 @@ func TestConnectMessageDecode3(t *testing.T) {
 	}
 
 	_, _, err := Decode(ProtocolV311, buf)
-	require.EqualError(t, err, CodeProtocolError.Error())
+	requireErrorIs(t, err, CodeProtocolError)
 
 	_, _, err = Decode(ProtocolV50, buf)
-	require.EqualError(t, err, CodeProtocolError.Error())
+	requireErrorIs(t, err, CodeProtocolError)
 }
 
 func TestConnectMessageDecode4(t *testing.T) {
@@ -317,7 +317,7 @@ func TestConnectMessageDecode4(t *testing.T) {
 	}
 
 	_, _, err := Decode(ProtocolV311, buf)
-	require.EqualError(t, err, CodeProtocolError.Error())
+	requireErrorIs(t, err, CodeProtocolError)
 
 	// extra bytes
 	buf = []byte{
@@ -349,7 +349,7 @@ func TestConnectMessageDecode4(t *testing.T) {
 	}
 
 	_, _, err = Decode(ProtocolV311, buf)
-	require.EqualError(t, err, CodeProtocolError.Error())
+	requireErrorIs(t, err, CodeProtocolError)
 
 	// extra bytes
 	buf = []byte{
@@ -381,7 +381,7 @@ func TestConnectMessageDecode4(t *testing.T) {
 	}
 
 	_, _, err = Decode(ProtocolV50, buf)
-	require.EqualError(t, err, CodeProtocolError.Error())
+	requireErrorIs(t, err, CodeProtocolError)
 
 }
 
@@ -0,0 +1,381 @@
+package content
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"math"
+	"strconv"
+	"unicode/utf8"
+)
+
+// nolint: golint
+var ErrInvalidCBOR = errors.New("content: invalid CBOR")
+
+// maxCBORDepth limits nesting of arrays, maps and tags
+const maxCBORDepth = 128
+
+const (
+	cborUint byte = iota
+	cborNegInt
+	cborBytes
+	cborText
+	cborArray
+	cborMap
+	cborTag
+	cborSimple
+)
+
+const (
+	cborIndefinite byte = 31
+	cborBreak      byte = 0xFF
+)
+
+type cborHandler struct{}
+
+// CBOR handler, payload must be single well-formed data item.
+// It is formatted in diagnostic notation of RFC 8949 section 8
+func CBOR() Handler {
+	return cborHandler{}
+}
+
+func (cborHandler) Validate(payload []byte) error {
+	d := cborDecoder{data: payload}
+	return d.decodeAll()
+}
+
+func (cborHandler) Format(payload []byte) ([]byte, error) {
+	d := cborDecoder{
+		data: payload,
+		out:  &bytes.Buffer{},
+	}
+
+	if err := d.decodeAll(); err != nil {
+		return nil, err
+	}
+
+	return d.out.Bytes(), nil
+}
+
+// cborDecoder checks well-formedness and renders diagnostic notation if out is set
+type cborDecoder struct {
+	data  []byte
+	off   int
+	depth int
+	out   *bytes.Buffer
+}
+
+func (d *cborDecoder) write(s string) {
+	if d.out != nil {
+		d.out.WriteString(s)
+	}
+}
+
+func (d *cborDecoder) decodeAll() error {
+	if err := d.item(); err != nil {
+		return err
+	}
+
+	if d.off != len(d.data) {
+		return ErrInvalidCBOR
+	}
+
+	return nil
+}
+
+// head reads initial byte and argument of data item
+func (d *cborDecoder) head() (byte, byte, uint64, error) {
+	if d.off >= len(d.data) {
+		return 0, 0, 0, ErrInvalidCBOR
+	}
+
+	ib := d.data[d.off]
+	d.off++
+
+	major := ib >> 5
+	info := ib & 0x1F
+
+	var size int
+
+	switch {
+	case info < 24:
+		return major, info, uint64(info), nil
+	case info == 24:
+		size = 1
+	case info == 25:
+		size = 2
+	case info == 26:
+		size = 4
+	case info == 27:
+		size = 8
+	case info == cborIndefinite:
+		return major, info, 0, nil
+	default:
+		// reserved additional information
+		return 0, 0, 0, ErrInvalidCBOR
+	}
+
+	if len(d.data)-d.off < size {
+		return 0, 0, 0, ErrInvalidCBOR
+	}
+
+	var val uint64
+	for _, b := range d.data[d.off : d.off+size] {
+		val = val<<8 | uint64(b)
+	}
+
+	d.off += size
+
+	return major, info, val, nil
+}
+
+func (d *cborDecoder) item() error {
+	d.depth++
+	defer func() { d.depth-- }()
+
+	if d.depth > maxCBORDepth {
+		return ErrInvalidCBOR
+	}
+
+	start := d.off
+
+	major, info, val, err := d.head()
+	if err != nil {
+		return err
+	}
+
+	if info == cborIndefinite {
+		return d.indefinite(major)
+	}
+
+	switch major {
+	case cborUint:
+		d.write(strconv.FormatUint(val, 10))
+	case cborNegInt:
+		if val == math.MaxUint64 {
+			d.write("-18446744073709551616")
+		} else {
+			d.write("-" + strconv.FormatUint(val+1, 10))
+		}
+	case cborBytes, cborText:
+		return d.str(major, val)
+	case cborArray:
+		d.write("[")
+		if err = d.items(val, false); err != nil {
+			return err
+		}
+		d.write("]")
+	case cborMap:
+		d.write("{")
+		if err = d.items(val, true); err != nil {
+			return err
+		}
+		d.write("}")
+	case cborTag:
+		d.write(strconv.FormatUint(val, 10) + "(")
+		if err = d.item(); err != nil {
+			return err
+		}
+		d.write(")")
+	case cborSimple:
+		return d.simple(info, val, d.data[start+1:d.off])
+	}
+
+	return nil
+}
+
+// items of definite length array or map
+func (d *cborDecoder) items(count uint64, pairs bool) error {
+	// each item takes at least one byte
+	if count > uint64(len(d.data)-d.off) {
+		return ErrInvalidCBOR
+	}
+
+	for i := uint64(0); i < count; i++ {
+		if i > 0 {
+			d.write(", ")
+		}
+
+		if err := d.item(); err != nil {
+			return err
+		}
+
+		if pairs {
+			d.write(": ")
+
+			if err := d.item(); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (d *cborDecoder) str(major byte, size uint64) error {
+	if size > uint64(len(d.data)-d.off) {
+		return ErrInvalidCBOR
+	}
+
+	val := d.data[d.off : d.off+int(size)]
+	d.off += int(size)
+
+	if major == cborText {
+		if !utf8.Valid(val) {
+			return ErrInvalidCBOR
+		}
+
+		d.write(strconv.Quote(string(val)))
+	} else {
+		d.write("h'" + hex.EncodeToString(val) + "'")
+	}
+
+	return nil
+}
+
+func (d *cborDecoder) indefinite(major byte) error {
+	switch major {
+	case cborBytes, cborText:
+		d.write("(_ ")
+	case cborArray:
+		d.write("[_ ")
+	case cborMap:
+		d.write("{_ ")
+	default:
+		// break outside of indefinite length item or indefinite integer/tag
+		return ErrInvalidCBOR
+	}
+
+	for i := 0; ; i++ {
+		if d.off >= len(d.data) {
+			return ErrInvalidCBOR
+		}
+
+		if d.data[d.off] == cborBreak {
+			d.off++
+			break
+		}
+
+		if i > 0 {
+			d.write(", ")
+		}
+
+		switch major {
+		case cborBytes, cborText:
+			// chunks are definite length strings of the same major type
+			chunk, info, size, err := d.head()
+			if err != nil {
+				return err
+			}
+
+			if chunk != major || info == cborIndefinite {
+				return ErrInvalidCBOR
+			}
+
+			if err = d.str(major, size); err != nil {
+				return err
+			}
+		case cborArray:
+			if err := d.item(); err != nil {
+				return err
+			}
+		case cborMap:
+			if err := d.item(); err != nil {
+				return err
+			}
+
+			d.write(": ")
+
+			if err := d.item(); err != nil {
+				return err
+			}
+		}
+	}
+
+	switch major {
+	case cborBytes, cborText:
+		d.write(")")
+	case cborArray:
+		d.write("]")
+	case cborMap:
+		d.write("}")
+	}
+
+	return nil
+}
+
+func (d *cborDecoder) simple(info byte, val uint64, raw []byte) error {
+	switch info {
+	case 20:
+		d.write("false")
+	case 21:
+		d.write("true")
+	case 22:
+		d.write("null")
+	case 23:
+		d.write("undefined")
+	case 24:
+		// two byte encoding of simple values below 32 is not well-formed
+		if val < 32 {
+			return ErrInvalidCBOR
+		}
+
+		d.write("simple(" + strconv.FormatUint(val, 10) + ")")
+	case 25:
+		d.float(halfToFloat(binary.BigEndian.Uint16(raw)))
+	case 26:
+		d.float(float64(math.Float32frombits(binary.BigEndian.Uint32(raw))))
+	case 27:
+		d.float(math.Float64frombits(binary.BigEndian.Uint64(raw)))
+	default:
+		d.write("simple(" + strconv.FormatUint(val, 10) + ")")
+	}
+
+	return nil
+}
+
+func (d *cborDecoder) float(f float64) {
+	switch {
+	case math.IsNaN(f):
+		d.write("NaN")
+	case math.IsInf(f, 1):
+		d.write("Infinity")
+	case math.IsInf(f, -1):
+		d.write("-Infinity")
+	default:
+		s := strconv.FormatFloat(f, 'g', -1, 64)
+		if !bytes.ContainsAny([]byte(s), ".eE") {
+			s += ".0"
+		}
+
+		d.write(s)
+	}
+}
+
+// halfToFloat converts IEEE 754 half precision value
+func halfToFloat(h uint16) float64 {
+	exp := int(h>>10) & 0x1F
+	mant := float64(h & 0x3FF)
+
+	var val float64
+
+	switch exp {
+	case 0:
+		val = math.Ldexp(mant, -24)
+	case 31:
+		if mant == 0 {
+			val = math.Inf(1)
+		} else {
+			val = math.NaN()
+		}
+	default:
+		val = math.Ldexp(mant+1024, exp-25)
+	}
+
+	if h&0x8000 != 0 {
+		return -val
+	}
+
+	return val
+}
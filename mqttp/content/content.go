@@ -0,0 +1,191 @@
+// Package content validates and pretty-prints PUBLISH payloads according to
+// their Content Type property.
+//
+// Handlers are kept in a Registry keyed by media type. Parameters of content type
+// such as charset are ignored during lookup, thus "application/json; charset=utf-8"
+// is handled by handler registered for "application/json".
+// Built-in handlers do not need schema: JSON, CBOR (RFC 8949) and protobuf wire format.
+package content
+
+import (
+	"errors"
+	"fmt"
+	"mime"
+	"strings"
+	"sync"
+
+	"github.com/VolantMQ/vlapi/mqttp"
+)
+
+// Well-known content types handled by default registry
+const (
+	TypeJSON     = "application/json"
+	TypeCBOR     = "application/cbor"
+	TypeProtobuf = "application/x-protobuf"
+)
+
+// nolint: golint
+var (
+	ErrUnknownContentType = errors.New("content: unknown content type")
+	ErrInvalidContentType = errors.New("content: invalid content type")
+	ErrNilHandler         = errors.New("content: handler is nil")
+)
+
+// Handler of payloads of particular content type
+type Handler interface {
+	// Validate payload is well-formed
+	Validate(payload []byte) error
+
+	// Format payload into human readable form
+	Format(payload []byte) ([]byte, error)
+}
+
+// Error payload does not match its content type
+// errors.Is(err, mqttp.CodeInvalidPayloadFormat) reports true thus it can be
+// used as reason code directly
+type Error struct {
+	// ContentType of the payload
+	ContentType string
+	// Err returned by handler
+	Err error
+}
+
+var _ error = (*Error)(nil)
+
+// Error description
+func (e *Error) Error() string {
+	return fmt.Sprintf("content: invalid %s payload: %s", e.ContentType, e.Err.Error())
+}
+
+// Unwrap returns error reported by handler
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Is reports payload format violation
+func (e *Error) Is(target error) bool {
+	return target == mqttp.CodeInvalidPayloadFormat
+}
+
+// Registry of content type handlers
+type Registry struct {
+	lock     sync.RWMutex
+	handlers map[string]Handler
+}
+
+// NewRegistry allocate empty registry
+func NewRegistry() *Registry {
+	return &Registry{
+		handlers: make(map[string]Handler),
+	}
+}
+
+// NewDefaultRegistry allocate registry with JSON, CBOR and protobuf handlers
+func NewDefaultRegistry() *Registry {
+	r := NewRegistry()
+
+	_ = r.Register(TypeJSON, JSON())
+	_ = r.Register(TypeCBOR, CBOR())
+	_ = r.Register(TypeProtobuf, Protobuf())
+
+	return r
+}
+
+// Register handler for content type replacing existing one if any
+func (r *Registry) Register(contentType string, h Handler) error {
+	if h == nil {
+		return ErrNilHandler
+	}
+
+	mt, err := mediaType(contentType)
+	if err != nil {
+		return err
+	}
+
+	r.lock.Lock()
+	r.handlers[mt] = h
+	r.lock.Unlock()
+
+	return nil
+}
+
+// Unregister handler of content type
+func (r *Registry) Unregister(contentType string) {
+	mt, err := mediaType(contentType)
+	if err != nil {
+		return
+	}
+
+	r.lock.Lock()
+	delete(r.handlers, mt)
+	r.lock.Unlock()
+}
+
+// Lookup handler of content type
+func (r *Registry) Lookup(contentType string) (Handler, bool) {
+	mt, err := mediaType(contentType)
+	if err != nil {
+		return nil, false
+	}
+
+	r.lock.RLock()
+	h, ok := r.handlers[mt]
+	r.lock.RUnlock()
+
+	return h, ok
+}
+
+// Validate payload of PUBLISH against Payload Format Indicator and handler of
+// its Content Type if registered. Payloads of unknown or absent content type are accepted
+func (r *Registry) Validate(p *mqttp.Publish) error {
+	if err := p.ValidatePayloadFormat(); err != nil {
+		return err
+	}
+
+	ct, ok := p.ContentType()
+	if !ok {
+		return nil
+	}
+
+	h, ok := r.Lookup(ct)
+	if !ok {
+		return nil
+	}
+
+	if err := h.Validate(p.Payload()); err != nil {
+		return &Error{ContentType: ct, Err: err}
+	}
+
+	return nil
+}
+
+// Format payload of PUBLISH with handler of its Content Type
+// returns ErrUnknownContentType if content type is absent or has no handler
+func (r *Registry) Format(p *mqttp.Publish) ([]byte, error) {
+	ct, ok := p.ContentType()
+	if !ok {
+		return nil, ErrUnknownContentType
+	}
+
+	h, ok := r.Lookup(ct)
+	if !ok {
+		return nil, ErrUnknownContentType
+	}
+
+	res, err := h.Format(p.Payload())
+	if err != nil {
+		return nil, &Error{ContentType: ct, Err: err}
+	}
+
+	return res, nil
+}
+
+// mediaType of content type without parameters, in lower case
+func mediaType(contentType string) (string, error) {
+	mt, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return "", ErrInvalidContentType
+	}
+
+	return strings.ToLower(mt), nil
+}
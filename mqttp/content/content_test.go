@@ -0,0 +1,162 @@
+package content
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/VolantMQ/vlapi/mqttp"
+)
+
+func newPublish(t *testing.T, contentType string, payload []byte) *mqttp.Publish {
+	p := mqttp.NewPublish(mqttp.ProtocolV50)
+	require.NoError(t, p.Set("a/b", payload, mqttp.QoS0, false, false))
+
+	if contentType != "" {
+		require.NoError(t, p.SetContentType(contentType))
+	}
+
+	return p
+}
+
+func TestRegistry(t *testing.T) {
+	r := NewDefaultRegistry()
+
+	_, ok := r.Lookup("Application/JSON; charset=utf-8")
+	require.True(t, ok)
+
+	require.NoError(t, r.Validate(newPublish(t, TypeJSON, []byte(`{"a":[1,2]}`))))
+	require.NoError(t, r.Validate(newPublish(t, "text/plain", []byte{0xff})))
+	require.NoError(t, r.Validate(newPublish(t, "", []byte{0xff})))
+
+	err := r.Validate(newPublish(t, TypeJSON+"; charset=utf-8", []byte(`{"a":`)))
+	require.True(t, errors.Is(err, mqttp.CodeInvalidPayloadFormat))
+	require.True(t, errors.Is(err, ErrInvalidJSON))
+
+	var cErr *Error
+	require.True(t, errors.As(err, &cErr))
+	require.Equal(t, TypeJSON+"; charset=utf-8", cErr.ContentType)
+
+	// payload format indicator is checked regardless of content type
+	p := newPublish(t, "", []byte{0xff})
+	require.NoError(t, p.SetPayloadFormat(mqttp.PayloadFormatUTF8))
+	require.Equal(t, mqttp.CodeInvalidPayloadFormat, r.Validate(p))
+
+	res, err := r.Format(newPublish(t, TypeJSON, []byte(`{"a":[1,2]}`)))
+	require.NoError(t, err)
+	require.Equal(t, "{\n  \"a\": [\n    1,\n    2\n  ]\n}", string(res))
+
+	_, err = r.Format(newPublish(t, "text/plain", nil))
+	require.Equal(t, ErrUnknownContentType, err)
+
+	r.Unregister(TypeJSON)
+	require.NoError(t, r.Validate(newPublish(t, TypeJSON, []byte(`{"a":`))))
+
+	require.Equal(t, ErrNilHandler, r.Register(TypeJSON, nil))
+	require.Equal(t, ErrInvalidContentType, r.Register("", JSON()))
+}
+
+func TestCBOR(t *testing.T) {
+	h := CBOR()
+
+	for _, tc := range []struct {
+		data []byte
+		diag string
+	}{
+		{[]byte{0x00}, "0"},
+		{[]byte{0x18, 0x64}, "100"},
+		{[]byte{0x3b, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}, "-18446744073709551616"},
+		{[]byte{0x29}, "-10"},
+		{[]byte{0x44, 0x01, 0x02, 0x03, 0x04}, "h'01020304'"},
+		{[]byte{0x62, 0xc3, 0xbc}, `"ü"`},
+		{[]byte{0x83, 0x01, 0x82, 0x02, 0x03, 0x82, 0x04, 0x05}, "[1, [2, 3], [4, 5]]"},
+		{[]byte{0xa2, 0x61, 0x61, 0x01, 0x61, 0x62, 0x82, 0x02, 0x03}, `{"a": 1, "b": [2, 3]}`},
+		{[]byte{0x9f, 0x01, 0x02, 0xff}, "[_ 1, 2]"},
+		{[]byte{0xbf, 0x61, 0x61, 0xf5, 0xff}, `{_ "a": true}`},
+		{[]byte{0x7f, 0x61, 0x61, 0x61, 0x62, 0xff}, `(_ "a", "b")`},
+		{[]byte{0xc1, 0x1a, 0x51, 0x4b, 0x67, 0xb0}, "1(1363896240)"},
+		{[]byte{0xf9, 0x3c, 0x00}, "1.0"},
+		{[]byte{0xf9, 0x7c, 0x00}, "Infinity"},
+		{[]byte{0xfa, 0x47, 0xc3, 0x50, 0x00}, "100000.0"},
+		{[]byte{0xfb, 0x3f, 0xf1, 0x99, 0x99, 0x99, 0x99, 0x99, 0x9a}, "1.1"},
+		{[]byte{0xf4}, "false"},
+		{[]byte{0xf6}, "null"},
+		{[]byte{0xf8, 0xff}, "simple(255)"},
+	} {
+		require.NoError(t, h.Validate(tc.data), tc.diag)
+
+		res, err := h.Format(tc.data)
+		require.NoError(t, err, tc.diag)
+		require.Equal(t, tc.diag, string(res))
+	}
+
+	for _, data := range [][]byte{
+		{},
+		{0x00, 0x00},             // trailing data
+		{0x1c},                   // reserved additional information
+		{0x18},                   // missing argument
+		{0x44, 0x01},             // short byte string
+		{0x62, 0xff, 0xfe},       // invalid UTF-8
+		{0x82, 0x01},             // short array
+		{0xff},                   // break outside indefinite item
+		{0x9f, 0x01},             // missing break
+		{0x5f, 0x61, 0x61, 0xff}, // text chunk in byte string
+		{0x1f},                   // indefinite integer
+		{0xf8, 0x10},             // two byte simple value below 32
+		{0xa1, 0x01},             // map without value
+	} {
+		require.Equal(t, ErrInvalidCBOR, h.Validate(data), "%x", data)
+	}
+
+	deep := make([]byte, maxCBORDepth+1)
+	for i := range deep {
+		deep[i] = 0x81
+	}
+	require.Equal(t, ErrInvalidCBOR, h.Validate(append(deep, 0x00)))
+}
+
+func TestProtobuf(t *testing.T) {
+	h := Protobuf()
+
+	// 1: 150, 2: "testing", 3 { 1: 1 }, 4: fixed32, 5: fixed64, 6: group { 1: 2 }
+	data := []byte{
+		0x08, 0x96, 0x01,
+		0x12, 0x07, 't', 'e', 's', 't', 'i', 'n', 'g',
+		0x1a, 0x02, 0x08, 0x01,
+		0x25, 0x01, 0x00, 0x00, 0x00,
+		0x29, 0x02, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+		0x33, 0x08, 0x02, 0x34,
+	}
+
+	require.NoError(t, h.Validate(data))
+
+	res, err := h.Format(data)
+	require.NoError(t, err)
+	require.Equal(t, `1: 150
+2: "testing"
+3 {
+  1: 1
+}
+4: 0x00000001
+5: 0x0000000000000002
+6 {
+  1: 2
+}
+`, string(res))
+
+	for _, data := range [][]byte{
+		{0x08},             // missing varint
+		{0x00, 0x01},       // field number 0
+		{0x12, 0x05, 0x01}, // short length-delimited
+		{0x25, 0x01},       // short fixed32
+		{0x0e, 0x01},       // invalid wire type
+		{0x33, 0x08, 0x02}, // unterminated group
+		{0x34},             // end group without start
+		{0x33, 0x3c},       // mismatched end group
+	} {
+		require.Equal(t, ErrInvalidProtobuf, h.Validate(data), "%x", data)
+	}
+
+	require.NoError(t, h.Validate(nil))
+}
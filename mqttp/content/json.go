@@ -0,0 +1,35 @@
+package content
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+)
+
+// nolint: golint
+var ErrInvalidJSON = errors.New("content: invalid JSON")
+
+type jsonHandler struct{}
+
+// JSON handler, payload is formatted with two spaces indent
+func JSON() Handler {
+	return jsonHandler{}
+}
+
+func (jsonHandler) Validate(payload []byte) error {
+	if !json.Valid(payload) {
+		return ErrInvalidJSON
+	}
+
+	return nil
+}
+
+func (jsonHandler) Format(payload []byte) ([]byte, error) {
+	var buf bytes.Buffer
+
+	if err := json.Indent(&buf, payload, "", "  "); err != nil {
+		return nil, ErrInvalidJSON
+	}
+
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,186 @@
+package content
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// nolint: golint
+var ErrInvalidProtobuf = errors.New("content: invalid protobuf")
+
+// maxProtobufDepth limits nesting of groups and of messages guessed while formatting
+const maxProtobufDepth = 64
+
+const (
+	wireVarint     = 0
+	wireFixed64    = 1
+	wireBytes      = 2
+	wireStartGroup = 3
+	wireEndGroup   = 4
+	wireFixed32    = 5
+)
+
+type protobufHandler struct{}
+
+// Protobuf handler, payload must be well-formed protobuf wire format.
+// Schema is not known thus payload is formatted as field numbers with raw values,
+// the same way as protoc --decode_raw does
+func Protobuf() Handler {
+	return protobufHandler{}
+}
+
+func (protobufHandler) Validate(payload []byte) error {
+	p := protobufDecoder{}
+	return p.message(payload, 0)
+}
+
+func (protobufHandler) Format(payload []byte) ([]byte, error) {
+	p := protobufDecoder{
+		out: &bytes.Buffer{},
+	}
+
+	if err := p.message(payload, 0); err != nil {
+		return nil, err
+	}
+
+	return p.out.Bytes(), nil
+}
+
+// protobufDecoder checks wire format and renders fields if out is set
+type protobufDecoder struct {
+	out *bytes.Buffer
+}
+
+func (p *protobufDecoder) line(indent int, format string, args ...interface{}) {
+	if p.out != nil {
+		p.out.WriteString(strings.Repeat("  ", indent))
+		fmt.Fprintf(p.out, format, args...)
+		p.out.WriteByte('\n')
+	}
+}
+
+// message decodes data as whole message
+func (p *protobufDecoder) message(data []byte, depth int) error {
+	n, err := p.fields(data, 0, depth)
+	if err != nil {
+		return err
+	}
+
+	if n != len(data) {
+		return ErrInvalidProtobuf
+	}
+
+	return nil
+}
+
+// fields decodes fields until end of data or end of group if group is not 0
+// returns number of bytes consumed
+func (p *protobufDecoder) fields(data []byte, group uint64, depth int) (int, error) {
+	if depth > maxProtobufDepth {
+		return 0, ErrInvalidProtobuf
+	}
+
+	off := 0
+
+	for off < len(data) {
+		key, n := binary.Uvarint(data[off:])
+		if n <= 0 {
+			return off, ErrInvalidProtobuf
+		}
+		off += n
+
+		field := key >> 3
+		if field == 0 || field > 1<<29-1 {
+			return off, ErrInvalidProtobuf
+		}
+
+		switch key & 0x7 {
+		case wireVarint:
+			val, n := binary.Uvarint(data[off:])
+			if n <= 0 {
+				return off, ErrInvalidProtobuf
+			}
+			off += n
+
+			p.line(depth, "%d: %d", field, val)
+		case wireFixed64:
+			if len(data)-off < 8 {
+				return off, ErrInvalidProtobuf
+			}
+
+			p.line(depth, "%d: 0x%016x", field, binary.LittleEndian.Uint64(data[off:]))
+			off += 8
+		case wireFixed32:
+			if len(data)-off < 4 {
+				return off, ErrInvalidProtobuf
+			}
+
+			p.line(depth, "%d: 0x%08x", field, binary.LittleEndian.Uint32(data[off:]))
+			off += 4
+		case wireBytes:
+			size, n := binary.Uvarint(data[off:])
+			if n <= 0 || size > uint64(len(data)-off-n) {
+				return off, ErrInvalidProtobuf
+			}
+			off += n
+
+			p.bytes(field, data[off:off+int(size)], depth)
+			off += int(size)
+		case wireStartGroup:
+			p.line(depth, "%d {", field)
+
+			n, err := p.fields(data[off:], field, depth+1)
+			off += n
+			if err != nil {
+				return off, err
+			}
+
+			p.line(depth, "}")
+		case wireEndGroup:
+			if field != group {
+				return off, ErrInvalidProtobuf
+			}
+
+			return off, nil
+		default:
+			return off, ErrInvalidProtobuf
+		}
+	}
+
+	// group has not been closed
+	if group != 0 {
+		return off, ErrInvalidProtobuf
+	}
+
+	return off, nil
+}
+
+// bytes renders length-delimited field as nested message if it parses as one,
+// as string if it is valid UTF-8 and as escaped bytes otherwise
+func (p *protobufDecoder) bytes(field uint64, val []byte, depth int) {
+	if p.out == nil {
+		return
+	}
+
+	if len(val) > 0 {
+		nested := protobufDecoder{}
+		if nested.message(val, depth+1) == nil {
+			p.line(depth, "%d {", field)
+			_ = p.message(val, depth+1)
+			p.line(depth, "}")
+
+			return
+		}
+	}
+
+	if utf8.Valid(val) {
+		p.line(depth, "%d: %s", field, strconv.Quote(string(val)))
+	} else {
+		p.line(depth, "%d: %q", field, val)
+	}
+}
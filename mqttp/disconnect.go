@@ -133,3 +133,8 @@ func (msg *Disconnect) size() int {
 
 	return total
 }
+
+func (msg *Disconnect) reset() {
+	msg.resetHeader()
+	msg.reasonCode = CodeSuccess
+}
@@ -42,10 +42,10 @@ func TestDisconnectMessageDecode(t *testing.T) {
 	}
 
 	_, _, err = Decode(ProtocolV50, buf)
-	require.EqualError(t, err, CodeMalformedPacket.Error())
+	requireErrorIs(t, err, CodeMalformedPacket)
 
 	_, _, err = Decode(ProtocolV311, buf)
-	require.EqualError(t, err, CodeMalformedPacket.Error())
+	requireErrorIs(t, err, CodeMalformedPacket)
 }
 
 func TestDisconnectMessageEncode(t *testing.T) {
@@ -1,5 +1,9 @@
 package mqttp
 
+import (
+	"fmt"
+)
+
 // Error errors
 type Error byte
 
@@ -51,6 +55,8 @@ const (
 	ErrInvalidUtf8
 	ErrNotSupported
 	ErrProtocolInvalidName
+	// ErrPacketIDExhausted all packet IDs are in use
+	ErrPacketIDExhausted
 )
 
 // Error returns the corresponding error string for the ConnAckCode
@@ -102,7 +108,94 @@ func (e Error) Error() string {
 		return "String is not UTF8"
 	case ErrInvalidProtocolVersion:
 		return "Invalid protocol name"
+	case ErrInvalid:
+		return "Invalid value"
+	case ErrNotSet:
+		return "Value not set"
+	case ErrPanicDetected:
+		return "Panic detected"
+	case ErrNotSupported:
+		return "Not supported"
+	case ErrProtocolInvalidName:
+		return "Invalid protocol name"
+	case ErrPacketIDExhausted:
+		return "All packet IDs are in use"
 	}
 
 	return "Unknown error"
 }
+
+// DecodeError describes failure of the packet decode
+// It wraps reason of the failure thus errors.Is(err, CodeMalformedPacket) or
+// errors.As(err, &code) can be used to get ReasonCode to reply with
+type DecodeError struct {
+	// Err reason of the failure. Usually ReasonCode or Error
+	Err error
+	// Rule normative statement violated by the packet, e.g. "MQTT-2.2.2-1"
+	// empty if not known
+	Rule string
+	// Offset of the byte within packet at which decode failed
+	Offset int
+	// Type of the packet, RESERVED if failed before type has been decoded
+	Type Type
+}
+
+var _ error = (*DecodeError)(nil)
+
+// Error description of the decode failure
+func (e *DecodeError) Error() string {
+	str := fmt.Sprintf("mqttp: decode %s at offset %d: %s", e.Type.Name(), e.Offset, e.Err.Error())
+	if e.Rule != "" {
+		str += " [" + e.Rule + "]"
+	}
+
+	return str
+}
+
+// Unwrap returns reason of the failure
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// ruleError annotates error with normative statement it has been caused by
+type ruleError struct {
+	err  error
+	rule string
+}
+
+func (e *ruleError) Error() string {
+	return e.err.Error()
+}
+
+func (e *ruleError) Unwrap() error {
+	return e.err
+}
+
+// violation annotates err with normative statement from the spec
+func violation(err error, rule string) error {
+	return &ruleError{err: err, rule: rule}
+}
+
+// withRule returns err annotated with normative statement of cause if any
+func withRule(err error, cause error) error {
+	if r, ok := cause.(*ruleError); ok {
+		return violation(err, r.rule)
+	}
+
+	return err
+}
+
+func newDecodeError(t Type, offset int, err error) *DecodeError {
+	e := &DecodeError{
+		Err:    err,
+		Offset: offset,
+		Type:   t,
+	}
+
+	if r, ok := err.(*ruleError); ok {
+		e.Err = r.err
+		e.Rule = r.rule
+	}
+
+	return e
+}
@@ -0,0 +1,299 @@
+package mqttp
+
+import (
+	"context"
+	"sync"
+)
+
+// DefaultReceiveMaximum Receive Maximum used when property is absent [MQTT-3.1.2.11.3]
+const DefaultReceiveMaximum = 65535
+
+// QuotaCounter receives number of in-flight packets changes
+// *vlmonitoring.Max implements it thus FlowControl can feed
+// vlmonitoring.Packets.UnAckSent and vlmonitoring.Packets.UnAckRecv
+type QuotaCounter interface {
+	AddU64(n uint64)
+	SubU64(n uint64)
+}
+
+// FlowControl tracks in-flight QoS 1 and QoS 2 PUBLISH packets of single connection
+// as per [MQTT-4.9]. Send quota is bounded by Receive Maximum announced by the peer,
+// receive quota by Receive Maximum announced to the peer
+// Quota is taken by PUBLISH packet and returned when
+//
+//	PUBACK is sent or received
+//	PUBCOMP is sent or received
+//	PUBREC with Reason Code 0x80 or greater is sent or received
+type FlowControl struct {
+	send flowQuota
+	recv flowQuota
+}
+
+type flowQuota struct {
+	lock    sync.Mutex
+	ids     map[IDType]struct{}
+	signal  chan struct{}
+	counter QuotaCounter
+	max     uint16
+}
+
+// NewFlowControl allocate flow control of connection
+// send is Receive Maximum of the peer, recv is Receive Maximum of this side
+// 0 means property is absent and DefaultReceiveMaximum is used
+func NewFlowControl(send, recv uint16) *FlowControl {
+	f := &FlowControl{}
+
+	f.send.init(send)
+	f.recv.init(recv)
+
+	return f
+}
+
+// SetCounters set counters of in-flight packets in each direction, nil disables counter
+func (f *FlowControl) SetCounters(send, recv QuotaCounter) {
+	f.send.setCounter(send)
+	f.recv.setCounter(recv)
+}
+
+// SetSendMaximum update Receive Maximum of the peer, e.g. once CONNACK received
+// packets in-flight are not affected, thus quota might stay exhausted until they are acknowledged
+func (f *FlowControl) SetSendMaximum(v uint16) {
+	f.send.setMax(v)
+}
+
+// SendMaximum Receive Maximum of the peer
+func (f *FlowControl) SendMaximum() uint16 {
+	return f.send.getMax()
+}
+
+// RecvMaximum Receive Maximum of this side
+func (f *FlowControl) RecvMaximum() uint16 {
+	return f.recv.getMax()
+}
+
+// InFlight number of unacknowledged packets sent and received
+func (f *FlowControl) InFlight() (int, int) {
+	return f.send.len(), f.recv.len()
+}
+
+// Acquire send quota for PUBLISH packet, blocks until quota available or ctx done
+// QoS 0 packets do not take quota. Returns CodePacketIDInUse if packet with same id
+// is already in-flight
+func (f *FlowControl) Acquire(ctx context.Context, p *Publish) error {
+	id, ok, err := flowID(p)
+	if !ok {
+		return err
+	}
+
+	return f.send.acquire(ctx, id)
+}
+
+// TryAcquire send quota for PUBLISH packet without blocking
+// Returns CodeReceiveMaximumExceeded when peer Receive Maximum reached [MQTT-3.3.4-7]
+func (f *FlowControl) TryAcquire(p *Publish) error {
+	id, ok, err := flowID(p)
+	if !ok {
+		return err
+	}
+
+	return f.send.tryAcquire(id)
+}
+
+// Received take receive quota by inbound PUBLISH packet
+// Redelivery of packet already in-flight does not take quota again.
+// Returns CodeReceiveMaximumExceeded if peer has sent more packets than Receive Maximum allows,
+// connection must be closed with DISCONNECT carrying this code
+func (f *FlowControl) Received(p *Publish) error {
+	id, ok, err := flowID(p)
+	if !ok {
+		return err
+	}
+
+	if err = f.recv.tryAcquire(id); err == CodePacketIDInUse {
+		return nil
+	}
+
+	return err
+}
+
+// AckReceived return send quota once acknowledgment received from the peer
+// returns true if quota has been returned
+func (f *FlowControl) AckReceived(p IFace) bool {
+	return f.send.release(p)
+}
+
+// AckSent return receive quota once acknowledgment sent to the peer
+// returns true if quota has been returned
+func (f *FlowControl) AckSent(p IFace) bool {
+	return f.recv.release(p)
+}
+
+// Reset drop all in-flight packets and wake up blocked senders, e.g. on reconnect
+func (f *FlowControl) Reset() {
+	f.send.reset()
+	f.recv.reset()
+}
+
+// flowID packet id of PUBLISH if it takes quota
+func flowID(p *Publish) (IDType, bool, error) {
+	if p.QoS() == QoS0 {
+		return 0, false, nil
+	}
+
+	id, err := p.ID()
+	if err != nil {
+		return 0, false, err
+	}
+
+	return id, true, nil
+}
+
+// releasesQuota checks if acknowledgment completes PUBLISH flow
+func releasesQuota(p IFace) (IDType, bool) {
+	switch p.Type() {
+	case PUBACK, PUBCOMP:
+	case PUBREC:
+		if ack, ok := p.(*Ack); !ok || ack.Reason() < CodeUnspecifiedError {
+			return 0, false
+		}
+	default:
+		return 0, false
+	}
+
+	id, err := p.ID()
+	if err != nil {
+		return 0, false
+	}
+
+	return id, true
+}
+
+func (q *flowQuota) init(max uint16) {
+	if max == 0 {
+		max = DefaultReceiveMaximum
+	}
+
+	q.ids = make(map[IDType]struct{})
+	q.signal = make(chan struct{})
+	q.max = max
+}
+
+func (q *flowQuota) setCounter(c QuotaCounter) {
+	q.lock.Lock()
+	q.counter = c
+	q.lock.Unlock()
+}
+
+func (q *flowQuota) setMax(max uint16) {
+	if max == 0 {
+		max = DefaultReceiveMaximum
+	}
+
+	q.lock.Lock()
+	q.max = max
+	q.notify()
+	q.lock.Unlock()
+}
+
+func (q *flowQuota) getMax() uint16 {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	return q.max
+}
+
+func (q *flowQuota) len() int {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	return len(q.ids)
+}
+
+func (q *flowQuota) acquire(ctx context.Context, id IDType) error {
+	for {
+		q.lock.Lock()
+		err := q.tryAcquireLocked(id)
+		signal := q.signal
+		q.lock.Unlock()
+
+		if err != CodeReceiveMaximumExceeded {
+			return err
+		}
+
+		select {
+		case <-signal:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (q *flowQuota) tryAcquire(id IDType) error {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	return q.tryAcquireLocked(id)
+}
+
+func (q *flowQuota) tryAcquireLocked(id IDType) error {
+	if _, ok := q.ids[id]; ok {
+		return CodePacketIDInUse
+	}
+
+	if len(q.ids) >= int(q.max) {
+		return CodeReceiveMaximumExceeded
+	}
+
+	q.ids[id] = struct{}{}
+
+	if q.counter != nil {
+		q.counter.AddU64(1)
+	}
+
+	return nil
+}
+
+func (q *flowQuota) release(p IFace) bool {
+	id, ok := releasesQuota(p)
+	if !ok {
+		return false
+	}
+
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	if _, ok = q.ids[id]; !ok {
+		return false
+	}
+
+	delete(q.ids, id)
+
+	if q.counter != nil {
+		q.counter.SubU64(1)
+	}
+
+	q.notify()
+
+	return true
+}
+
+func (q *flowQuota) reset() {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	if q.counter != nil && len(q.ids) > 0 {
+		q.counter.SubU64(uint64(len(q.ids)))
+	}
+
+	for id := range q.ids {
+		delete(q.ids, id)
+	}
+
+	q.notify()
+}
+
+// notify wake up blocked acquires, must be called with lock held
+func (q *flowQuota) notify() {
+	close(q.signal)
+	q.signal = make(chan struct{})
+}
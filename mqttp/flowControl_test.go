@@ -0,0 +1,156 @@
+package mqttp
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type testQuotaCounter struct {
+	val int64
+}
+
+func (c *testQuotaCounter) AddU64(n uint64) {
+	atomic.AddInt64(&c.val, int64(n))
+}
+
+func (c *testQuotaCounter) SubU64(n uint64) {
+	atomic.AddInt64(&c.val, -int64(n))
+}
+
+func newFlowPublish(t *testing.T, q QosType, id IDType) *Publish {
+	p := NewPublish(ProtocolV50)
+	require.NoError(t, p.Set("a", []byte("data"), q, false, false))
+	if q != QoS0 {
+		p.SetPacketID(id)
+	}
+
+	return p
+}
+
+func newFlowAck(t Type, id IDType, code ReasonCode) *Ack {
+	var p *Ack
+
+	switch t {
+	case PUBACK:
+		p = NewPubAck(ProtocolV50)
+	case PUBREC:
+		p = NewPubRec(ProtocolV50)
+	case PUBREL:
+		p = NewPubRel(ProtocolV50)
+	default:
+		p = NewPubComp(ProtocolV50)
+	}
+
+	p.SetPacketID(id)
+	p.SetReason(code)
+
+	return p
+}
+
+func TestFlowControlSend(t *testing.T) {
+	f := NewFlowControl(2, 0)
+	require.Equal(t, uint16(2), f.SendMaximum())
+	require.Equal(t, uint16(DefaultReceiveMaximum), f.RecvMaximum())
+
+	sent := &testQuotaCounter{}
+	f.SetCounters(sent, nil)
+
+	require.NoError(t, f.TryAcquire(newFlowPublish(t, QoS0, 0)))
+	require.NoError(t, f.TryAcquire(newFlowPublish(t, QoS1, 1)))
+	require.Equal(t, CodePacketIDInUse, f.TryAcquire(newFlowPublish(t, QoS1, 1)))
+	require.NoError(t, f.TryAcquire(newFlowPublish(t, QoS2, 2)))
+	require.Equal(t, CodeReceiveMaximumExceeded, f.TryAcquire(newFlowPublish(t, QoS1, 3)))
+
+	// QoS 0 never takes quota
+	require.NoError(t, f.TryAcquire(newFlowPublish(t, QoS0, 0)))
+	require.Equal(t, int64(2), atomic.LoadInt64(&sent.val))
+
+	// successful PUBREC and PUBREL do not release quota
+	require.False(t, f.AckReceived(newFlowAck(PUBREC, 2, CodeSuccess)))
+	require.False(t, f.AckReceived(newFlowAck(PUBREL, 2, CodeSuccess)))
+	require.True(t, f.AckReceived(newFlowAck(PUBCOMP, 2, CodeSuccess)))
+	require.False(t, f.AckReceived(newFlowAck(PUBCOMP, 2, CodeSuccess)))
+
+	require.NoError(t, f.TryAcquire(newFlowPublish(t, QoS2, 3)))
+	require.True(t, f.AckReceived(newFlowAck(PUBREC, 3, CodeQuotaExceeded)))
+	require.True(t, f.AckReceived(newFlowAck(PUBACK, 1, CodeSuccess)))
+
+	s, r := f.InFlight()
+	require.Equal(t, 0, s)
+	require.Equal(t, 0, r)
+	require.Equal(t, int64(0), atomic.LoadInt64(&sent.val))
+}
+
+func TestFlowControlBlock(t *testing.T) {
+	f := NewFlowControl(1, 0)
+
+	require.NoError(t, f.Acquire(context.Background(), newFlowPublish(t, QoS1, 1)))
+
+	done := make(chan error)
+	go func() {
+		done <- f.Acquire(context.Background(), newFlowPublish(t, QoS1, 2))
+	}()
+
+	select {
+	case <-done:
+		require.Fail(t, "acquire must block until quota returned")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	require.True(t, f.AckReceived(newFlowAck(PUBACK, 1, CodeSuccess)))
+
+	select {
+	case err := <-done:
+		require.NoError(t, err)
+	case <-time.After(time.Second):
+		require.Fail(t, "acquire not unblocked")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	require.Equal(t, context.DeadlineExceeded, f.Acquire(ctx, newFlowPublish(t, QoS1, 3)))
+
+	// raising maximum wakes up blocked senders
+	go func() {
+		done <- f.Acquire(context.Background(), newFlowPublish(t, QoS1, 4))
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	f.SetSendMaximum(2)
+
+	select {
+	case err := <-done:
+		require.NoError(t, err)
+	case <-time.After(time.Second):
+		require.Fail(t, "acquire not unblocked")
+	}
+}
+
+func TestFlowControlRecv(t *testing.T) {
+	f := NewFlowControl(0, 1)
+
+	recv := &testQuotaCounter{}
+	f.SetCounters(nil, recv)
+
+	require.NoError(t, f.Received(newFlowPublish(t, QoS2, 1)))
+
+	// redelivery does not take quota
+	require.NoError(t, f.Received(newFlowPublish(t, QoS2, 1)))
+	require.Equal(t, CodeReceiveMaximumExceeded, f.Received(newFlowPublish(t, QoS1, 2)))
+	require.Equal(t, int64(1), atomic.LoadInt64(&recv.val))
+
+	require.False(t, f.AckSent(newFlowAck(PUBREC, 1, CodeSuccess)))
+	require.True(t, f.AckSent(newFlowAck(PUBCOMP, 1, CodeSuccess)))
+	require.NoError(t, f.Received(newFlowPublish(t, QoS1, 2)))
+
+	f.Reset()
+
+	_, r := f.InFlight()
+	require.Equal(t, 0, r)
+	require.Equal(t, int64(0), atomic.LoadInt64(&recv.val))
+}
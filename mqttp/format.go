@@ -0,0 +1,266 @@
+package mqttp
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+	"unicode/utf8"
+)
+
+// fmtFields accumulates packet fields rendered by fmt.Formatter implementations
+type fmtFields struct {
+	buf     bytes.Buffer
+	verbose bool
+}
+
+func (w *fmtFields) add(name string, val interface{}) {
+	fmt.Fprintf(&w.buf, " %s:%v", name, val)
+}
+
+func (w *fmtFields) addQuoted(name string, val string) {
+	w.add(name, strconv.Quote(val))
+}
+
+// addBytes renders binary data as quoted string if it is valid UTF-8
+// and as hex otherwise. Only size is rendered unless verbose
+func (w *fmtFields) addBytes(name string, val []byte) {
+	switch {
+	case !w.verbose:
+		w.add(name, strconv.Itoa(len(val))+"B")
+	case utf8.Valid(val):
+		w.addQuoted(name, string(val))
+	default:
+		w.add(name, fmt.Sprintf("0x%x", val))
+	}
+}
+
+// formatPacket renders packet as NAME{v:<version> id:<id> <fields> properties:{...}}
+// properties are rendered only by %+v
+func formatPacket(f fmt.State, h *header, fields func(w *fmtFields)) {
+	w := fmtFields{
+		verbose: f.Flag('+'),
+	}
+
+	w.buf.WriteString(h.mType.Name())
+	w.buf.WriteString("{v:")
+	w.buf.WriteString(strconv.Itoa(int(h.version)))
+
+	if id, err := h.ID(); err == nil {
+		w.add("id", id)
+	}
+
+	if fields != nil {
+		fields(&w)
+	}
+
+	if w.verbose && h.version >= ProtocolV50 && len(h.properties.properties) > 0 {
+		ids := make([]PropertyID, 0, len(h.properties.properties))
+		for id := range h.properties.properties {
+			ids = append(ids, id)
+		}
+
+		sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+		w.buf.WriteString(" properties:{")
+		for i, id := range ids {
+			if i > 0 {
+				w.buf.WriteByte(' ')
+			}
+
+			w.buf.WriteString(id.Name())
+			w.buf.WriteByte(':')
+			w.buf.WriteString(formatProperty(id, h.properties.properties[id]))
+		}
+		w.buf.WriteByte('}')
+	}
+
+	w.buf.WriteByte('}')
+
+	_, _ = f.Write(w.buf.Bytes())
+}
+
+func formatProperty(id PropertyID, val interface{}) string {
+	switch v := val.(type) {
+	case string:
+		return strconv.Quote(v)
+	case []byte:
+		if propertyTypeMap[id] == PropertyTypeBinary {
+			return fmt.Sprintf("0x%x", v)
+		}
+	case StringPair:
+		return strconv.Quote(v.K) + "=" + strconv.Quote(v.V)
+	case []StringPair:
+		var buf bytes.Buffer
+		buf.WriteByte('[')
+		for i, p := range v {
+			if i > 0 {
+				buf.WriteByte(' ')
+			}
+			buf.WriteString(strconv.Quote(p.K) + "=" + strconv.Quote(p.V))
+		}
+		buf.WriteByte(']')
+		return buf.String()
+	}
+
+	return fmt.Sprintf("%v", val)
+}
+
+func formatCodes(t Type, codes []ReasonCode) string {
+	var buf bytes.Buffer
+
+	buf.WriteByte('[')
+	for i, c := range codes {
+		if i > 0 {
+			buf.WriteByte(' ')
+		}
+		buf.WriteString(c.NameForType(t))
+	}
+	buf.WriteByte(']')
+
+	return buf.String()
+}
+
+// Format implements fmt.Formatter
+// password is never rendered
+func (msg *Connect) Format(f fmt.State, _ rune) {
+	formatPacket(f, &msg.header, func(w *fmtFields) {
+		w.add("clean", msg.IsClean())
+		w.add("keepAlive", msg.keepAlive)
+		w.addQuoted("clientID", string(msg.clientID))
+
+		if len(msg.username) > 0 {
+			w.addQuoted("username", string(msg.username))
+		}
+
+		if len(msg.password) > 0 {
+			w.add("password", Redacted)
+		}
+
+		if msg.will != nil {
+			if w.verbose {
+				w.add("will", fmt.Sprintf("%+v", msg.will))
+			} else {
+				w.add("will", msg.will)
+			}
+		}
+	})
+}
+
+// Format implements fmt.Formatter
+// payload content is rendered by %+v only
+func (msg *Publish) Format(f fmt.State, _ rune) {
+	formatPacket(f, &msg.header, func(w *fmtFields) {
+		w.addQuoted("topic", msg.topic)
+		w.add("qos", msg.QoS().Desc())
+		w.add("retain", msg.Retain())
+		w.add("dup", msg.Dup())
+
+		if msg.payloadIsUTF8() || !w.verbose {
+			w.addBytes("payload", msg.payload)
+		} else {
+			w.add("payload", fmt.Sprintf("0x%x", msg.payload))
+		}
+
+		if !msg.expireAt.IsZero() {
+			w.add("expireAt", msg.expireAt.UTC().Format(time.RFC3339))
+		}
+	})
+}
+
+// Format implements fmt.Formatter
+func (msg *ConnAck) Format(f fmt.State, _ rune) {
+	formatPacket(f, &msg.header, func(w *fmtFields) {
+		w.add("sessionPresent", msg.sessionPresent)
+		w.add("returnCode", msg.returnCode.NameForType(msg.mType))
+	})
+}
+
+// Format implements fmt.Formatter
+func (msg *Ack) Format(f fmt.State, _ rune) {
+	formatPacket(f, &msg.header, func(w *fmtFields) {
+		if msg.version >= ProtocolV50 {
+			w.add("reason", msg.reasonCode.Name())
+		}
+	})
+}
+
+// Format implements fmt.Formatter
+func (msg *Disconnect) Format(f fmt.State, _ rune) {
+	formatPacket(f, &msg.header, func(w *fmtFields) {
+		if msg.version >= ProtocolV50 {
+			w.add("reason", msg.reasonCode.Name())
+		}
+	})
+}
+
+// Format implements fmt.Formatter
+func (msg *Auth) Format(f fmt.State, _ rune) {
+	formatPacket(f, &msg.header, func(w *fmtFields) {
+		w.add("reason", msg.authReason.Name())
+	})
+}
+
+// Format implements fmt.Formatter
+func (msg *PingReq) Format(f fmt.State, _ rune) {
+	formatPacket(f, &msg.header, nil)
+}
+
+// Format implements fmt.Formatter
+func (msg *PingResp) Format(f fmt.State, _ rune) {
+	formatPacket(f, &msg.header, nil)
+}
+
+// Format implements fmt.Formatter
+func (msg *Subscribe) Format(f fmt.State, _ rune) {
+	formatPacket(f, &msg.header, func(w *fmtFields) {
+		var buf bytes.Buffer
+
+		buf.WriteByte('[')
+		for i, t := range msg.topics {
+			if i > 0 {
+				buf.WriteByte(' ')
+			}
+
+			ops := t.Ops()
+			buf.WriteString(strconv.Quote(t.Full()) + ":" + ops.QoS().Desc())
+
+			if w.verbose && msg.version >= ProtocolV50 {
+				fmt.Fprintf(&buf, "(nl:%t rap:%t rh:%d)", ops.NL(), ops.RAP(), ops.RetainHandling())
+			}
+		}
+		buf.WriteByte(']')
+
+		w.add("topics", buf.String())
+	})
+}
+
+// Format implements fmt.Formatter
+func (msg *UnSubscribe) Format(f fmt.State, _ rune) {
+	formatPacket(f, &msg.header, func(w *fmtFields) {
+		topics := make([]string, 0, len(msg.topics))
+		for _, t := range msg.topics {
+			topics = append(topics, strconv.Quote(t.Full()))
+		}
+
+		w.add("topics", topics)
+	})
+}
+
+// Format implements fmt.Formatter
+// return codes are rendered by name
+func (msg *SubAck) Format(f fmt.State, _ rune) {
+	formatPacket(f, &msg.header, func(w *fmtFields) {
+		w.add("returnCodes", formatCodes(msg.mType, msg.returnCodes))
+	})
+}
+
+// Format implements fmt.Formatter
+func (msg *UnSubAck) Format(f fmt.State, _ rune) {
+	formatPacket(f, &msg.header, func(w *fmtFields) {
+		if msg.version >= ProtocolV50 {
+			w.add("returnCodes", formatCodes(msg.mType, msg.returnCodes))
+		}
+	})
+}
@@ -0,0 +1,52 @@
+package mqttp
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFormatPublish(t *testing.T) {
+	pkt := NewPublish(ProtocolV50)
+	require.NoError(t, pkt.Set("a/b", []byte("hello"), QoS1, false, false))
+	pkt.SetPacketID(1)
+	require.NoError(t, pkt.PropertySet(PropertyPayloadFormat, uint8(1)))
+	require.NoError(t, pkt.PropertySet(PropertyContentType, "text/plain"))
+
+	require.Equal(t, `PUBLISH{v:5 id:1 topic:"a/b" qos:QoS1 retain:false dup:false payload:5B}`, fmt.Sprintf("%v", pkt))
+	require.Equal(t,
+		`PUBLISH{v:5 id:1 topic:"a/b" qos:QoS1 retain:false dup:false payload:"hello" properties:{PayloadFormat:1 ContentType:"text/plain"}}`,
+		fmt.Sprintf("%+v", pkt))
+
+	pkt = NewPublish(ProtocolV311)
+	require.NoError(t, pkt.Set("a", []byte{0xFF}, QoS0, true, false))
+	require.Equal(t, `PUBLISH{v:4 topic:"a" qos:QoS0 retain:true dup:false payload:0xff}`, fmt.Sprintf("%+v", pkt))
+}
+
+func TestFormatConnect(t *testing.T) {
+	pkt := NewConnect(ProtocolV311)
+	pkt.SetClean(true)
+	pkt.SetKeepAlive(10)
+	require.NoError(t, pkt.SetClientID([]byte("client")))
+	require.NoError(t, pkt.SetCredentials([]byte("user"), []byte("secret")))
+
+	s := fmt.Sprintf("%+v", pkt)
+	require.NotContains(t, s, "secret")
+	require.Equal(t, `CONNECT{v:4 clean:true keepAlive:10 clientID:"client" username:"user" password:[redacted]}`, s)
+}
+
+func TestFormatAcks(t *testing.T) {
+	subAck := NewSubAck(ProtocolV311)
+	subAck.SetPacketID(2)
+	require.NoError(t, subAck.AddReturnCodes([]ReasonCode{ReasonCode(QoS1), QosFailure}))
+	require.Equal(t, `SUBACK{v:4 id:2 returnCodes:[GrantedQoS1 UnspecifiedError]}`, fmt.Sprintf("%v", subAck))
+
+	ack := NewPubRec(ProtocolV50)
+	ack.SetPacketID(3)
+	ack.SetReason(CodeQuotaExceeded)
+	require.NoError(t, ack.PropertySet(PropertyUserProperty, []StringPair{{K: "k", V: "v"}}))
+	require.Equal(t, `PUBREC{v:5 id:3 reason:QuotaExceeded properties:{UserProperty:["k"="v"]}}`, fmt.Sprintf("%+v", ack))
+
+	require.Equal(t, `PINGREQ{v:4}`, fmt.Sprintf("%v", NewPingReq(ProtocolV311)))
+}
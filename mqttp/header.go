@@ -19,6 +19,8 @@ type header struct {
 	mFlags     byte
 	mType      Type
 	version    ProtocolVersion
+	noCopy     bool
+	lenient    bool
 }
 
 const (
@@ -125,12 +127,7 @@ func (h *header) Encode(to []byte) (int, error) {
 		return expectedSize, ErrInsufficientBufferSize
 	}
 
-	offset := 0
-
-	to[offset] = byte(h.mType<<offsetPacketType) | h.mFlags
-	offset++
-
-	offset += binary.PutUvarint(to[offset:], uint64(h.remLen))
+	offset := h.encodeFixed(to)
 
 	var n int
 
@@ -190,24 +187,42 @@ func (h *header) PropertyForEach(f func(PropertyID, PropertyToType)) error {
 }
 
 func (h *header) setPacketID(id IDType) {
-	if len(h.packetID) == 0 {
-		h.packetID = make([]byte, 2)
-	}
+	h.allocPacketID()
 	binary.BigEndian.PutUint16(h.packetID, uint16(id))
 }
 
 func (h *header) decodePacketID(src []byte) int {
-	if len(h.packetID) == 0 {
-		h.packetID = make([]byte, 2)
-	}
+	h.allocPacketID()
 
 	return copy(h.packetID, src)
 }
 
+// allocPacketID reuses storage left after reset if any
+func (h *header) allocPacketID() {
+	if cap(h.packetID) < 2 {
+		h.packetID = make([]byte, 2)
+	} else {
+		h.packetID = h.packetID[:2]
+	}
+}
+
 func (h *header) encodePacketID(dst []byte) int {
 	return copy(dst, h.packetID)
 }
 
+// encodeFixed writes fixed header with remaining length
+// this function must be invoked after successful call to setRemainingLength
+func (h *header) encodeFixed(to []byte) int {
+	offset := 0
+
+	to[offset] = byte(h.mType<<offsetPacketType) | h.mFlags
+	offset++
+
+	offset += binary.PutUvarint(to[offset:], uint64(h.remLen))
+
+	return offset
+}
+
 // setRemainingLength sets the length of the non-fixed-header part of the message.
 // It returns error if the length is greater than 268435455, which is the max
 // message length as defined by the MQTT spec.
@@ -221,6 +236,27 @@ func (h *header) setRemainingLength(remLen int32) error {
 	return nil
 }
 
+// resetHeader clear state set by decode or by user
+// packet type and callbacks are preserved
+func (h *header) resetHeader() {
+	h.mFlags = h.mType.DefaultFlags()
+	h.remLen = 0
+	h.packetID = h.packetID[:0]
+	h.noCopy = false
+	h.lenient = false
+	h.properties.clear()
+}
+
+// setDecodeOptions applies options which affect decode of the packet body
+// NoCopy is honoured by PUBLISH only as other packets cannot be detached from decode buffer
+func (h *header) setDecodeOptions(opts *DecodeOptions) {
+	noCopy := opts.NoCopy && h.mType == PUBLISH
+
+	h.noCopy = noCopy
+	h.properties.noCopy = noCopy
+	h.lenient = opts.Lenient
+}
+
 func (h *header) getHeader() *header {
 	return h
 }
@@ -255,22 +291,19 @@ func (h *header) decode(from []byte) (int, error) {
 	h.mType = Type(from[offset] >> offsetPacketType)
 	h.mFlags = from[offset] & maskMessageFlags
 
-	reject := false
-	// [MQTT-2.2.2-1]
+	rule := ""
 	if h.mType != PUBLISH && h.mFlags != h.mType.DefaultFlags() {
-		reject = true
-	} else {
-		if !QosType((h.mFlags & maskPublishFlagQoS) >> offsetPublishFlagQoS).IsValid() {
-			reject = true
-		}
+		rule = "MQTT-2.2.2-1"
+	} else if !QosType((h.mFlags & maskPublishFlagQoS) >> offsetPublishFlagQoS).IsValid() {
+		rule = "MQTT-3.3.1-4"
 	}
 
-	if reject {
+	if rule != "" {
 		rejectCode := CodeRefusedServerUnavailable
 		if h.version == ProtocolV50 {
 			rejectCode = CodeMalformedPacket
 		}
-		return offset, rejectCode
+		return offset, violation(rejectCode, rule)
 	}
 
 	offset++
@@ -304,7 +337,8 @@ func (h *header) decode(from []byte) (int, error) {
 	// this is malformed packet if packed was decoded but there is still
 	// payload remaining
 	if int32(offset-fhLen) != h.remLen {
-		return offset, CodeMalformedPacket
+		// keep normative statement reported by packet decode if any
+		return offset, withRule(CodeMalformedPacket, err)
 	}
 
 	return offset, err
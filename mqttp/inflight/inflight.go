@@ -0,0 +1,66 @@
+// Package inflight implements delivery state of QoS 1 and QoS 2 PUBLISH packets
+// as per [MQTT-4.3] for both sides of the connection.
+//
+// Sender tracks PUBLISH packets sent to the peer until the flow completes
+//
+//	QoS 1: PUBLISH -> PUBACK
+//	QoS 2: PUBLISH -> PUBREC -> PUBREL -> PUBCOMP
+//
+// V5.0 PUBREC with Reason Code 0x80 or greater terminates QoS 2 flow right away [MQTT-4.3.3-4].
+// Receiver tracks QoS 2 PUBLISH packets received from the peer until PUBREL
+// thus application message is delivered onwards exactly once.
+//
+// Neither of them writes to the network, instead each call returns packet to send.
+// State can be persisted to vlpersistence.Packets with Store and restored with Load.
+package inflight
+
+import (
+	"github.com/VolantMQ/vlapi/mqttp"
+)
+
+// State of the sender flow
+type State byte
+
+const (
+	// StateWaitAck QoS 1 PUBLISH sent, PUBACK awaited
+	StateWaitAck State = iota + 1
+	// StateWaitRec QoS 2 PUBLISH sent, PUBREC awaited
+	StateWaitRec
+	// StateWaitComp PUBREL sent, PUBCOMP awaited
+	StateWaitComp
+)
+
+// String representation of state
+func (s State) String() string {
+	switch s {
+	case StateWaitAck:
+		return "WaitPubAck"
+	case StateWaitRec:
+		return "WaitPubRec"
+	case StateWaitComp:
+		return "WaitPubComp"
+	}
+
+	return "Unknown"
+}
+
+// newAck allocate acknowledgment of given type
+func newAck(t mqttp.Type, v mqttp.ProtocolVersion, id mqttp.IDType, code mqttp.ReasonCode) *mqttp.Ack {
+	var p *mqttp.Ack
+
+	switch t {
+	case mqttp.PUBACK:
+		p = mqttp.NewPubAck(v)
+	case mqttp.PUBREC:
+		p = mqttp.NewPubRec(v)
+	case mqttp.PUBREL:
+		p = mqttp.NewPubRel(v)
+	default:
+		p = mqttp.NewPubComp(v)
+	}
+
+	p.SetPacketID(id)
+	p.SetReason(code)
+
+	return p
+}
@@ -0,0 +1,346 @@
+package inflight
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/VolantMQ/vlapi/mqttp"
+	"github.com/VolantMQ/vlapi/vlpersistence"
+)
+
+func newPublish(t *testing.T, v mqttp.ProtocolVersion, q mqttp.QosType) *mqttp.Publish {
+	p := mqttp.NewPublish(v)
+	require.NoError(t, p.Set("a/b", []byte("data"), q, false, false))
+
+	return p
+}
+
+func requireAck(t *testing.T, p mqttp.IFace, typ mqttp.Type, id mqttp.IDType, code mqttp.ReasonCode) {
+	require.NotNil(t, p)
+	require.Equal(t, typ, p.Type())
+
+	pid, err := p.ID()
+	require.NoError(t, err)
+	require.Equal(t, id, pid)
+	require.Equal(t, code, p.(*mqttp.Ack).Reason())
+}
+
+func TestSenderQoS1(t *testing.T) {
+	s := NewSender(mqttp.ProtocolV50, nil)
+
+	require.NoError(t, s.Send(newPublish(t, mqttp.ProtocolV50, mqttp.QoS0)))
+	require.Equal(t, 0, s.Len())
+
+	pub := newPublish(t, mqttp.ProtocolV50, mqttp.QoS1)
+	require.NoError(t, s.Send(pub))
+
+	id, err := pub.ID()
+	require.NoError(t, err)
+	require.Equal(t, mqttp.IDType(1), id)
+
+	state, ok := s.State(id)
+	require.True(t, ok)
+	require.Equal(t, StateWaitAck, state)
+
+	_, _, err = s.Acknowledge(newAck(mqttp.PUBREC, mqttp.ProtocolV50, id, mqttp.CodeSuccess))
+	require.Equal(t, mqttp.CodeProtocolError, err)
+
+	reply, done, err := s.Acknowledge(newAck(mqttp.PUBACK, mqttp.ProtocolV50, id, mqttp.CodeNoMatchingSubscribers))
+	require.NoError(t, err)
+	require.Nil(t, reply)
+	require.Equal(t, pub, done)
+	require.Equal(t, 0, s.Len())
+
+	_, _, err = s.Acknowledge(newAck(mqttp.PUBACK, mqttp.ProtocolV50, id, mqttp.CodeSuccess))
+	require.Equal(t, mqttp.CodePacketIDNotFound, err)
+}
+
+func TestSenderQoS2(t *testing.T) {
+	ids := mqttp.NewPacketIDPool()
+	s := NewSender(mqttp.ProtocolV50, ids)
+
+	pub := newPublish(t, mqttp.ProtocolV50, mqttp.QoS2)
+	pub.SetPacketID(10)
+	require.NoError(t, s.Send(pub))
+	require.True(t, ids.InUse(10))
+
+	require.Equal(t, mqttp.CodePacketIDInUse, s.Send(pub))
+
+	reply, done, err := s.Acknowledge(newAck(mqttp.PUBREC, mqttp.ProtocolV50, 10, mqttp.CodeSuccess))
+	require.NoError(t, err)
+	require.Nil(t, done)
+	requireAck(t, reply, mqttp.PUBREL, 10, mqttp.CodeSuccess)
+
+	// duplicate PUBREC is answered with same PUBREL
+	again, _, err := s.Acknowledge(newAck(mqttp.PUBREC, mqttp.ProtocolV50, 10, mqttp.CodeSuccess))
+	require.NoError(t, err)
+	require.Equal(t, reply, again)
+
+	state, _ := s.State(10)
+	require.Equal(t, StateWaitComp, state)
+
+	reply, done, err = s.Acknowledge(newAck(mqttp.PUBCOMP, mqttp.ProtocolV50, 10, mqttp.CodeSuccess))
+	require.NoError(t, err)
+	require.Nil(t, reply)
+	require.Equal(t, pub, done)
+	require.False(t, ids.InUse(10))
+}
+
+func TestSenderQoS2Rejected(t *testing.T) {
+	s := NewSender(mqttp.ProtocolV50, nil)
+
+	pub := newPublish(t, mqttp.ProtocolV50, mqttp.QoS2)
+	require.NoError(t, s.Send(pub))
+
+	id, _ := pub.ID()
+
+	reply, done, err := s.Acknowledge(newAck(mqttp.PUBREC, mqttp.ProtocolV50, id, mqttp.CodeQuotaExceeded))
+	require.NoError(t, err)
+	require.Nil(t, reply)
+	require.Equal(t, pub, done)
+	require.Equal(t, 0, s.Len())
+}
+
+func TestSenderRetransmit(t *testing.T) {
+	s := NewSender(mqttp.ProtocolV311, nil)
+
+	pub1 := newPublish(t, mqttp.ProtocolV311, mqttp.QoS1)
+	require.NoError(t, s.Send(pub1))
+
+	pub2 := newPublish(t, mqttp.ProtocolV311, mqttp.QoS2)
+	require.NoError(t, s.Send(pub2))
+
+	pub3 := newPublish(t, mqttp.ProtocolV311, mqttp.QoS2)
+	require.NoError(t, s.Send(pub3))
+
+	id, _ := pub2.ID()
+	rel, _, err := s.Acknowledge(newAck(mqttp.PUBREC, mqttp.ProtocolV311, id, mqttp.CodeSuccess))
+	require.NoError(t, err)
+
+	require.Empty(t, s.Retransmit(time.Hour))
+
+	pkts := s.Retransmit(0)
+	require.Equal(t, []mqttp.IFace{pub1, rel, pub3}, pkts)
+	require.True(t, pub1.Dup())
+	require.True(t, pub3.Dup())
+	require.False(t, pub2.Dup())
+
+	s.Reset()
+	require.Equal(t, 0, s.Len())
+	require.Empty(t, s.Retransmit(0))
+}
+
+func TestReceiver(t *testing.T) {
+	r := NewReceiver(mqttp.ProtocolV50)
+
+	reply, deliver, err := r.Receive(newPublish(t, mqttp.ProtocolV50, mqttp.QoS0))
+	require.NoError(t, err)
+	require.Nil(t, reply)
+	require.True(t, deliver)
+
+	pub := newPublish(t, mqttp.ProtocolV50, mqttp.QoS1)
+	pub.SetPacketID(1)
+
+	reply, deliver, err = r.Receive(pub)
+	require.NoError(t, err)
+	require.True(t, deliver)
+	requireAck(t, reply, mqttp.PUBACK, 1, mqttp.CodeSuccess)
+
+	pub = newPublish(t, mqttp.ProtocolV50, mqttp.QoS2)
+	pub.SetPacketID(2)
+
+	reply, deliver, err = r.Receive(pub)
+	require.NoError(t, err)
+	require.True(t, deliver)
+	requireAck(t, reply, mqttp.PUBREC, 2, mqttp.CodeSuccess)
+
+	// redelivery before PUBREL must not be delivered again
+	pub.SetDup(true)
+
+	reply, deliver, err = r.Receive(pub)
+	require.NoError(t, err)
+	require.False(t, deliver)
+	requireAck(t, reply, mqttp.PUBREC, 2, mqttp.CodeSuccess)
+
+	reply, err = r.Release(newAck(mqttp.PUBREL, mqttp.ProtocolV50, 2, mqttp.CodeSuccess))
+	require.NoError(t, err)
+	requireAck(t, reply, mqttp.PUBCOMP, 2, mqttp.CodeSuccess)
+	require.Equal(t, 0, r.Len())
+
+	reply, err = r.Release(newAck(mqttp.PUBREL, mqttp.ProtocolV50, 2, mqttp.CodeSuccess))
+	require.NoError(t, err)
+	requireAck(t, reply, mqttp.PUBCOMP, 2, mqttp.CodePacketIDNotFound)
+
+	// rejected flow does not expect PUBREL
+	pub = newPublish(t, mqttp.ProtocolV50, mqttp.QoS2)
+	pub.SetPacketID(3)
+
+	_, err = r.Reject(pub, mqttp.CodeSuccess)
+	require.Equal(t, mqttp.ErrInvalidArgs, err)
+
+	reply, err = r.Reject(pub, mqttp.CodeNotAuthorized)
+	require.NoError(t, err)
+	requireAck(t, reply, mqttp.PUBREC, 3, mqttp.CodeNotAuthorized)
+	require.Equal(t, 0, r.Len())
+}
+
+type testPackets struct {
+	vlpersistence.Packets
+	unAck map[string][]*vlpersistence.PersistedPacket
+}
+
+func (p *testPackets) PacketsStore(id []byte, packets vlpersistence.PersistedPackets) error {
+	p.unAck[string(id)] = append(p.unAck[string(id)], packets.UnAck...)
+	return nil
+}
+
+func (p *testPackets) PacketsForEachUnAck(id []byte, ctx interface{}, loader vlpersistence.PacketLoader) error {
+	var left []*vlpersistence.PersistedPacket
+	var err error
+
+	entries := p.unAck[string(id)]
+
+	for i, entry := range entries {
+		var del bool
+
+		del, err = loader(ctx, entry)
+		if !del {
+			left = append(left, entry)
+		}
+
+		// load is interrupted after current packet, packets deleted so far stay deleted
+		if err != nil {
+			left = append(left, entries[i+1:]...)
+			break
+		}
+	}
+
+	p.unAck[string(id)] = left
+
+	return err
+}
+
+func TestStoreLoad(t *testing.T) {
+	storage := &testPackets{unAck: make(map[string][]*vlpersistence.PersistedPacket)}
+	sessionID := []byte("session")
+
+	s := NewSender(mqttp.ProtocolV50, nil)
+	r := NewReceiver(mqttp.ProtocolV50)
+
+	expireAt := time.Now().Add(time.Hour).Truncate(time.Second)
+
+	pub1 := newPublish(t, mqttp.ProtocolV50, mqttp.QoS1)
+	pub1.SetExpireAt(expireAt)
+	require.NoError(t, s.Send(pub1))
+
+	pub2 := newPublish(t, mqttp.ProtocolV50, mqttp.QoS2)
+	require.NoError(t, s.Send(pub2))
+
+	_, _, err := s.Acknowledge(newAck(mqttp.PUBREC, mqttp.ProtocolV50, 2, mqttp.CodeSuccess))
+	require.NoError(t, err)
+
+	in := newPublish(t, mqttp.ProtocolV50, mqttp.QoS2)
+	in.SetPacketID(7)
+
+	_, _, err = r.Receive(in)
+	require.NoError(t, err)
+
+	require.NoError(t, Store(storage, sessionID, s, r))
+	require.Len(t, storage.unAck[string(sessionID)], 3)
+
+	ids := mqttp.NewPacketIDPool()
+	restoredS := NewSender(mqttp.ProtocolV50, ids)
+	restoredR := NewReceiver(mqttp.ProtocolV50)
+
+	require.NoError(t, Load(storage, sessionID, restoredS, restoredR))
+	require.Empty(t, storage.unAck[string(sessionID)])
+	require.True(t, ids.InUse(1))
+	require.True(t, ids.InUse(2))
+
+	state, ok := restoredS.State(1)
+	require.True(t, ok)
+	require.Equal(t, StateWaitAck, state)
+
+	state, ok = restoredS.State(2)
+	require.True(t, ok)
+	require.Equal(t, StateWaitComp, state)
+
+	pkts := restoredS.Retransmit(0)
+	require.Len(t, pkts, 2)
+	require.Equal(t, mqttp.PUBLISH, pkts[0].Type())
+	require.True(t, pkts[0].(*mqttp.Publish).Dup())
+
+	tm, _, expired := pkts[0].(*mqttp.Publish).Expired()
+	require.False(t, expired)
+	require.True(t, expireAt.Equal(tm))
+	requireAck(t, pkts[1], mqttp.PUBREL, 2, mqttp.CodeSuccess)
+
+	// restored receiver flow suppresses redelivery
+	in.SetDup(true)
+
+	_, deliver, err := restoredR.Receive(in)
+	require.NoError(t, err)
+	require.False(t, deliver)
+
+	// flow restored in PUBREL state has no PUBLISH to report on completion
+	reply, pub, err := restoredS.Acknowledge(newAck(mqttp.PUBCOMP, mqttp.ProtocolV50, 2, mqttp.CodeSuccess))
+	require.NoError(t, err)
+	require.Nil(t, reply)
+	require.Nil(t, pub)
+	require.False(t, ids.InUse(2))
+}
+
+func TestLoadCorrupt(t *testing.T) {
+	storage := &testPackets{unAck: make(map[string][]*vlpersistence.PersistedPacket)}
+	sessionID := []byte("session")
+
+	persist := func(id mqttp.IDType) *vlpersistence.PersistedPacket {
+		pub := newPublish(t, mqttp.ProtocolV50, mqttp.QoS1)
+		pub.SetPacketID(id)
+
+		entry, err := vlpersistence.NewPersistedPacket(pub)
+		require.NoError(t, err)
+
+		return entry
+	}
+
+	// packet ID taken by another flow
+	duplicate := persist(1)
+	storage.unAck[string(sessionID)] = []*vlpersistence.PersistedPacket{persist(1), duplicate}
+
+	s := NewSender(mqttp.ProtocolV50, nil)
+	require.Equal(t, mqttp.CodePacketIDInUse, Load(storage, sessionID, s, nil))
+	require.Equal(t, []*vlpersistence.PersistedPacket{duplicate}, storage.unAck[string(sessionID)])
+	require.Equal(t, 1, s.Len())
+
+	// entry which can't be decoded
+	broken := persist(2)
+	broken.Data = broken.Data[:3]
+	storage.unAck[string(sessionID)] = []*vlpersistence.PersistedPacket{broken}
+
+	s = NewSender(mqttp.ProtocolV50, nil)
+	require.Error(t, Load(storage, sessionID, s, nil))
+	require.Equal(t, []*vlpersistence.PersistedPacket{broken}, storage.unAck[string(sessionID)])
+	require.Equal(t, 0, s.Len())
+}
+
+func TestSenderRestoreInvalid(t *testing.T) {
+	s := NewSender(mqttp.ProtocolV50, nil)
+
+	for _, typ := range []mqttp.Type{mqttp.PUBACK, mqttp.PUBREC, mqttp.PUBCOMP} {
+		require.Equal(t, mqttp.ErrInvalidMessageType, s.restore(newAck(typ, mqttp.ProtocolV50, 1, mqttp.CodeSuccess)))
+	}
+
+	sub := mqttp.NewSubscribe(mqttp.ProtocolV50)
+	sub.SetPacketID(1)
+	require.Equal(t, mqttp.ErrInvalidMessageType, s.restore(sub))
+
+	require.Equal(t, 0, s.Len())
+	require.NoError(t, s.restore(newAck(mqttp.PUBREL, mqttp.ProtocolV50, 1, mqttp.CodeSuccess)))
+
+	state, ok := s.State(1)
+	require.True(t, ok)
+	require.Equal(t, StateWaitComp, state)
+}
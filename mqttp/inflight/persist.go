@@ -0,0 +1,102 @@
+package inflight
+
+import (
+	"github.com/VolantMQ/vlapi/mqttp"
+	"github.com/VolantMQ/vlapi/vlpersistence"
+)
+
+// Store persist flows in progress of session id as PersistedPackets.UnAck
+// Sender flows are stored as PUBLISH or PUBREL packets in order they have been sent,
+// receiver flows as PUBREC packets. Either of s or r might be nil.
+// Expiration time of PUBLISH packets is kept
+func Store(packets vlpersistence.Packets, id []byte, s *Sender, r *Receiver) error {
+	var pkts []mqttp.IFace
+
+	if s != nil {
+		s.lock.Lock()
+		pkts = append(pkts, s.packets()...)
+		s.lock.Unlock()
+	}
+
+	if r != nil {
+		r.lock.Lock()
+		pkts = append(pkts, r.packets()...)
+		r.lock.Unlock()
+	}
+
+	if len(pkts) == 0 {
+		return nil
+	}
+
+	persisted := vlpersistence.PersistedPackets{
+		UnAck: make([]*vlpersistence.PersistedPacket, 0, len(pkts)),
+	}
+
+	for _, p := range pkts {
+		pkt, err := vlpersistence.NewPersistedPacket(p)
+		if err != nil {
+			return err
+		}
+
+		persisted.UnAck = append(persisted.UnAck, pkt)
+	}
+
+	return packets.PacketsStore(id, persisted)
+}
+
+// Load restore flows of session id stored by Store
+// Packets are decoded with protocol version of the sender, or receiver if sender is nil,
+// and deleted from persistence once restored. Packets of nil side are left as is
+func Load(packets vlpersistence.Packets, id []byte, s *Sender, r *Receiver) error {
+	var v mqttp.ProtocolVersion
+
+	switch {
+	case s != nil:
+		v = s.version
+	case r != nil:
+		v = r.version
+	default:
+		return nil
+	}
+
+	return packets.PacketsForEachUnAck(id, nil, func(_ interface{}, entry *vlpersistence.PersistedPacket) (bool, error) {
+		p, _, err := mqttp.Decode(v, entry.Data)
+		if err != nil {
+			return false, err
+		}
+
+		switch p.Type() {
+		case mqttp.PUBLISH, mqttp.PUBREL:
+			if s == nil {
+				return false, nil
+			}
+
+			// delivery has been started thus packet is resent as is even if expired
+			if msg, ok := p.(*mqttp.Publish); ok && !entry.ExpireAt.IsZero() {
+				msg.SetExpireAt(entry.ExpireAt)
+			}
+
+			// entry is kept if flow can't be restored, thus message is not lost
+			if err = s.restore(p); err != nil {
+				return false, err
+			}
+
+			return true, nil
+		case mqttp.PUBREC:
+			if r == nil {
+				return false, nil
+			}
+
+			pid, err := p.ID()
+			if err != nil {
+				return false, err
+			}
+
+			r.restore(pid)
+
+			return true, nil
+		}
+
+		return false, vlpersistence.ErrBrokenEntry
+	})
+}
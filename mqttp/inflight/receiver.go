@@ -0,0 +1,135 @@
+package inflight
+
+import (
+	"sync"
+
+	"github.com/VolantMQ/vlapi/mqttp"
+)
+
+// Receiver delivery state of PUBLISH packets received from the peer
+// Only QoS 2 packets hold state, from PUBLISH until PUBREL
+type Receiver struct {
+	lock    sync.Mutex
+	version mqttp.ProtocolVersion
+	flows   map[mqttp.IDType]struct{}
+}
+
+// NewReceiver allocate receiver state of session with given protocol version
+func NewReceiver(v mqttp.ProtocolVersion) *Receiver {
+	return &Receiver{
+		version: v,
+		flows:   make(map[mqttp.IDType]struct{}),
+	}
+}
+
+// Len number of QoS 2 flows awaiting PUBREL
+func (r *Receiver) Len() int {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	return len(r.flows)
+}
+
+// Receive process PUBLISH packet received from the peer
+// It returns packet to reply with, PUBACK or PUBREC, and whether application message
+// must be delivered onwards. Redelivery of QoS 2 packet awaiting PUBREL is acknowledged
+// again but not delivered [MQTT-4.3.3-10]
+func (r *Receiver) Receive(p *mqttp.Publish) (mqttp.IFace, bool, error) {
+	return r.receive(p, mqttp.CodeSuccess)
+}
+
+// Reject process PUBLISH packet received from the peer which is not accepted, e.g. not authorized
+// It returns PUBACK or PUBREC carrying code, which must be 0x80 or greater. Rejected QoS 2 flow
+// is terminated thus PUBREL is not expected. V3 has no way to reject, packet is acknowledged anyway
+func (r *Receiver) Reject(p *mqttp.Publish, code mqttp.ReasonCode) (mqttp.IFace, error) {
+	if code < mqttp.CodeUnspecifiedError {
+		return nil, mqttp.ErrInvalidArgs
+	}
+
+	reply, _, err := r.receive(p, code)
+
+	return reply, err
+}
+
+// Release process PUBREL received from the peer and return PUBCOMP to reply with
+// PUBREL with unknown ID is completed as well, V5.0 PUBCOMP carries CodePacketIDNotFound then
+func (r *Receiver) Release(p mqttp.IFace) (mqttp.IFace, error) {
+	if p.Type() != mqttp.PUBREL {
+		return nil, mqttp.ErrInvalidMessageType
+	}
+
+	id, err := p.ID()
+	if err != nil {
+		return nil, err
+	}
+
+	code := mqttp.CodeSuccess
+
+	r.lock.Lock()
+	if _, ok := r.flows[id]; ok {
+		delete(r.flows, id)
+	} else {
+		code = mqttp.CodePacketIDNotFound
+	}
+	r.lock.Unlock()
+
+	return newAck(mqttp.PUBCOMP, r.version, id, code), nil
+}
+
+// Reset drop all flows, e.g. when session is not resumed
+func (r *Receiver) Reset() {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	for id := range r.flows {
+		delete(r.flows, id)
+	}
+}
+
+func (r *Receiver) receive(p *mqttp.Publish, code mqttp.ReasonCode) (mqttp.IFace, bool, error) {
+	if p.QoS() == mqttp.QoS0 {
+		return nil, code < mqttp.CodeUnspecifiedError, nil
+	}
+
+	id, err := p.ID()
+	if err != nil {
+		return nil, false, err
+	}
+
+	if p.QoS() == mqttp.QoS1 {
+		return newAck(mqttp.PUBACK, r.version, id, code), code < mqttp.CodeUnspecifiedError, nil
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if _, ok := r.flows[id]; ok {
+		return newAck(mqttp.PUBREC, r.version, id, mqttp.CodeSuccess), false, nil
+	}
+
+	if code >= mqttp.CodeUnspecifiedError {
+		return newAck(mqttp.PUBREC, r.version, id, code), false, nil
+	}
+
+	r.flows[id] = struct{}{}
+
+	return newAck(mqttp.PUBREC, r.version, id, code), true, nil
+}
+
+// restore flow loaded from persistence
+func (r *Receiver) restore(id mqttp.IDType) {
+	r.lock.Lock()
+	r.flows[id] = struct{}{}
+	r.lock.Unlock()
+}
+
+// packets PUBREC of flows in progress, must be called with lock held
+func (r *Receiver) packets() []mqttp.IFace {
+	res := make([]mqttp.IFace, 0, len(r.flows))
+
+	for id := range r.flows {
+		res = append(res, newAck(mqttp.PUBREC, r.version, id, mqttp.CodeSuccess))
+	}
+
+	return res
+}
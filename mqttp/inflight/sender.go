@@ -0,0 +1,265 @@
+package inflight
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	"github.com/VolantMQ/vlapi/mqttp"
+)
+
+// Sender delivery state of PUBLISH packets sent to the peer
+type Sender struct {
+	lock    sync.Mutex
+	version mqttp.ProtocolVersion
+	ids     *mqttp.PacketIDPool
+	flows   map[mqttp.IDType]*list.Element
+	order   *list.List
+}
+
+type senderFlow struct {
+	id     mqttp.IDType
+	state  State
+	pkt    *mqttp.Publish
+	rel    *mqttp.Ack
+	sentAt time.Time
+}
+
+// NewSender allocate sender state of session with given protocol version
+// ids is pool packet IDs are allocated from, if nil sender allocates own one
+func NewSender(v mqttp.ProtocolVersion, ids *mqttp.PacketIDPool) *Sender {
+	if ids == nil {
+		ids = mqttp.NewPacketIDPool()
+	}
+
+	return &Sender{
+		version: v,
+		ids:     ids,
+		flows:   make(map[mqttp.IDType]*list.Element),
+		order:   list.New(),
+	}
+}
+
+// Len number of flows in progress
+func (s *Sender) Len() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.order.Len()
+}
+
+// State of the flow with given packet ID
+func (s *Sender) State(id mqttp.IDType) (State, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	e, ok := s.flows[id]
+	if !ok {
+		return 0, false
+	}
+
+	return e.Value.(*senderFlow).state, true
+}
+
+// Send start flow of PUBLISH packet before it is written to the network
+// If packet has no ID it is allocated, otherwise ID is reserved and CodePacketIDInUse
+// returned if it is taken. QoS 0 packets are not tracked
+func (s *Sender) Send(p *mqttp.Publish) error {
+	var state State
+
+	switch p.QoS() {
+	case mqttp.QoS0:
+		return nil
+	case mqttp.QoS1:
+		state = StateWaitAck
+	default:
+		state = StateWaitRec
+	}
+
+	id, err := p.ID()
+	if err == mqttp.ErrNotSet {
+		if id, err = s.ids.Acquire(); err != nil {
+			return err
+		}
+
+		p.SetPacketID(id)
+	} else if err != nil {
+		return err
+	} else if err = s.ids.Reserve(id); err != nil {
+		return err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.flows[id] = s.order.PushBack(&senderFlow{
+		id:     id,
+		state:  state,
+		pkt:    p,
+		sentAt: time.Now(),
+	})
+
+	return nil
+}
+
+// Acknowledge process PUBACK, PUBREC or PUBCOMP received from the peer
+// It returns packet to reply with, i.e. PUBREL, and PUBLISH packet if its flow has completed.
+// PUBLISH is nil when PUBCOMP completes flow restored by Load in PUBREL state as
+// such flows do not keep PUBLISH packet.
+// Returns CodePacketIDNotFound if there is no flow for the ID and
+// CodeProtocolError if acknowledgment does not match state of the flow
+func (s *Sender) Acknowledge(p mqttp.IFace) (mqttp.IFace, *mqttp.Publish, error) {
+	ack, ok := p.(*mqttp.Ack)
+	if !ok {
+		return nil, nil, mqttp.ErrInvalidMessageType
+	}
+
+	id, err := ack.ID()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	e, ok := s.flows[id]
+	if !ok {
+		return nil, nil, mqttp.CodePacketIDNotFound
+	}
+
+	flow := e.Value.(*senderFlow)
+
+	switch {
+	case ack.Type() == mqttp.PUBACK && flow.state == StateWaitAck:
+	case ack.Type() == mqttp.PUBREC && flow.state == StateWaitRec:
+		// [MQTT-4.3.3-4] flow is over if peer rejected message
+		if ack.Reason() < mqttp.CodeUnspecifiedError {
+			flow.state = StateWaitComp
+			flow.rel = newAck(mqttp.PUBREL, s.version, id, mqttp.CodeSuccess)
+			flow.sentAt = time.Now()
+
+			return flow.rel, nil, nil
+		}
+	case ack.Type() == mqttp.PUBREC && flow.state == StateWaitComp:
+		// PUBREL has not reached the peer yet
+		return flow.rel, nil, nil
+	case ack.Type() == mqttp.PUBCOMP && flow.state == StateWaitComp:
+	default:
+		return nil, nil, mqttp.CodeProtocolError
+	}
+
+	s.complete(e)
+
+	return nil, flow.pkt, nil
+}
+
+// Retransmit packets of flows in progress sent earlier than olderThan ago, 0 selects all of them.
+// Must be called when session is resumed [MQTT-4.4.0-1]. PUBLISH packets are marked with DUP flag
+// [MQTT-3.3.1-1] and PUBREL packets are sent in place of PUBLISH the peer has acknowledged already.
+// Packets are returned in order they have been originally sent [MQTT-4.6.0-1]
+func (s *Sender) Retransmit(olderThan time.Duration) []mqttp.IFace {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	now := time.Now()
+
+	var res []mqttp.IFace
+
+	for e := s.order.Front(); e != nil; e = e.Next() {
+		flow := e.Value.(*senderFlow)
+
+		if olderThan > 0 && now.Sub(flow.sentAt) < olderThan {
+			continue
+		}
+
+		flow.sentAt = now
+
+		if flow.state == StateWaitComp {
+			res = append(res, flow.rel)
+		} else {
+			flow.pkt.SetDup(true)
+			res = append(res, flow.pkt)
+		}
+	}
+
+	return res
+}
+
+// Reset drop all flows and release their IDs, e.g. when session is not resumed
+func (s *Sender) Reset() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for e := s.order.Front(); e != nil; {
+		next := e.Next()
+		s.complete(e)
+		e = next
+	}
+}
+
+// restore flow loaded from persistence
+func (s *Sender) restore(p mqttp.IFace) error {
+	id, err := p.ID()
+	if err != nil {
+		return err
+	}
+
+	flow := &senderFlow{
+		id:     id,
+		sentAt: time.Now(),
+	}
+
+	switch pkt := p.(type) {
+	case *mqttp.Publish:
+		flow.pkt = pkt
+		flow.state = StateWaitAck
+
+		if pkt.QoS() == mqttp.QoS2 {
+			flow.state = StateWaitRec
+		}
+	case *mqttp.Ack:
+		// PUBLISH of flow waiting for PUBCOMP is not persisted
+		if pkt.Type() != mqttp.PUBREL {
+			return mqttp.ErrInvalidMessageType
+		}
+
+		flow.rel = pkt
+		flow.state = StateWaitComp
+	default:
+		return mqttp.ErrInvalidMessageType
+	}
+
+	if err = s.ids.Reserve(id); err != nil {
+		return err
+	}
+
+	s.lock.Lock()
+	s.flows[id] = s.order.PushBack(flow)
+	s.lock.Unlock()
+
+	return nil
+}
+
+// packets of flows in progress, must be called with lock held
+func (s *Sender) packets() []mqttp.IFace {
+	res := make([]mqttp.IFace, 0, s.order.Len())
+
+	for e := s.order.Front(); e != nil; e = e.Next() {
+		flow := e.Value.(*senderFlow)
+
+		if flow.state == StateWaitComp {
+			res = append(res, flow.rel)
+		} else {
+			res = append(res, flow.pkt)
+		}
+	}
+
+	return res
+}
+
+// complete drop flow, must be called with lock held
+func (s *Sender) complete(e *list.Element) {
+	flow := s.order.Remove(e).(*senderFlow)
+	delete(s.flows, flow.id)
+	s.ids.Release(flow.id)
+}
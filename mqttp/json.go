@@ -0,0 +1,811 @@
+package mqttp
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strconv"
+	"time"
+	"unicode/utf8"
+)
+
+// Redacted replaces password in JSON and text representation of CONNECT packet
+const Redacted = "[redacted]"
+
+const (
+	payloadEncodingUTF8   = "utf8"
+	payloadEncodingBase64 = "base64"
+)
+
+// jsonHeader fields common to all packet types
+// properties are keyed by PropertyID.Name
+type jsonHeader struct {
+	Type       string                     `json:"type"`
+	Version    ProtocolVersion            `json:"version"`
+	ID         *IDType                    `json:"id,omitempty"`
+	Properties map[string]json.RawMessage `json:"properties,omitempty"`
+}
+
+type jsonStringPair struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+type jsonPublish struct {
+	jsonHeader
+	Topic    string     `json:"topic"`
+	QoS      QosType    `json:"qos"`
+	Retain   bool       `json:"retain,omitempty"`
+	Dup      bool       `json:"dup,omitempty"`
+	Payload  string     `json:"payload"`
+	Encoding string     `json:"encoding"`
+	ExpireAt *time.Time `json:"expireAt,omitempty"`
+}
+
+type jsonConnect struct {
+	jsonHeader
+	Clean     bool            `json:"clean"`
+	KeepAlive uint16          `json:"keepAlive"`
+	ClientID  string          `json:"clientID"`
+	Username  string          `json:"username,omitempty"`
+	Password  string          `json:"password,omitempty"`
+	Will      json.RawMessage `json:"will,omitempty"`
+}
+
+type jsonConnAck struct {
+	jsonHeader
+	SessionPresent bool            `json:"sessionPresent"`
+	ReturnCode     json.RawMessage `json:"returnCode"`
+}
+
+type jsonReason struct {
+	jsonHeader
+	Reason json.RawMessage `json:"reason,omitempty"`
+}
+
+type jsonSubscription struct {
+	Topic             string         `json:"topic"`
+	QoS               QosType        `json:"qos"`
+	NoLocal           bool           `json:"noLocal,omitempty"`
+	RetainAsPublished bool           `json:"retainAsPublished,omitempty"`
+	RetainHandling    RetainHandling `json:"retainHandling,omitempty"`
+}
+
+type jsonSubscribe struct {
+	jsonHeader
+	Topics []jsonSubscription `json:"topics"`
+}
+
+type jsonUnSubscribe struct {
+	jsonHeader
+	Topics []string `json:"topics"`
+}
+
+type jsonReturnCodes struct {
+	jsonHeader
+	ReturnCodes []json.RawMessage `json:"returnCodes,omitempty"`
+}
+
+// DecodeJSON allocates packet of the type and version specified by JSON document
+// produced by MarshalJSON of any packet and unmarshal document into it
+func DecodeJSON(data []byte) (IFace, error) {
+	var h jsonHeader
+
+	if err := json.Unmarshal(data, &h); err != nil {
+		return nil, err
+	}
+
+	t, ok := typeByName(h.Type)
+	if !ok {
+		return nil, ErrInvalidMessageType
+	}
+
+	m, err := New(h.Version, t)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = m.(json.Unmarshaler).UnmarshalJSON(data); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// MarshalJSON implements json.Marshaler
+func (msg *Connect) MarshalJSON() ([]byte, error) {
+	h, err := msg.marshalHeader()
+	if err != nil {
+		return nil, err
+	}
+
+	res := jsonConnect{
+		jsonHeader: h,
+		Clean:      msg.IsClean(),
+		KeepAlive:  msg.keepAlive,
+		ClientID:   string(msg.clientID),
+		Username:   string(msg.username),
+	}
+
+	if len(msg.password) > 0 {
+		res.Password = Redacted
+	}
+
+	if msg.will != nil {
+		if res.Will, err = msg.will.MarshalJSON(); err != nil {
+			return nil, err
+		}
+	}
+
+	return json.Marshal(&res)
+}
+
+// UnmarshalJSON implements json.Unmarshaler
+// password equal to Redacted is ignored thus packet rendered by MarshalJSON
+// carries no credentials
+func (msg *Connect) UnmarshalJSON(data []byte) error {
+	var res jsonConnect
+
+	if err := json.Unmarshal(data, &res); err != nil {
+		return err
+	}
+
+	msg.reset()
+
+	if err := msg.unmarshalHeader(&res.jsonHeader); err != nil {
+		return err
+	}
+
+	msg.SetClean(res.Clean)
+	msg.SetKeepAlive(res.KeepAlive)
+
+	if err := msg.SetClientID([]byte(res.ClientID)); err != nil {
+		return err
+	}
+
+	var password []byte
+	if res.Password != Redacted {
+		password = []byte(res.Password)
+	}
+
+	if err := msg.SetCredentials([]byte(res.Username), password); err != nil {
+		return err
+	}
+
+	if len(res.Will) > 0 {
+		will := NewPublish(msg.version)
+		if err := will.UnmarshalJSON(res.Will); err != nil {
+			return err
+		}
+
+		if err := msg.SetWill(will); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler
+// payload is rendered as UTF-8 string if PropertyPayloadFormat is 1, as base64 otherwise
+func (msg *Publish) MarshalJSON() ([]byte, error) {
+	h, err := msg.marshalHeader()
+	if err != nil {
+		return nil, err
+	}
+
+	res := jsonPublish{
+		jsonHeader: h,
+		Topic:      msg.topic,
+		QoS:        msg.QoS(),
+		Retain:     msg.Retain(),
+		Dup:        msg.Dup(),
+	}
+
+	if msg.payloadIsUTF8() {
+		res.Payload = string(msg.payload)
+		res.Encoding = payloadEncodingUTF8
+	} else {
+		res.Payload = base64.StdEncoding.EncodeToString(msg.payload)
+		res.Encoding = payloadEncodingBase64
+	}
+
+	if !msg.expireAt.IsZero() {
+		tm := msg.expireAt
+		res.ExpireAt = &tm
+	}
+
+	return json.Marshal(&res)
+}
+
+// UnmarshalJSON implements json.Unmarshaler
+func (msg *Publish) UnmarshalJSON(data []byte) error {
+	var res jsonPublish
+
+	if err := json.Unmarshal(data, &res); err != nil {
+		return err
+	}
+
+	msg.reset()
+
+	if err := msg.unmarshalHeader(&res.jsonHeader); err != nil {
+		return err
+	}
+
+	var payload []byte
+
+	switch res.Encoding {
+	case payloadEncodingUTF8:
+		payload = []byte(res.Payload)
+	case payloadEncodingBase64, "":
+		var err error
+		if payload, err = base64.StdEncoding.DecodeString(res.Payload); err != nil {
+			return err
+		}
+	default:
+		return ErrInvalidArgs
+	}
+
+	if len(payload) == 0 {
+		payload = nil
+	}
+
+	if err := msg.Set(res.Topic, payload, res.QoS, res.Retain, res.Dup); err != nil {
+		return err
+	}
+
+	if res.ExpireAt != nil {
+		msg.expireAt = *res.ExpireAt
+	}
+
+	return nil
+}
+
+// payloadIsUTF8 payload format indicator is set to UTF-8 and payload meets it
+func (msg *Publish) payloadIsUTF8() bool {
+	if prop := msg.PropertyGet(PropertyPayloadFormat); prop != nil {
+		if v, err := prop.AsByte(); err == nil && v == PayloadFormatUTF8 {
+			return utf8.Valid(msg.payload)
+		}
+	}
+
+	return false
+}
+
+// MarshalJSON implements json.Marshaler
+func (msg *ConnAck) MarshalJSON() ([]byte, error) {
+	h, err := msg.marshalHeader()
+	if err != nil {
+		return nil, err
+	}
+
+	res := jsonConnAck{
+		jsonHeader:     h,
+		SessionPresent: msg.sessionPresent,
+		ReturnCode:     marshalReasonCode(msg.mType, msg.returnCode),
+	}
+
+	return json.Marshal(&res)
+}
+
+// UnmarshalJSON implements json.Unmarshaler
+func (msg *ConnAck) UnmarshalJSON(data []byte) error {
+	var res jsonConnAck
+
+	if err := json.Unmarshal(data, &res); err != nil {
+		return err
+	}
+
+	msg.reset()
+
+	if err := msg.unmarshalHeader(&res.jsonHeader); err != nil {
+		return err
+	}
+
+	code := CodeSuccess
+	if len(res.ReturnCode) > 0 {
+		var err error
+		if code, err = unmarshalReasonCode(msg.mType, res.ReturnCode); err != nil {
+			return err
+		}
+	}
+
+	msg.SetSessionPresent(res.SessionPresent)
+
+	return msg.SetReturnCode(code)
+}
+
+// MarshalJSON implements json.Marshaler
+func (msg *Ack) MarshalJSON() ([]byte, error) {
+	return marshalReason(&msg.header, msg.reasonCode)
+}
+
+// UnmarshalJSON implements json.Unmarshaler
+func (msg *Ack) UnmarshalJSON(data []byte) error {
+	msg.reset()
+
+	code, err := unmarshalReason(&msg.header, data)
+	if err != nil {
+		return err
+	}
+
+	msg.SetReason(code)
+
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler
+func (msg *Disconnect) MarshalJSON() ([]byte, error) {
+	return marshalReason(&msg.header, msg.reasonCode)
+}
+
+// UnmarshalJSON implements json.Unmarshaler
+func (msg *Disconnect) UnmarshalJSON(data []byte) error {
+	msg.reset()
+
+	code, err := unmarshalReason(&msg.header, data)
+	if err != nil {
+		return err
+	}
+
+	msg.SetReasonCode(code)
+
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler
+func (msg *Auth) MarshalJSON() ([]byte, error) {
+	return marshalReason(&msg.header, msg.authReason)
+}
+
+// UnmarshalJSON implements json.Unmarshaler
+func (msg *Auth) UnmarshalJSON(data []byte) error {
+	msg.reset()
+
+	code, err := unmarshalReason(&msg.header, data)
+	if err != nil {
+		return err
+	}
+
+	if !code.IsValidForType(msg.mType) {
+		return ErrInvalidReturnCode
+	}
+
+	msg.authReason = code
+
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler
+func (msg *PingReq) MarshalJSON() ([]byte, error) {
+	return marshalReason(&msg.header, CodeSuccess)
+}
+
+// UnmarshalJSON implements json.Unmarshaler
+func (msg *PingReq) UnmarshalJSON(data []byte) error {
+	msg.reset()
+
+	_, err := unmarshalReason(&msg.header, data)
+	return err
+}
+
+// MarshalJSON implements json.Marshaler
+func (msg *PingResp) MarshalJSON() ([]byte, error) {
+	return marshalReason(&msg.header, CodeSuccess)
+}
+
+// UnmarshalJSON implements json.Unmarshaler
+func (msg *PingResp) UnmarshalJSON(data []byte) error {
+	msg.reset()
+
+	_, err := unmarshalReason(&msg.header, data)
+	return err
+}
+
+// MarshalJSON implements json.Marshaler
+func (msg *Subscribe) MarshalJSON() ([]byte, error) {
+	h, err := msg.marshalHeader()
+	if err != nil {
+		return nil, err
+	}
+
+	res := jsonSubscribe{
+		jsonHeader: h,
+		Topics:     make([]jsonSubscription, 0, len(msg.topics)),
+	}
+
+	for _, t := range msg.topics {
+		ops := t.Ops()
+		res.Topics = append(res.Topics, jsonSubscription{
+			Topic:             t.Full(),
+			QoS:               ops.QoS(),
+			NoLocal:           ops.NL(),
+			RetainAsPublished: ops.RAP(),
+			RetainHandling:    ops.RetainHandling(),
+		})
+	}
+
+	return json.Marshal(&res)
+}
+
+// UnmarshalJSON implements json.Unmarshaler
+func (msg *Subscribe) UnmarshalJSON(data []byte) error {
+	var res jsonSubscribe
+
+	if err := json.Unmarshal(data, &res); err != nil {
+		return err
+	}
+
+	msg.reset()
+
+	if err := msg.unmarshalHeader(&res.jsonHeader); err != nil {
+		return err
+	}
+
+	for _, s := range res.Topics {
+		ops := byte(s.QoS) | byte(s.RetainHandling)<<offsetSubscriptionRetainHandling
+		if s.NoLocal {
+			ops |= maskSubscriptionNL
+		}
+
+		if s.RetainAsPublished {
+			ops |= maskSubscriptionRAP
+		}
+
+		t, err := NewSubscribeTopic([]byte(s.Topic), SubscriptionOptions(ops))
+		if err != nil {
+			return err
+		}
+
+		if err = msg.AddTopic(t); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler
+func (msg *UnSubscribe) MarshalJSON() ([]byte, error) {
+	h, err := msg.marshalHeader()
+	if err != nil {
+		return nil, err
+	}
+
+	res := jsonUnSubscribe{
+		jsonHeader: h,
+		Topics:     make([]string, 0, len(msg.topics)),
+	}
+
+	for _, t := range msg.topics {
+		res.Topics = append(res.Topics, t.Full())
+	}
+
+	return json.Marshal(&res)
+}
+
+// UnmarshalJSON implements json.Unmarshaler
+func (msg *UnSubscribe) UnmarshalJSON(data []byte) error {
+	var res jsonUnSubscribe
+
+	if err := json.Unmarshal(data, &res); err != nil {
+		return err
+	}
+
+	msg.reset()
+
+	if err := msg.unmarshalHeader(&res.jsonHeader); err != nil {
+		return err
+	}
+
+	for _, s := range res.Topics {
+		t, err := NewTopic([]byte(s))
+		if err != nil {
+			return err
+		}
+
+		if err = msg.AddTopic(t); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler
+// return codes are rendered by name, e.g. "GrantedQoS1" or "NotAuthorized"
+func (msg *SubAck) MarshalJSON() ([]byte, error) {
+	return marshalReturnCodes(&msg.header, msg.returnCodes)
+}
+
+// UnmarshalJSON implements json.Unmarshaler
+func (msg *SubAck) UnmarshalJSON(data []byte) error {
+	msg.reset()
+
+	codes, err := unmarshalReturnCodes(&msg.header, data)
+	if err != nil {
+		return err
+	}
+
+	return msg.AddReturnCodes(codes)
+}
+
+// MarshalJSON implements json.Marshaler
+func (msg *UnSubAck) MarshalJSON() ([]byte, error) {
+	return marshalReturnCodes(&msg.header, msg.returnCodes)
+}
+
+// UnmarshalJSON implements json.Unmarshaler
+func (msg *UnSubAck) UnmarshalJSON(data []byte) error {
+	msg.reset()
+
+	codes, err := unmarshalReturnCodes(&msg.header, data)
+	if err != nil {
+		return err
+	}
+
+	return msg.AddReturnCodes(codes)
+}
+
+func marshalReason(h *header, code ReasonCode) ([]byte, error) {
+	jh, err := h.marshalHeader()
+	if err != nil {
+		return nil, err
+	}
+
+	res := jsonReason{
+		jsonHeader: jh,
+	}
+
+	if h.version >= ProtocolV50 && h.mType != PINGREQ && h.mType != PINGRESP {
+		res.Reason = marshalReasonCode(h.mType, code)
+	}
+
+	return json.Marshal(&res)
+}
+
+func unmarshalReason(h *header, data []byte) (ReasonCode, error) {
+	var res jsonReason
+
+	if err := json.Unmarshal(data, &res); err != nil {
+		return CodeSuccess, err
+	}
+
+	if err := h.unmarshalHeader(&res.jsonHeader); err != nil {
+		return CodeSuccess, err
+	}
+
+	if len(res.Reason) == 0 {
+		return CodeSuccess, nil
+	}
+
+	return unmarshalReasonCode(h.mType, res.Reason)
+}
+
+func marshalReturnCodes(h *header, codes []ReasonCode) ([]byte, error) {
+	jh, err := h.marshalHeader()
+	if err != nil {
+		return nil, err
+	}
+
+	res := jsonReturnCodes{
+		jsonHeader: jh,
+	}
+
+	for _, c := range codes {
+		res.ReturnCodes = append(res.ReturnCodes, marshalReasonCode(h.mType, c))
+	}
+
+	return json.Marshal(&res)
+}
+
+func unmarshalReturnCodes(h *header, data []byte) ([]ReasonCode, error) {
+	var res jsonReturnCodes
+
+	if err := json.Unmarshal(data, &res); err != nil {
+		return nil, err
+	}
+
+	if err := h.unmarshalHeader(&res.jsonHeader); err != nil {
+		return nil, err
+	}
+
+	codes := make([]ReasonCode, 0, len(res.ReturnCodes))
+
+	for _, raw := range res.ReturnCodes {
+		c, err := unmarshalReasonCode(h.mType, raw)
+		if err != nil {
+			return nil, err
+		}
+
+		codes = append(codes, c)
+	}
+
+	return codes, nil
+}
+
+// marshalReasonCode renders code by name, codes without name are rendered as numbers
+func marshalReasonCode(t Type, c ReasonCode) json.RawMessage {
+	if _, ok := reasonCodeByName(t, c.NameForType(t)); ok {
+		return json.RawMessage(strconv.Quote(c.NameForType(t)))
+	}
+
+	return json.RawMessage(strconv.Itoa(int(c)))
+}
+
+// unmarshalReasonCode accepts either name or numeric value of the code
+func unmarshalReasonCode(t Type, raw json.RawMessage) (ReasonCode, error) {
+	var name string
+
+	if err := json.Unmarshal(raw, &name); err == nil {
+		c, ok := reasonCodeByName(t, name)
+		if !ok {
+			return CodeSuccess, ErrInvalidReturnCode
+		}
+
+		return c, nil
+	}
+
+	var c ReasonCode
+	if err := json.Unmarshal(raw, &c); err != nil {
+		return CodeSuccess, err
+	}
+
+	return c, nil
+}
+
+func (h *header) marshalHeader() (jsonHeader, error) {
+	res := jsonHeader{
+		Type:    h.mType.Name(),
+		Version: h.version,
+	}
+
+	if id, err := h.ID(); err == nil {
+		res.ID = &id
+	}
+
+	if h.version < ProtocolV50 || len(h.properties.properties) == 0 {
+		return res, nil
+	}
+
+	res.Properties = make(map[string]json.RawMessage, len(h.properties.properties))
+
+	for id, val := range h.properties.properties {
+		raw, err := marshalProperty(id, val)
+		if err != nil {
+			return res, err
+		}
+
+		res.Properties[id.Name()] = raw
+	}
+
+	return res, nil
+}
+
+func (h *header) unmarshalHeader(jh *jsonHeader) error {
+	if jh.Type != h.mType.Name() {
+		return ErrInvalidMessageType
+	}
+
+	if jh.Version != ProtocolAuto {
+		h.version = jh.Version
+	}
+
+	if jh.ID != nil {
+		h.setPacketID(*jh.ID)
+	}
+
+	if len(jh.Properties) == 0 {
+		return nil
+	}
+
+	if h.version < ProtocolV50 {
+		return ErrNotSupported
+	}
+
+	if h.properties.properties == nil {
+		h.properties.reset()
+	}
+
+	for name, raw := range jh.Properties {
+		id, ok := propertyIDByName(name)
+		if !ok {
+			return ErrPropertyInvalidID
+		}
+
+		val, err := unmarshalProperty(id, raw)
+		if err != nil {
+			return err
+		}
+
+		if err = h.PropertySet(id, val); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// marshalProperty numbers and strings are rendered as is, binary data as base64
+// and user properties as list of key/value objects
+func marshalProperty(id PropertyID, val interface{}) (json.RawMessage, error) {
+	switch v := val.(type) {
+	case StringPair:
+		return json.Marshal([]jsonStringPair{{Key: v.K, Value: v.V}})
+	case []StringPair:
+		pairs := make([]jsonStringPair, 0, len(v))
+		for _, p := range v {
+			pairs = append(pairs, jsonStringPair{Key: p.K, Value: p.V})
+		}
+
+		return json.Marshal(pairs)
+	case []uint8:
+		if propertyTypeMap[id] == PropertyTypeByte {
+			nums := make([]uint32, 0, len(v))
+			for _, b := range v {
+				nums = append(nums, uint32(b))
+			}
+
+			return json.Marshal(nums)
+		}
+	}
+
+	return json.Marshal(val)
+}
+
+func unmarshalProperty(id PropertyID, raw json.RawMessage) (interface{}, error) {
+	var err error
+
+	switch propertyTypeMap[id] {
+	case PropertyTypeByte:
+		var v uint8
+		err = json.Unmarshal(raw, &v)
+		return v, err
+	case PropertyTypeShort:
+		var v uint16
+		err = json.Unmarshal(raw, &v)
+		return v, err
+	case PropertyTypeInt, PropertyTypeVarInt:
+		var v uint32
+		if err = json.Unmarshal(raw, &v); err == nil {
+			return v, nil
+		}
+
+		// duplicates such as subscription identifiers of PUBLISH
+		var list []uint32
+		err = json.Unmarshal(raw, &list)
+		return list, err
+	case PropertyTypeString:
+		var v string
+		err = json.Unmarshal(raw, &v)
+		return v, err
+	case PropertyTypeBinary:
+		var v []byte
+		err = json.Unmarshal(raw, &v)
+		return v, err
+	case PropertyTypeStringPair:
+		var pairs []jsonStringPair
+		if err = json.Unmarshal(raw, &pairs); err != nil {
+			return nil, err
+		}
+
+		res := make([]StringPair, 0, len(pairs))
+		for _, p := range pairs {
+			res = append(res, StringPair{K: p.Key, V: p.Value})
+		}
+
+		return res, nil
+	default:
+		return nil, ErrPropertyUnsupported
+	}
+}
+
+// typeByName reverse lookup of Type.Name
+func typeByName(name string) (Type, bool) {
+	for t, n := range typeName {
+		if n == name && Type(t) != RESERVED {
+			return Type(t), true
+		}
+	}
+
+	return RESERVED, false
+}
@@ -0,0 +1,182 @@
+package mqttp
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// requireJSONRoundTrip checks packet rendered to JSON and back renders into the same document
+// and has the same encoded size. Encoded bytes are not compared as order of properties is not defined
+func requireJSONRoundTrip(t *testing.T, m IFace) []byte {
+	data, err := json.Marshal(m)
+	require.NoError(t, err)
+
+	res, err := DecodeJSON(data)
+	require.NoError(t, err)
+	require.Equal(t, m.Type(), res.Type())
+	require.Equal(t, m.Version(), res.Version())
+
+	actual, err := json.Marshal(res)
+	require.NoError(t, err)
+	require.JSONEq(t, string(data), string(actual))
+
+	expected, err := m.Size()
+	require.NoError(t, err)
+
+	size, err := res.Size()
+	require.NoError(t, err)
+	require.Equal(t, expected, size)
+
+	_, err = Encode(res)
+	require.NoError(t, err)
+
+	return data
+}
+
+func TestJSONPublish(t *testing.T) {
+	pkt := NewPublish(ProtocolV50)
+	require.NoError(t, pkt.Set("a/b", []byte{0x00, 0xFF}, QoS1, true, false))
+	pkt.SetPacketID(7)
+	require.NoError(t, pkt.PropertySet(PropertyContentType, "application/octet-stream"))
+	require.NoError(t, pkt.PropertySet(PropertyCorrelationData, []byte{0x01, 0x02}))
+	require.NoError(t, pkt.PropertySet(PropertyUserProperty, []StringPair{{K: "k", V: "v"}}))
+
+	data := requireJSONRoundTrip(t, pkt)
+	require.Contains(t, string(data), `"encoding":"base64"`)
+	require.Contains(t, string(data), `"payload":"AP8="`)
+	require.Contains(t, string(data), `"ContentType":"application/octet-stream"`)
+	require.Contains(t, string(data), `"UserProperty":[{"key":"k","value":"v"}]`)
+
+	pkt = NewPublish(ProtocolV50)
+	require.NoError(t, pkt.Set("a/b", []byte("hello"), QoS0, false, false))
+	require.NoError(t, pkt.PropertySet(PropertyPayloadFormat, uint8(1)))
+
+	data = requireJSONRoundTrip(t, pkt)
+	require.Contains(t, string(data), `"encoding":"utf8"`)
+	require.Contains(t, string(data), `"payload":"hello"`)
+}
+
+func TestJSONConnectRedactPassword(t *testing.T) {
+	will := NewPublish(ProtocolV50)
+	require.NoError(t, will.Set("will", []byte("bye"), QoS1, true, false))
+	require.NoError(t, will.PropertySet(PropertyWillDelayInterval, uint32(10)))
+
+	pkt := NewConnect(ProtocolV50)
+	pkt.SetClean(true)
+	pkt.SetKeepAlive(30)
+	require.NoError(t, pkt.SetClientID([]byte("client")))
+	require.NoError(t, pkt.SetCredentials([]byte("user"), []byte("secret")))
+	require.NoError(t, pkt.SetWill(will))
+
+	data, err := json.Marshal(pkt)
+	require.NoError(t, err)
+	require.NotContains(t, string(data), "secret")
+	require.Contains(t, string(data), `"password":"`+Redacted+`"`)
+
+	res, err := DecodeJSON(data)
+	require.NoError(t, err)
+
+	conn := res.(*Connect)
+	require.True(t, conn.IsClean())
+	require.Equal(t, uint16(30), conn.KeepAlive())
+	require.Equal(t, []byte("client"), conn.ClientID())
+
+	user, pass := conn.Credentials()
+	require.Equal(t, []byte("user"), user)
+	require.Nil(t, pass)
+
+	require.NotNil(t, conn.Will())
+	require.Equal(t, "will", conn.Will().Topic())
+	require.Equal(t, []byte("bye"), conn.Will().Payload())
+	require.NotNil(t, conn.Will().PropertyGet(PropertyWillDelayInterval))
+
+	// fixtures may carry password in plain text
+	res, err = DecodeJSON([]byte(`{"type":"CONNECT","version":4,"clean":true,"clientID":"c","username":"u","password":"p"}`))
+	require.NoError(t, err)
+
+	_, pass = res.(*Connect).Credentials()
+	require.Equal(t, []byte("p"), pass)
+}
+
+func TestJSONAcks(t *testing.T) {
+	subAck := NewSubAck(ProtocolV50)
+	subAck.SetPacketID(3)
+	require.NoError(t, subAck.AddReturnCodes([]ReasonCode{CodeSuccess, ReasonCode(QoS2), CodeNotAuthorized}))
+
+	data := requireJSONRoundTrip(t, subAck)
+	require.Contains(t, string(data), `"returnCodes":["GrantedQoS0","GrantedQoS2","NotAuthorized"]`)
+
+	connAck := NewConnAck(ProtocolV311)
+	connAck.SetSessionPresent(true)
+	require.NoError(t, connAck.SetReturnCode(CodeRefusedNotAuthorized))
+
+	data = requireJSONRoundTrip(t, connAck)
+	require.Contains(t, string(data), `"returnCode":"RefusedNotAuthorized"`)
+
+	for _, pkt := range []*Ack{NewPubAck(ProtocolV50), NewPubRec(ProtocolV50), NewPubRel(ProtocolV50), NewPubComp(ProtocolV50)} {
+		pkt.SetPacketID(10)
+		pkt.SetReason(CodePacketIDNotFound)
+		require.NoError(t, pkt.PropertySet(PropertyReasonString, "reason"))
+
+		data = requireJSONRoundTrip(t, pkt)
+		require.Contains(t, string(data), `"reason":"PacketIDNotFound"`)
+	}
+
+	disconnect := NewDisconnect(ProtocolV50)
+	disconnect.SetReasonCode(CodeServerShuttingDown)
+	requireJSONRoundTrip(t, disconnect)
+
+	requireJSONRoundTrip(t, NewPingReq(ProtocolV311))
+	requireJSONRoundTrip(t, NewPingResp(ProtocolV311))
+}
+
+func TestJSONSubscribe(t *testing.T) {
+	pkt := NewSubscribe(ProtocolV50)
+	pkt.SetPacketID(1)
+
+	topic, err := NewSubscribeTopic([]byte("a/+"), SubscriptionOptions(byte(QoS1)|maskSubscriptionNL|maskSubscriptionRAP))
+	require.NoError(t, err)
+	require.NoError(t, pkt.AddTopic(topic))
+
+	topic, err = NewSubscribeTopic([]byte("$share/g/b/#"), SubscriptionOptions(byte(QoS2)))
+	require.NoError(t, err)
+	require.NoError(t, pkt.AddTopic(topic))
+
+	data := requireJSONRoundTrip(t, pkt)
+	require.Contains(t, string(data), `{"topic":"a/+","qos":1,"noLocal":true,"retainAsPublished":true}`)
+
+	unsub := NewUnSubscribe(ProtocolV311)
+	unsub.SetPacketID(2)
+
+	topic, err = NewTopic([]byte("a/#"))
+	require.NoError(t, err)
+	require.NoError(t, unsub.AddTopic(topic))
+
+	data = requireJSONRoundTrip(t, unsub)
+	require.Contains(t, string(data), `"topics":["a/#"]`)
+}
+
+func TestJSONInvalid(t *testing.T) {
+	_, err := DecodeJSON([]byte(`{"type":"UNKNOWN","version":5}`))
+	require.EqualError(t, err, ErrInvalidMessageType.Error())
+
+	// properties are not allowed for V3
+	_, err = DecodeJSON([]byte(`{"type":"PUBACK","version":4,"id":1,"properties":{"ReasonString":"r"}}`))
+	require.EqualError(t, err, ErrNotSupported.Error())
+
+	_, err = DecodeJSON([]byte(`{"type":"PUBACK","version":5,"id":1,"properties":{"Unknown":"r"}}`))
+	require.EqualError(t, err, ErrPropertyInvalidID.Error())
+
+	_, err = DecodeJSON([]byte(`{"type":"SUBACK","version":5,"id":1,"returnCodes":["NoSuchCode"]}`))
+	require.EqualError(t, err, ErrInvalidReturnCode.Error())
+
+	// numeric codes are accepted as well
+	m, err := DecodeJSON([]byte(`{"type":"SUBACK","version":5,"id":1,"returnCodes":[1,135]}`))
+	require.NoError(t, err)
+	require.Equal(t, []ReasonCode{ReasonCode(QoS1), CodeNotAuthorized}, m.(*SubAck).ReturnCodes())
+
+	pkt := NewPubAck(ProtocolV50)
+	require.EqualError(t, json.Unmarshal([]byte(`{"type":"PUBREC","version":5,"id":1}`), pkt), ErrInvalidMessageType.Error())
+}
@@ -1,9 +1,5 @@
 package mqttp
 
-import (
-	"fmt"
-)
-
 const (
 	// maxFixedHeaderLength int    = 5
 	maxRemainingLength int32 = (256 * 1024 * 1024) - 1 // 256 MB
@@ -24,7 +20,7 @@ const (
 	// RetainHandlingIfNotExists publish retained messages on subscribe only when it's new subscription to given topic
 	RetainHandlingIfNotExists
 	// RetainHandlingDoNotRetain do not publish retained messages on subscribe
-	// RetainHandlingDoNotRetain
+	RetainHandlingDoNotRetain
 )
 
 // SubscriptionOptions as per [MQTT-3.8.3.1]
@@ -131,6 +127,10 @@ type IFace interface {
 	// must be implemented by each packet implementation and returns remaining length
 	size() int
 
+	// reset must be implemented by each packet implementation and used by Release to bring
+	// packet into state of newly allocated one
+	reset()
+
 	// getHeader
 	getHeader() *header
 
@@ -205,8 +205,46 @@ func Encode(p IFace) ([]byte, error) {
 	return buf, err
 }
 
+// DecodeOptions controls how packets are decoded
+type DecodeOptions struct {
+	// Version protocol version used to decode packet
+	// ProtocolAuto (zero value) detects version from CONNECT packet,
+	// any other packet type is rejected with ErrInvalidProtocolVersion
+	Version ProtocolVersion
+
+	// MaxPacketSize maximum size of the whole packet including fixed header.
+	// Bigger packets rejected with CodePacketTooLarge
+	// 0 means limit defined by the spec (256MB)
+	MaxPacketSize uint32
+
+	// Lenient when set skips checks which are not required to parse packet
+	// correctly, for example client ID character set or control characters
+	// in user name
+	Lenient bool
+
+	// NoCopy when set PUBLISH payload and binary properties such as correlation data
+	// alias decode buffer instead of being copied. Buffer must not be modified or reused
+	// as long as packet is in use unless packet has been detached with Publish.Detach.
+	// Other packet types, e.g. CONNECT or AUTH with authentication data, are always copied
+	NoCopy bool
+
+	// Pooled when set packet is obtained with Acquire instead of New, thus decoding
+	// of packets like PUBACK does not allocate. Caller owns the packet and should
+	// return it with Release once done. Packet is released by decode on failure
+	Pooled bool
+}
+
 // Decode buf into message and return IFace type
-func Decode(v ProtocolVersion, buf []byte) (msg IFace, total int, err error) {
+func Decode(v ProtocolVersion, buf []byte) (IFace, int, error) {
+	return DecodeWithOptions(buf, DecodeOptions{Version: v})
+}
+
+// DecodeWithOptions decode buf into message according to options and return IFace type
+// Any failure is reported as *DecodeError. On ErrInsufficientDataSize total is the size
+// of the whole packet buffer expected to hold
+func DecodeWithOptions(buf []byte, opts DecodeOptions) (msg IFace, total int, err error) {
+	mType := RESERVED
+
 	defer func() {
 		// TODO(troian): this case might be improved
 		// Panic might be provided during message decode with malformed len
@@ -222,27 +260,61 @@ func Decode(v ProtocolVersion, buf []byte) (msg IFace, total int, err error) {
 		// but it might be worth doing such checks (there might be many for each message) on each decode
 		// as it is abnormal and server must close connection
 		if r := recover(); r != nil {
-			fmt.Println(r)
+			if opts.Pooled && msg != nil {
+				Release(msg)
+			}
+
 			msg = nil
 			total = 0
-			err = ErrPanicDetected
+			err = newDecodeError(mType, 0, ErrPanicDetected)
 		}
 	}()
 
 	if len(buf) < 1 {
-		return nil, 0, ErrInsufficientBufferSize
+		return nil, 0, newDecodeError(mType, 0, ErrInsufficientBufferSize)
 	}
 
 	// [MQTT-2.2]
-	mType := Type(buf[0] >> offsetPacketType)
+	mType = Type(buf[0] >> offsetPacketType)
+
+	if opts.MaxPacketSize > 0 {
+		// [MQTT-2.2.3] incomplete remaining length is reported by header decode
+		if remLen, m := uvarint(buf[1:]); m > 0 && uint64(1+m)+uint64(remLen) > uint64(opts.MaxPacketSize) {
+			return nil, 0, newDecodeError(mType, 0, CodePacketTooLarge)
+		}
+	}
+
+	v := opts.Version
+	if v == ProtocolAuto {
+		if v, err = detectVersion(buf); err != nil {
+			return nil, 0, newDecodeError(mType, 0, err)
+		}
+	}
 
 	// [MQTT-2.2.1] Type.New validates message type
-	if msg, err = New(v, mType); err != nil {
-		return nil, 0, err
+	if opts.Pooled {
+		msg, err = Acquire(v, mType)
+	} else {
+		msg, err = New(v, mType)
+	}
+
+	if err != nil {
+		return nil, 0, newDecodeError(mType, 0, err)
 	}
 
+	msg.getHeader().setDecodeOptions(&opts)
+
 	if total, err = msg.decode(buf); err != nil {
-		return nil, total, err
+		if opts.Pooled {
+			Release(msg)
+		}
+
+		offset := total
+		if offset > len(buf) {
+			offset = len(buf)
+		}
+
+		return nil, total, newDecodeError(mType, offset, err)
 	}
 
 	return msg, total, nil
@@ -254,3 +326,34 @@ func Decode(v ProtocolVersion, buf []byte) (msg IFace, total int, err error) {
 func ValidTopic(topic []byte) bool {
 	return IsValidUTF(topic) && TopicPublishRegexp.Match(topic)
 }
+
+// detectVersion peeks protocol level from CONNECT packet
+func detectVersion(buf []byte) (ProtocolVersion, error) {
+	if Type(buf[0]>>offsetPacketType) != CONNECT {
+		return ProtocolAuto, ErrInvalidProtocolVersion
+	}
+
+	_, m := uvarint(buf[1:])
+	if m <= 0 {
+		return ProtocolAuto, ErrInsufficientDataSize
+	}
+
+	offset := 1 + m
+
+	// V3.1.1 [MQTT-3.1.2.1]
+	// V5.0   [MQTT-3.1.2.1]
+	_, n, err := ReadLPBytes(buf[offset:])
+	if err != nil {
+		return ProtocolAuto, err
+	}
+
+	offset += n
+
+	if len(buf) <= offset {
+		return ProtocolAuto, ErrInsufficientDataSize
+	}
+
+	// V3.1.1 [MQTT-3.1.2.2]
+	// V5.0   [MQTT-3.1.2.2]
+	return ProtocolVersion(buf[offset]), nil
+}
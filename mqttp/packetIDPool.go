@@ -0,0 +1,263 @@
+package mqttp
+
+import (
+	"encoding/binary"
+	"math/bits"
+	"sync"
+)
+
+// maxPacketIDs number of valid packet IDs, 0 is not allowed [MQTT-2.2.1-3]
+const maxPacketIDs = 1<<16 - 1
+
+// PacketIDPool hands out packet identifiers of single session and tracks ones in-flight
+// IDs are allocated sequentially starting right after the last one allocated thus
+// released ID is not reused until the whole range wraps around. It reduces chance of
+// late acknowledgment being matched against unrelated packet
+//
+// Pool does not depend on vlpersistence. To restore session either
+//
+//	feed each PersistedPacket.Data of PersistedPackets.QoS12 and PersistedPackets.UnAck into ReserveEncoded
+//	or keep Snapshot/MarshalBinary output next to PersistedPackets and pass it to Restore/UnmarshalBinary
+type PacketIDPool struct {
+	lock  sync.Mutex
+	used  [(maxPacketIDs + 1) / 64]uint64
+	count int
+	next  IDType
+}
+
+// NewPacketIDPool allocate empty pool
+func NewPacketIDPool() *PacketIDPool {
+	return &PacketIDPool{
+		next: 1,
+	}
+}
+
+// Acquire allocate next free ID
+// Returns ErrPacketIDExhausted if all 65535 IDs are in-flight
+func (p *PacketIDPool) Acquire() (IDType, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if p.count == maxPacketIDs {
+		return 0, ErrPacketIDExhausted
+	}
+
+	id := p.next
+
+	// loop terminates as at least one ID is free
+	for {
+		if id == 0 {
+			id = 1
+		}
+
+		if free := ^p.used[id>>6] >> (id & 63); free != 0 {
+			id += IDType(bits.TrailingZeros64(free))
+			break
+		}
+
+		// rest of the word is taken, jump to first ID of next one
+		// IDType overflows to 0 after last word which is skipped above
+		id = (id | 63) + 1
+	}
+
+	p.set(id)
+	p.next = id + 1
+
+	return id, nil
+}
+
+// Reserve mark ID as in-flight, e.g. when restored from persistence
+// Returns ErrPackedIDZero for 0 and CodePacketIDInUse if ID is already in-flight
+func (p *PacketIDPool) Reserve(id IDType) error {
+	if id == 0 {
+		return ErrPackedIDZero
+	}
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if p.test(id) {
+		return CodePacketIDInUse
+	}
+
+	p.set(id)
+
+	return nil
+}
+
+// ReserveEncoded reserve ID of encoded packet, e.g. PersistedPacket.Data
+// Packets without ID such as QoS 0 PUBLISH are ignored
+func (p *PacketIDPool) ReserveEncoded(v ProtocolVersion, data []byte) error {
+	m, _, err := Decode(v, data)
+	if err != nil {
+		return err
+	}
+
+	id, err := m.ID()
+	if err == ErrNotSet {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return p.Reserve(id)
+}
+
+// Release return ID to the pool
+// returns false if ID has not been in-flight
+func (p *PacketIDPool) Release(id IDType) bool {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if id == 0 || !p.test(id) {
+		return false
+	}
+
+	p.used[id>>6] &^= 1 << (id & 63)
+	p.count--
+
+	return true
+}
+
+// InUse check if ID is in-flight
+func (p *PacketIDPool) InUse(id IDType) bool {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	return p.test(id)
+}
+
+// Len number of IDs in-flight
+func (p *PacketIDPool) Len() int {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	return p.count
+}
+
+// Reset release all IDs
+func (p *PacketIDPool) Reset() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.reset()
+}
+
+// Snapshot IDs in-flight in ascending order
+func (p *PacketIDPool) Snapshot() []IDType {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	return p.snapshot()
+}
+
+func (p *PacketIDPool) snapshot() []IDType {
+	ids := make([]IDType, 0, p.count)
+
+	for w, word := range p.used {
+		for word != 0 {
+			bit := bits.TrailingZeros64(word)
+			ids = append(ids, IDType(w<<6|bit))
+			word &= word - 1
+		}
+	}
+
+	return ids
+}
+
+// Restore replace IDs in-flight with ids
+// Returns CodePacketIDInUse if ids has duplicates, pool is left empty on error
+func (p *PacketIDPool) Restore(ids []IDType) error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.reset()
+
+	var last IDType
+
+	for _, id := range ids {
+		var err error
+
+		if id == 0 {
+			err = ErrPackedIDZero
+		} else if p.test(id) {
+			err = CodePacketIDInUse
+		}
+
+		if err != nil {
+			p.reset()
+			return err
+		}
+
+		p.set(id)
+
+		if id > last {
+			last = id
+		}
+	}
+
+	// continue after highest ID restored as cursor itself is not known
+	p.next = last + 1
+
+	return nil
+}
+
+// MarshalBinary encode allocation cursor followed by IDs in-flight, 2 bytes each big endian
+func (p *PacketIDPool) MarshalBinary() ([]byte, error) {
+	p.lock.Lock()
+	ids := p.snapshot()
+	next := p.next
+	p.lock.Unlock()
+
+	buf := make([]byte, 2+2*len(ids))
+	binary.BigEndian.PutUint16(buf, uint16(next))
+
+	for i, id := range ids {
+		binary.BigEndian.PutUint16(buf[2+2*i:], uint16(id))
+	}
+
+	return buf, nil
+}
+
+// UnmarshalBinary restore pool encoded by MarshalBinary
+func (p *PacketIDPool) UnmarshalBinary(data []byte) error {
+	if len(data) < 2 || len(data)%2 != 0 {
+		return ErrInvalidLength
+	}
+
+	ids := make([]IDType, 0, len(data)/2-1)
+	for i := 2; i < len(data); i += 2 {
+		ids = append(ids, IDType(binary.BigEndian.Uint16(data[i:])))
+	}
+
+	if err := p.Restore(ids); err != nil {
+		return err
+	}
+
+	p.lock.Lock()
+	p.next = IDType(binary.BigEndian.Uint16(data))
+	p.lock.Unlock()
+
+	return nil
+}
+
+func (p *PacketIDPool) test(id IDType) bool {
+	return p.used[id>>6]&(1<<(id&63)) != 0
+}
+
+// set mark ID as used, caller must ensure it is free
+func (p *PacketIDPool) set(id IDType) {
+	p.used[id>>6] |= 1 << (id & 63)
+	p.count++
+}
+
+func (p *PacketIDPool) reset() {
+	for i := range p.used {
+		p.used[i] = 0
+	}
+
+	p.count = 0
+	p.next = 1
+}
@@ -0,0 +1,142 @@
+package mqttp
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPacketIDPoolAcquire(t *testing.T) {
+	p := NewPacketIDPool()
+
+	id, err := p.Acquire()
+	require.NoError(t, err)
+	require.Equal(t, IDType(1), id)
+
+	id, err = p.Acquire()
+	require.NoError(t, err)
+	require.Equal(t, IDType(2), id)
+
+	// released ID is not reused right away
+	require.True(t, p.Release(1))
+	require.False(t, p.Release(1))
+	require.False(t, p.Release(0))
+
+	id, err = p.Acquire()
+	require.NoError(t, err)
+	require.Equal(t, IDType(3), id)
+	require.Equal(t, 2, p.Len())
+}
+
+func TestPacketIDPoolWrapAround(t *testing.T) {
+	p := NewPacketIDPool()
+
+	require.NoError(t, p.Restore([]IDType{1, 65534}))
+
+	id, err := p.Acquire()
+	require.NoError(t, err)
+	require.Equal(t, IDType(65535), id)
+
+	// 0 is skipped as well as 1 which is still in-flight
+	id, err = p.Acquire()
+	require.NoError(t, err)
+	require.Equal(t, IDType(2), id)
+	require.False(t, p.InUse(0))
+}
+
+func TestPacketIDPoolExhausted(t *testing.T) {
+	p := NewPacketIDPool()
+
+	for i := 1; i <= maxPacketIDs; i++ {
+		id, err := p.Acquire()
+		require.NoError(t, err)
+		require.Equal(t, IDType(i), id)
+	}
+
+	_, err := p.Acquire()
+	require.Equal(t, ErrPacketIDExhausted, err)
+
+	// the only free ID is found regardless of cursor position
+	require.True(t, p.Release(4242))
+
+	id, err := p.Acquire()
+	require.NoError(t, err)
+	require.Equal(t, IDType(4242), id)
+
+	p.Reset()
+	require.Equal(t, 0, p.Len())
+}
+
+func TestPacketIDPoolReserve(t *testing.T) {
+	p := NewPacketIDPool()
+
+	require.Equal(t, ErrPackedIDZero, p.Reserve(0))
+	require.NoError(t, p.Reserve(2))
+	require.Equal(t, CodePacketIDInUse, p.Reserve(2))
+
+	pub := NewPublish(ProtocolV50)
+	require.NoError(t, pub.Set("a", []byte("data"), QoS1, false, false))
+	pub.SetPacketID(5)
+
+	buf, err := Encode(pub)
+	require.NoError(t, err)
+	require.NoError(t, p.ReserveEncoded(ProtocolV50, buf))
+	require.Equal(t, CodePacketIDInUse, p.ReserveEncoded(ProtocolV50, buf))
+
+	rel := NewPubRel(ProtocolV311)
+	rel.SetPacketID(2)
+
+	buf, err = Encode(rel)
+	require.NoError(t, err)
+	require.Equal(t, CodePacketIDInUse, p.ReserveEncoded(ProtocolV311, buf))
+
+	// QoS 0 does not hold ID
+	pub = NewPublish(ProtocolV311)
+	require.NoError(t, pub.Set("a", []byte("data"), QoS0, false, false))
+
+	buf, err = Encode(pub)
+	require.NoError(t, err)
+	require.NoError(t, p.ReserveEncoded(ProtocolV311, buf))
+
+	id, err := p.Acquire()
+	require.NoError(t, err)
+	require.Equal(t, IDType(1), id)
+
+	id, err = p.Acquire()
+	require.NoError(t, err)
+	require.Equal(t, IDType(3), id)
+}
+
+func TestPacketIDPoolSnapshot(t *testing.T) {
+	p := NewPacketIDPool()
+
+	for i := 0; i < 100; i++ {
+		_, err := p.Acquire()
+		require.NoError(t, err)
+	}
+
+	for i := IDType(1); i <= 100; i += 2 {
+		require.True(t, p.Release(i))
+	}
+
+	ids := p.Snapshot()
+	require.Len(t, ids, 50)
+	require.Equal(t, IDType(2), ids[0])
+	require.Equal(t, IDType(100), ids[49])
+
+	data, err := p.MarshalBinary()
+	require.NoError(t, err)
+
+	restored := NewPacketIDPool()
+	require.NoError(t, restored.UnmarshalBinary(data))
+	require.Equal(t, ids, restored.Snapshot())
+
+	// cursor is restored as well
+	id, err := restored.Acquire()
+	require.NoError(t, err)
+	require.Equal(t, IDType(101), id)
+
+	require.Equal(t, ErrInvalidLength, restored.UnmarshalBinary([]byte{0x00}))
+	require.Equal(t, CodePacketIDInUse, restored.Restore([]IDType{1, 1}))
+	require.Equal(t, 0, restored.Len())
+}
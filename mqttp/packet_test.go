@@ -15,6 +15,7 @@
 package mqttp
 
 import (
+	"errors"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -167,7 +168,7 @@ func TestMessageDecode(t *testing.T) {
 
 	_, n, err := Decode(ProtocolV311, buf)
 	require.Equal(t, 0, n)
-	require.EqualError(t, err, ErrInsufficientBufferSize.Error())
+	requireErrorIs(t, err, ErrInsufficientBufferSize)
 
 	buf = make([]byte, 1)
 	buf[0] = 0x0F << offsetPacketType
@@ -176,3 +177,115 @@ func TestMessageDecode(t *testing.T) {
 	require.Error(t, err)
 	require.Equal(t, 0, n)
 }
+
+func TestDecodeOptionsMaxPacketSize(t *testing.T) {
+	pkt := NewPublish(ProtocolV50)
+	err := pkt.Set("topic", []byte("payload"), QoS0, false, false)
+	require.NoError(t, err)
+
+	buf, err := Encode(pkt)
+	require.NoError(t, err)
+
+	_, _, err = DecodeWithOptions(buf, DecodeOptions{Version: ProtocolV50, MaxPacketSize: uint32(len(buf) - 1)})
+	requireErrorIs(t, err, CodePacketTooLarge)
+
+	_, n, err := DecodeWithOptions(buf, DecodeOptions{Version: ProtocolV50, MaxPacketSize: uint32(len(buf))})
+	require.NoError(t, err)
+	require.Equal(t, len(buf), n)
+}
+
+func TestDecodeOptionsAutoVersion(t *testing.T) {
+	for _, v := range []ProtocolVersion{ProtocolV31, ProtocolV311, ProtocolV50} {
+		pkt := NewConnect(v)
+		pkt.SetClean(true)
+		buf, err := Encode(pkt)
+		require.NoError(t, err)
+
+		m, _, err := DecodeWithOptions(buf, DecodeOptions{Version: ProtocolAuto})
+		require.NoError(t, err)
+		require.Equal(t, v, m.Version())
+	}
+
+	buf, err := Encode(NewPingReq(ProtocolV311))
+	require.NoError(t, err)
+
+	_, _, err = DecodeWithOptions(buf, DecodeOptions{})
+	requireErrorIs(t, err, ErrInvalidProtocolVersion)
+
+	// truncated CONNECT
+	_, _, err = DecodeWithOptions([]byte{byte(CONNECT << offsetPacketType), 10, 0, 4, 'M'}, DecodeOptions{})
+	requireErrorIs(t, err, ErrInsufficientDataSize)
+}
+
+func TestDecodeOptionsLenient(t *testing.T) {
+	buf := []byte{
+		byte(CONNECT << 4),
+		22,
+		0, // Length MSB (0)
+		4, // Length LSB (4)
+		'M', 'Q', 'T', 'T',
+		4,   // Protocol level 4
+		130, // connect flags 10000010, user name and clean session
+		0,   // Keep Alive MSB (0)
+		10,  // Keep Alive LSB (10)
+		0,   // Client ID MSB (0)
+		4,   // Client ID LSB (4)
+		'c', 'l', '#', 'd',
+		0, // Username ID MSB (0)
+		4, // Username ID LSB (4)
+		'u', 's', 0x1F, 'r',
+	}
+
+	_, _, err := Decode(ProtocolV311, buf)
+	require.Error(t, err)
+
+	m, _, err := DecodeWithOptions(buf, DecodeOptions{Version: ProtocolV311, Lenient: true})
+	require.NoError(t, err)
+	require.Equal(t, []byte("cl#d"), m.(*Connect).ClientID())
+
+	// U+0000 is not allowed in any mode
+	buf[len(buf)-2] = 0
+	_, _, err = DecodeWithOptions(buf, DecodeOptions{Version: ProtocolV311, Lenient: true})
+	require.Error(t, err)
+}
+
+// requireErrorIs checks err wraps target
+func requireErrorIs(t *testing.T, err error, target error) {
+	t.Helper()
+
+	require.Error(t, err)
+	require.True(t, errors.Is(err, target), "expected %q, actual %q", target, err)
+}
+
+func TestDecodeError(t *testing.T) {
+	buf := []byte{
+		byte(PUBLISH<<offsetPacketType) | 1<<3,
+		7,    // remaining length
+		0, 5, // topic length
+		't', 'o', 'p', 'i', 'c',
+	}
+
+	_, _, err := Decode(ProtocolV50, buf)
+
+	var dErr *DecodeError
+	require.True(t, errors.As(err, &dErr))
+	require.Equal(t, PUBLISH, dErr.Type)
+	require.Equal(t, "MQTT-3.3.1-2", dErr.Rule)
+	require.Equal(t, 2, dErr.Offset)
+
+	var code ReasonCode
+	require.True(t, errors.As(err, &code))
+	require.Equal(t, CodeMalformedPacket, code)
+
+	require.Equal(t, "mqttp: decode PUBLISH at offset 2: Malformed Packet [MQTT-3.3.1-2]", err.Error())
+
+	// reserved bits of fixed header
+	buf = []byte{byte(PUBACK<<offsetPacketType) | 1, 2, 0, 1}
+
+	_, _, err = Decode(ProtocolV50, buf)
+	require.True(t, errors.As(err, &dErr))
+	require.Equal(t, PUBACK, dErr.Type)
+	require.Equal(t, "MQTT-2.2.2-1", dErr.Rule)
+	require.Equal(t, 0, dErr.Offset)
+	requireErrorIs(t, err, CodeMalformedPacket)
+}
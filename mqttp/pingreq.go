@@ -49,3 +49,7 @@ func (msg *PingReq) encodeMessage(dst []byte) (int, error) {
 func (msg *PingReq) size() int {
 	return 0
 }
+
+func (msg *PingReq) reset() {
+	msg.resetHeader()
+}
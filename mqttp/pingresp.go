@@ -46,3 +46,7 @@ func (msg *PingResp) encodeMessage(dst []byte) (int, error) {
 func (msg *PingResp) size() int {
 	return 0
 }
+
+func (msg *PingResp) reset() {
+	msg.resetHeader()
+}
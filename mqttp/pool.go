@@ -0,0 +1,59 @@
+package mqttp
+
+import (
+	"sync"
+)
+
+// pools keeps released packets per packet type
+var pools [AUTH + 1]sync.Pool
+
+func init() {
+	for t := CONNECT; t <= AUTH; t++ {
+		pType := t
+		pools[t].New = func() interface{} {
+			// version is set by Acquire, properties allocated only for v5.0
+			v := ProtocolV311
+			if pType == AUTH {
+				v = ProtocolV50
+			}
+
+			m, _ := newMessage(v, pType)
+			return m
+		}
+	}
+}
+
+// Acquire packet of given type from the pool
+// Packets obtained with Acquire are equal to ones allocated by New
+// and might be returned back to the pool with Release
+func Acquire(v ProtocolVersion, t Type) (IFace, error) {
+	if t <= RESERVED || t > AUTH || (t == AUTH && v < ProtocolV50) {
+		return nil, ErrInvalidMessageType
+	}
+
+	m := pools[t].Get().(IFace)
+	m.SetVersion(v)
+
+	if h := m.getHeader(); v >= ProtocolV50 && h.properties.properties == nil {
+		h.properties.reset()
+	}
+
+	return m, nil
+}
+
+// Release packet back to the pool
+// All data set or decoded is discarded, thus neither packet nor values returned by its
+// getters (payload, topics, properties) must be used after Release.
+func Release(m IFace) {
+	if m == nil {
+		return
+	}
+
+	t := m.Type()
+	if t <= RESERVED || t > AUTH {
+		return
+	}
+
+	m.reset()
+	pools[t].Put(m)
+}
@@ -0,0 +1,47 @@
+//go:build !race
+// +build !race
+
+package mqttp
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// sync.Pool drops items at random under race detector thus allocations are checked without it
+
+func TestPoolDecodeAckNoAlloc(t *testing.T) {
+	buf := []byte{0x40, 0x02, 0x00, 0x0a}
+	opts := DecodeOptions{Version: ProtocolV311, Pooled: true}
+
+	allocs := testing.AllocsPerRun(100, func() {
+		m, _, err := DecodeWithOptions(buf, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		Release(m)
+	})
+
+	require.Zero(t, allocs)
+}
+
+func TestPoolDecodePanicRelease(t *testing.T) {
+	// CONNACK without variable header panics on decode
+	buf := []byte{0x20, 0x00}
+
+	decodeAllocs := func(pooled bool) float64 {
+		opts := DecodeOptions{Version: ProtocolV311, Pooled: pooled}
+
+		return testing.AllocsPerRun(100, func() {
+			if _, _, err := DecodeWithOptions(buf, opts); !errors.Is(err, ErrPanicDetected) {
+				t.Fatal(err)
+			}
+		})
+	}
+
+	// message taken from the pool is put back thus it is not allocated on each decode
+	require.Less(t, decodeAllocs(true), decodeAllocs(false))
+}
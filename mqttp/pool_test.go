@@ -0,0 +1,184 @@
+package mqttp
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPoolAcquireInvalid(t *testing.T) {
+	_, err := Acquire(ProtocolV311, RESERVED)
+	require.EqualError(t, err, ErrInvalidMessageType.Error())
+
+	_, err = Acquire(ProtocolV311, AUTH)
+	require.EqualError(t, err, ErrInvalidMessageType.Error())
+
+	m, err := Acquire(ProtocolV50, AUTH)
+	require.NoError(t, err)
+	require.Equal(t, AUTH, m.Type())
+}
+
+func TestPoolAcquireType(t *testing.T) {
+	for pt := CONNECT; pt < AUTH; pt++ {
+		m, err := Acquire(ProtocolV311, pt)
+		require.NoError(t, err)
+		require.Equal(t, pt, m.Type())
+		require.Equal(t, ProtocolV311, m.Version())
+		require.Equal(t, pt.DefaultFlags(), m.getHeader().mFlags)
+
+		Release(m)
+	}
+}
+
+// requireClean checks acquired packet carries no state of the previous user
+func requireClean(t *testing.T, m IFace) {
+	_, err := m.ID()
+	require.EqualError(t, err, ErrNotSet.Error())
+	require.Empty(t, m.getHeader().properties.properties)
+	require.Equal(t, 0, m.getHeader().properties.len)
+	require.Equal(t, m.Type().DefaultFlags(), m.getHeader().mFlags)
+
+	switch msg := m.(type) {
+	case *Publish:
+		require.Empty(t, msg.Topic())
+		require.Nil(t, msg.Payload())
+		require.Zero(t, msg.PublishID())
+		_, _, expired := msg.Expired()
+		require.False(t, expired)
+	case *Ack:
+		require.Equal(t, CodeSuccess, msg.Reason())
+	case *Connect:
+		require.Nil(t, msg.ClientID())
+		require.Nil(t, msg.Will())
+		u, p := msg.Credentials()
+		require.Nil(t, u)
+		require.Nil(t, p)
+	case *Subscribe:
+		require.Empty(t, msg.topics)
+	case *UnSubscribe:
+		require.Empty(t, msg.topics)
+	case *SubAck:
+		require.Empty(t, msg.ReturnCodes())
+	}
+}
+
+func TestPoolNoLeak(t *testing.T) {
+	wg := sync.WaitGroup{}
+
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(id int) {
+			defer wg.Done()
+
+			for j := 0; j < 500; j++ {
+				for _, pt := range []Type{PUBLISH, PUBACK, PUBREC, PUBREL, PUBCOMP, CONNECT, SUBSCRIBE, UNSUBSCRIBE, SUBACK} {
+					m, err := Acquire(ProtocolV50, pt)
+					require.NoError(t, err)
+
+					requireClean(t, m)
+
+					switch msg := m.(type) {
+					case *Publish:
+						require.NoError(t, msg.Set("a/b", []byte{byte(id)}, QoS1, true, true))
+						msg.SetPacketID(IDType(j + 1))
+						msg.SetPublishID(uintptr(id))
+						require.NoError(t, msg.PropertySet(PropertyContentType, "text/plain"))
+					case *Ack:
+						msg.SetPacketID(IDType(j + 1))
+						msg.SetReason(CodePacketIDNotFound)
+						require.NoError(t, msg.PropertySet(PropertyReasonString, "reason"))
+					case *Connect:
+						require.NoError(t, msg.SetClientID([]byte("client")))
+						require.NoError(t, msg.SetCredentials([]byte("user"), []byte("pass")))
+					case *Subscribe:
+						topic, err := NewSubscribeTopic([]byte("a/+"), SubscriptionOptions(QoS1))
+						require.NoError(t, err)
+						require.NoError(t, msg.AddTopic(topic))
+						msg.SetPacketID(IDType(j + 1))
+					case *UnSubscribe:
+						topic, err := NewTopic([]byte("a/#"))
+						require.NoError(t, err)
+						require.NoError(t, msg.AddTopic(topic))
+						msg.SetPacketID(IDType(j + 1))
+					case *SubAck:
+						require.NoError(t, msg.AddReturnCode(CodeNotAuthorized))
+						msg.SetPacketID(IDType(j + 1))
+					}
+
+					_, err = Encode(m)
+					require.NoError(t, err)
+
+					Release(m)
+				}
+			}
+		}(i)
+	}
+
+	wg.Wait()
+}
+
+func TestPoolAcquireProperties(t *testing.T) {
+	m, err := Acquire(ProtocolV311, PUBACK)
+	require.NoError(t, err)
+	Release(m)
+
+	m, err = Acquire(ProtocolV50, PUBACK)
+	require.NoError(t, err)
+	require.NotNil(t, m.getHeader().properties.properties)
+	require.NoError(t, m.PropertySet(PropertyReasonString, "reason"))
+	Release(m)
+}
+
+func TestPoolDecode(t *testing.T) {
+	for _, v := range []ProtocolVersion{ProtocolV311, ProtocolV50} {
+		for _, pt := range []Type{PUBACK, PUBREC, PUBREL, PUBCOMP} {
+			ack, err := New(v, pt)
+			require.NoError(t, err)
+			ack.(*Ack).SetPacketID(10)
+
+			buf, err := Encode(ack)
+			require.NoError(t, err)
+
+			m, _, err := DecodeWithOptions(buf, DecodeOptions{Version: v, Pooled: true})
+			require.NoError(t, err)
+			require.Equal(t, pt, m.Type())
+			require.Equal(t, v, m.Version())
+
+			id, err := m.ID()
+			require.NoError(t, err)
+			require.Equal(t, IDType(10), id)
+
+			Release(m)
+		}
+	}
+
+	_, _, err := DecodeWithOptions([]byte{0x40, 0x02, 0x00}, DecodeOptions{Version: ProtocolV311, Pooled: true})
+	require.Error(t, err)
+}
+
+func BenchmarkDecodePooledAck(b *testing.B) {
+	for _, v := range []ProtocolVersion{ProtocolV311, ProtocolV50} {
+		ack := NewPubAck(v)
+		ack.SetPacketID(10)
+
+		buf, err := Encode(ack)
+		require.NoError(b, err)
+
+		opts := DecodeOptions{Version: v, Pooled: true}
+
+		b.Run(fmt.Sprintf("v%d", v), func(b *testing.B) {
+			b.ReportAllocs()
+
+			for i := 0; i < b.N; i++ {
+				m, _, err := DecodeWithOptions(buf, opts)
+				if err != nil {
+					b.Fatal(err)
+				}
+
+				Release(m)
+			}
+		})
+	}
+}
@@ -2,6 +2,8 @@ package mqttp
 
 import (
 	"encoding/binary"
+	"math"
+	"time"
 	"unicode/utf8"
 )
 
@@ -136,6 +138,7 @@ func (t *propertyToType) AsBinary() ([]byte, error) {
 type property struct {
 	properties map[PropertyID]interface{}
 	len        int
+	noCopy     bool
 }
 
 const (
@@ -168,6 +171,36 @@ const (
 	PropertySharedSubscriptionAvailable     = PropertyID(0x2A)
 )
 
+var propertyNameMap = map[PropertyID]string{
+	PropertyPayloadFormat:                   "PayloadFormat",
+	PropertyPublicationExpiry:               "PublicationExpiry",
+	PropertyContentType:                     "ContentType",
+	PropertyResponseTopic:                   "ResponseTopic",
+	PropertyCorrelationData:                 "CorrelationData",
+	PropertySubscriptionIdentifier:          "SubscriptionIdentifier",
+	PropertySessionExpiryInterval:           "SessionExpiryInterval",
+	PropertyAssignedClientIdentifier:        "AssignedClientIdentifier",
+	PropertyServerKeepAlive:                 "ServerKeepAlive",
+	PropertyAuthMethod:                      "AuthMethod",
+	PropertyAuthData:                        "AuthData",
+	PropertyRequestProblemInfo:              "RequestProblemInfo",
+	PropertyWillDelayInterval:               "WillDelayInterval",
+	PropertyRequestResponseInfo:             "RequestResponseInfo",
+	PropertyResponseInfo:                    "ResponseInfo",
+	PropertyServerReverence:                 "ServerReference",
+	PropertyReasonString:                    "ReasonString",
+	PropertyReceiveMaximum:                  "ReceiveMaximum",
+	PropertyTopicAliasMaximum:               "TopicAliasMaximum",
+	PropertyTopicAlias:                      "TopicAlias",
+	PropertyMaximumQoS:                      "MaximumQoS",
+	PropertyRetainAvailable:                 "RetainAvailable",
+	PropertyUserProperty:                    "UserProperty",
+	PropertyMaximumPacketSize:               "MaximumPacketSize",
+	PropertyWildcardSubscriptionAvailable:   "WildcardSubscriptionAvailable",
+	PropertySubscriptionIdentifierAvailable: "SubscriptionIdentifierAvailable",
+	PropertySharedSubscriptionAvailable:     "SharedSubscriptionAvailable",
+}
+
 const (
 	PropertyTypeByte = iota
 	PropertyTypeShort
@@ -232,6 +265,9 @@ var propertyAllowedMessageTypes = map[PropertyID]map[Type]bool{
 	PropertySharedSubscriptionAvailable:     {CONNACK: false},
 }
 
+// typed accessors of packets are generated from propertyTypeMap and propertyAllowedMessageTypes
+//go:generate go test -run TestPropertyAccessorsGenerated -update
+
 var propertyTypeMap = map[PropertyID]PropertyType{
 	PropertyPayloadFormat:                   PropertyTypeByte,
 	PropertyPublicationExpiry:               PropertyTypeInt,
@@ -302,6 +338,26 @@ func (p PropertyID) DupAllowed(t Type) bool {
 	return d[t]
 }
 
+// Name of the property, e.g. "ContentType"
+func (p PropertyID) Name() string {
+	if n, ok := propertyNameMap[p]; ok {
+		return n
+	}
+
+	return "Unknown"
+}
+
+// propertyIDByName reverse lookup of PropertyID.Name
+func propertyIDByName(name string) (PropertyID, bool) {
+	for id, n := range propertyNameMap {
+		if n == name {
+			return id, true
+		}
+	}
+
+	return 0, false
+}
+
 // IsValid check if property id is valid spec value
 func (p PropertyID) IsValid() bool {
 	if _, ok := propertyTypeMap[p]; ok {
@@ -330,6 +386,17 @@ func (p *property) reset() {
 	p.len = 0
 }
 
+// clear removes all properties keeping allocated storage
+// storage is not allocated if packet had none, e.g. v3.1.1 packet
+func (p *property) clear() {
+	for k := range p.properties {
+		delete(p.properties, k)
+	}
+
+	p.len = 0
+	p.noCopy = false
+}
+
 // Len of the encoded property field. Does not include size property len prefix
 func (p *property) Len() (int, int) {
 	return p.len, uvarintCalc(uint32(p.len))
@@ -341,13 +408,26 @@ func (p *property) FullLen() int {
 }
 
 // Set property value
+// Value replaces one set before, except properties allowed to appear more than once in the
+// packet, e.g. User Property, values of which are appended to ones set before
 func (p *property) Set(t Type, id PropertyID, val interface{}) error {
-	if mT, ok := propertyAllowedMessageTypes[id]; !ok {
+	mT, ok := propertyAllowedMessageTypes[id]
+	if !ok {
 		return ErrPropertyInvalidID
-	} else if _, ok = mT[t]; !ok {
+	}
+
+	dup, ok := mT[t]
+	if !ok {
 		return ErrPropertyPacketTypeMismatch
 	}
 
+	if prev, exists := p.properties[id]; exists && dup {
+		val = appendProperty(id, prev, val)
+	}
+
+	// previous value is replaced thus its size must not be accounted twice
+	p.delete(id)
+
 	fn := propertyCalcLen[propertyTypeMap[id]]
 	l, err := fn(id, val)
 	p.len += l
@@ -356,6 +436,36 @@ func (p *property) Set(t Type, id PropertyID, val interface{}) error {
 	return err
 }
 
+// delete property if present
+func (p *property) delete(id PropertyID) {
+	val, ok := p.properties[id]
+	if !ok {
+		return
+	}
+
+	l, _ := propertyCalcLen[propertyTypeMap[id]](id, val)
+	p.len -= l
+
+	delete(p.properties, id)
+}
+
+// appendProperty values of repeatable property val to ones of prev
+// val of unexpected type replaces prev
+func appendProperty(id PropertyID, prev, val interface{}) interface{} {
+	switch propertyTypeMap[id] {
+	case PropertyTypeStringPair:
+		if add := propertyStringPairs(val); add != nil {
+			return append(append([]StringPair(nil), propertyStringPairs(prev)...), add...)
+		}
+	case PropertyTypeVarInt:
+		if add := propertyUint32s(val); add != nil {
+			return append(append([]uint32(nil), propertyUint32s(prev)...), add...)
+		}
+	}
+
+	return val
+}
+
 // Get property value
 func (p *property) Get(id PropertyID) PropertyToType {
 	if val, ok := p.properties[id]; ok {
@@ -378,6 +488,28 @@ func (p *property) ForEach(f func(PropertyID, PropertyToType)) {
 	}
 }
 
+// detach makes private copy of binary and user properties which alias decode buffer or other packet
+func (p *property) detach() {
+	if !p.noCopy {
+		return
+	}
+
+	for k, v := range p.properties {
+		switch val := v.(type) {
+		case []byte:
+			if propertyTypeMap[k] == PropertyTypeBinary {
+				tmp := make([]byte, len(val))
+				copy(tmp, val)
+				p.properties[k] = tmp
+			}
+		case []StringPair:
+			p.properties[k] = append([]StringPair(nil), val...)
+		}
+	}
+
+	p.noCopy = false
+}
+
 func writePrefixID(id PropertyID, b []byte) int {
 	return binary.PutUvarint(b, uint64(id))
 }
@@ -655,7 +787,15 @@ func decodeVarInt(p *property, id PropertyID, from []byte) (int, error) {
 	}
 	offset += cnt
 
-	p.properties[id] = v
+	// duplicates reach here only if allowed, e.g. subscription identifiers of PUBLISH
+	switch prev := p.properties[id].(type) {
+	case uint32:
+		p.properties[id] = []uint32{prev, v}
+	case []uint32:
+		p.properties[id] = append(prev, v)
+	default:
+		p.properties[id] = v
+	}
 
 	return offset, nil
 }
@@ -712,11 +852,13 @@ func decodeBinary(p *property, id PropertyID, from []byte) (int, error) {
 	}
 	offset += n
 
-	tmp := make([]byte, len(b))
-
-	copy(tmp, b)
-
-	p.properties[id] = tmp
+	if p.noCopy {
+		p.properties[id] = b[:len(b):len(b)]
+	} else {
+		tmp := make([]byte, len(b))
+		copy(tmp, b)
+		p.properties[id] = tmp
+	}
 
 	return offset, nil
 }
@@ -928,3 +1070,59 @@ func encodeBinary(id PropertyID, val interface{}, to []byte) (int, error) {
 	}
 	return offset, nil
 }
+
+// propertyBool byte property holding 0 or 1
+func propertyBool(val interface{}) (bool, bool) {
+	v, ok := val.(byte)
+	return v == 1, ok
+}
+
+func boolToByte(v bool) byte {
+	if v {
+		return 1
+	}
+
+	return 0
+}
+
+// propertyDuration four byte integer property holding interval in seconds
+func propertyDuration(val interface{}) (time.Duration, bool) {
+	v, ok := val.(uint32)
+	return time.Duration(v) * time.Second, ok
+}
+
+// durationToSeconds truncates duration to seconds fitting four byte integer
+func durationToSeconds(d time.Duration) uint32 {
+	switch {
+	case d <= 0:
+		return 0
+	case d/time.Second >= math.MaxUint32:
+		return math.MaxUint32
+	}
+
+	return uint32(d / time.Second)
+}
+
+// propertyUint32s values of property allowed to be duplicated
+func propertyUint32s(val interface{}) []uint32 {
+	switch v := val.(type) {
+	case uint32:
+		return []uint32{v}
+	case []uint32:
+		return v
+	}
+
+	return nil
+}
+
+// propertyStringPairs values of user property
+func propertyStringPairs(val interface{}) []StringPair {
+	switch v := val.(type) {
+	case StringPair:
+		return []StringPair{v}
+	case []StringPair:
+		return v
+	}
+
+	return nil
+}
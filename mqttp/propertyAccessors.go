@@ -0,0 +1,555 @@
+// Code generated by go generate; DO NOT EDIT.
+
+package mqttp
+
+import "time"
+
+// SessionExpiry returns Session Expiry Interval property, false if not set
+func (msg *Connect) SessionExpiry() (time.Duration, bool) {
+	return propertyDuration(msg.properties.properties[PropertySessionExpiryInterval])
+}
+
+// SetSessionExpiry sets Session Expiry Interval property
+func (msg *Connect) SetSessionExpiry(v time.Duration) error {
+	return msg.PropertySet(PropertySessionExpiryInterval, durationToSeconds(v))
+}
+
+// AuthMethod returns Authentication Method property, false if not set
+func (msg *Connect) AuthMethod() (string, bool) {
+	v, ok := msg.properties.properties[PropertyAuthMethod].(string)
+	return v, ok
+}
+
+// SetAuthMethod sets Authentication Method property
+func (msg *Connect) SetAuthMethod(v string) error {
+	return msg.PropertySet(PropertyAuthMethod, v)
+}
+
+// AuthData returns Authentication Data property, false if not set
+func (msg *Connect) AuthData() ([]byte, bool) {
+	v, ok := msg.properties.properties[PropertyAuthData].([]byte)
+	return v, ok
+}
+
+// SetAuthData sets Authentication Data property
+func (msg *Connect) SetAuthData(v []byte) error {
+	return msg.PropertySet(PropertyAuthData, v)
+}
+
+// RequestProblemInfo returns Request Problem Information property, false if not set
+func (msg *Connect) RequestProblemInfo() (bool, bool) {
+	return propertyBool(msg.properties.properties[PropertyRequestProblemInfo])
+}
+
+// SetRequestProblemInfo sets Request Problem Information property
+func (msg *Connect) SetRequestProblemInfo(v bool) error {
+	return msg.PropertySet(PropertyRequestProblemInfo, boolToByte(v))
+}
+
+// RequestResponseInfo returns Request Response Information property, false if not set
+func (msg *Connect) RequestResponseInfo() (bool, bool) {
+	return propertyBool(msg.properties.properties[PropertyRequestResponseInfo])
+}
+
+// SetRequestResponseInfo sets Request Response Information property
+func (msg *Connect) SetRequestResponseInfo(v bool) error {
+	return msg.PropertySet(PropertyRequestResponseInfo, boolToByte(v))
+}
+
+// ReceiveMaximum returns Receive Maximum property, false if not set
+func (msg *Connect) ReceiveMaximum() (uint16, bool) {
+	v, ok := msg.properties.properties[PropertyReceiveMaximum].(uint16)
+	return v, ok
+}
+
+// SetReceiveMaximum sets Receive Maximum property
+func (msg *Connect) SetReceiveMaximum(v uint16) error {
+	return msg.PropertySet(PropertyReceiveMaximum, v)
+}
+
+// TopicAliasMaximum returns Topic Alias Maximum property, false if not set
+func (msg *Connect) TopicAliasMaximum() (uint16, bool) {
+	v, ok := msg.properties.properties[PropertyTopicAliasMaximum].(uint16)
+	return v, ok
+}
+
+// SetTopicAliasMaximum sets Topic Alias Maximum property
+func (msg *Connect) SetTopicAliasMaximum(v uint16) error {
+	return msg.PropertySet(PropertyTopicAliasMaximum, v)
+}
+
+// UserProperties returns User Property property
+func (msg *Connect) UserProperties() []StringPair {
+	return propertyStringPairs(msg.properties.properties[PropertyUserProperty])
+}
+
+// SetUserProperties appends User Property values to ones set before
+func (msg *Connect) SetUserProperties(v []StringPair) error {
+	return msg.PropertySet(PropertyUserProperty, v)
+}
+
+// MaximumPacketSize returns Maximum Packet Size property, false if not set
+func (msg *Connect) MaximumPacketSize() (uint32, bool) {
+	v, ok := msg.properties.properties[PropertyMaximumPacketSize].(uint32)
+	return v, ok
+}
+
+// SetMaximumPacketSize sets Maximum Packet Size property
+func (msg *Connect) SetMaximumPacketSize(v uint32) error {
+	return msg.PropertySet(PropertyMaximumPacketSize, v)
+}
+
+// SessionExpiry returns Session Expiry Interval property, false if not set
+func (msg *ConnAck) SessionExpiry() (time.Duration, bool) {
+	return propertyDuration(msg.properties.properties[PropertySessionExpiryInterval])
+}
+
+// SetSessionExpiry sets Session Expiry Interval property
+func (msg *ConnAck) SetSessionExpiry(v time.Duration) error {
+	return msg.PropertySet(PropertySessionExpiryInterval, durationToSeconds(v))
+}
+
+// AssignedClientID returns Assigned Client Identifier property, false if not set
+func (msg *ConnAck) AssignedClientID() (string, bool) {
+	v, ok := msg.properties.properties[PropertyAssignedClientIdentifier].(string)
+	return v, ok
+}
+
+// SetAssignedClientID sets Assigned Client Identifier property
+func (msg *ConnAck) SetAssignedClientID(v string) error {
+	return msg.PropertySet(PropertyAssignedClientIdentifier, v)
+}
+
+// ServerKeepAlive returns Server Keep Alive property, false if not set
+func (msg *ConnAck) ServerKeepAlive() (uint16, bool) {
+	v, ok := msg.properties.properties[PropertyServerKeepAlive].(uint16)
+	return v, ok
+}
+
+// SetServerKeepAlive sets Server Keep Alive property
+func (msg *ConnAck) SetServerKeepAlive(v uint16) error {
+	return msg.PropertySet(PropertyServerKeepAlive, v)
+}
+
+// AuthMethod returns Authentication Method property, false if not set
+func (msg *ConnAck) AuthMethod() (string, bool) {
+	v, ok := msg.properties.properties[PropertyAuthMethod].(string)
+	return v, ok
+}
+
+// SetAuthMethod sets Authentication Method property
+func (msg *ConnAck) SetAuthMethod(v string) error {
+	return msg.PropertySet(PropertyAuthMethod, v)
+}
+
+// AuthData returns Authentication Data property, false if not set
+func (msg *ConnAck) AuthData() ([]byte, bool) {
+	v, ok := msg.properties.properties[PropertyAuthData].([]byte)
+	return v, ok
+}
+
+// SetAuthData sets Authentication Data property
+func (msg *ConnAck) SetAuthData(v []byte) error {
+	return msg.PropertySet(PropertyAuthData, v)
+}
+
+// ResponseInfo returns Response Information property, false if not set
+func (msg *ConnAck) ResponseInfo() (string, bool) {
+	v, ok := msg.properties.properties[PropertyResponseInfo].(string)
+	return v, ok
+}
+
+// SetResponseInfo sets Response Information property
+func (msg *ConnAck) SetResponseInfo(v string) error {
+	return msg.PropertySet(PropertyResponseInfo, v)
+}
+
+// ServerReference returns Server Reference property, false if not set
+func (msg *ConnAck) ServerReference() (string, bool) {
+	v, ok := msg.properties.properties[PropertyServerReverence].(string)
+	return v, ok
+}
+
+// SetServerReference sets Server Reference property
+func (msg *ConnAck) SetServerReference(v string) error {
+	return msg.PropertySet(PropertyServerReverence, v)
+}
+
+// ReasonString returns Reason String property, false if not set
+func (msg *ConnAck) ReasonString() (string, bool) {
+	v, ok := msg.properties.properties[PropertyReasonString].(string)
+	return v, ok
+}
+
+// SetReasonString sets Reason String property
+func (msg *ConnAck) SetReasonString(v string) error {
+	return msg.PropertySet(PropertyReasonString, v)
+}
+
+// ReceiveMaximum returns Receive Maximum property, false if not set
+func (msg *ConnAck) ReceiveMaximum() (uint16, bool) {
+	v, ok := msg.properties.properties[PropertyReceiveMaximum].(uint16)
+	return v, ok
+}
+
+// SetReceiveMaximum sets Receive Maximum property
+func (msg *ConnAck) SetReceiveMaximum(v uint16) error {
+	return msg.PropertySet(PropertyReceiveMaximum, v)
+}
+
+// TopicAliasMaximum returns Topic Alias Maximum property, false if not set
+func (msg *ConnAck) TopicAliasMaximum() (uint16, bool) {
+	v, ok := msg.properties.properties[PropertyTopicAliasMaximum].(uint16)
+	return v, ok
+}
+
+// SetTopicAliasMaximum sets Topic Alias Maximum property
+func (msg *ConnAck) SetTopicAliasMaximum(v uint16) error {
+	return msg.PropertySet(PropertyTopicAliasMaximum, v)
+}
+
+// MaximumQoS returns Maximum QoS property, false if not set
+func (msg *ConnAck) MaximumQoS() (QosType, bool) {
+	v, ok := msg.properties.properties[PropertyMaximumQoS].(byte)
+	return QosType(v), ok
+}
+
+// SetMaximumQoS sets Maximum QoS property
+func (msg *ConnAck) SetMaximumQoS(v QosType) error {
+	return msg.PropertySet(PropertyMaximumQoS, byte(v))
+}
+
+// RetainAvailable returns Retain Available property, false if not set
+func (msg *ConnAck) RetainAvailable() (bool, bool) {
+	return propertyBool(msg.properties.properties[PropertyRetainAvailable])
+}
+
+// SetRetainAvailable sets Retain Available property
+func (msg *ConnAck) SetRetainAvailable(v bool) error {
+	return msg.PropertySet(PropertyRetainAvailable, boolToByte(v))
+}
+
+// UserProperties returns User Property property
+func (msg *ConnAck) UserProperties() []StringPair {
+	return propertyStringPairs(msg.properties.properties[PropertyUserProperty])
+}
+
+// SetUserProperties appends User Property values to ones set before
+func (msg *ConnAck) SetUserProperties(v []StringPair) error {
+	return msg.PropertySet(PropertyUserProperty, v)
+}
+
+// MaximumPacketSize returns Maximum Packet Size property, false if not set
+func (msg *ConnAck) MaximumPacketSize() (uint32, bool) {
+	v, ok := msg.properties.properties[PropertyMaximumPacketSize].(uint32)
+	return v, ok
+}
+
+// SetMaximumPacketSize sets Maximum Packet Size property
+func (msg *ConnAck) SetMaximumPacketSize(v uint32) error {
+	return msg.PropertySet(PropertyMaximumPacketSize, v)
+}
+
+// WildcardSubscriptionAvailable returns Wildcard Subscription Available property, false if not set
+func (msg *ConnAck) WildcardSubscriptionAvailable() (bool, bool) {
+	return propertyBool(msg.properties.properties[PropertyWildcardSubscriptionAvailable])
+}
+
+// SetWildcardSubscriptionAvailable sets Wildcard Subscription Available property
+func (msg *ConnAck) SetWildcardSubscriptionAvailable(v bool) error {
+	return msg.PropertySet(PropertyWildcardSubscriptionAvailable, boolToByte(v))
+}
+
+// SubscriptionIDAvailable returns Subscription Identifier Available property, false if not set
+func (msg *ConnAck) SubscriptionIDAvailable() (bool, bool) {
+	return propertyBool(msg.properties.properties[PropertySubscriptionIdentifierAvailable])
+}
+
+// SetSubscriptionIDAvailable sets Subscription Identifier Available property
+func (msg *ConnAck) SetSubscriptionIDAvailable(v bool) error {
+	return msg.PropertySet(PropertySubscriptionIdentifierAvailable, boolToByte(v))
+}
+
+// SharedSubscriptionAvailable returns Shared Subscription Available property, false if not set
+func (msg *ConnAck) SharedSubscriptionAvailable() (bool, bool) {
+	return propertyBool(msg.properties.properties[PropertySharedSubscriptionAvailable])
+}
+
+// SetSharedSubscriptionAvailable sets Shared Subscription Available property
+func (msg *ConnAck) SetSharedSubscriptionAvailable(v bool) error {
+	return msg.PropertySet(PropertySharedSubscriptionAvailable, boolToByte(v))
+}
+
+// PayloadFormat returns Payload Format Indicator property, false if not set
+func (msg *Publish) PayloadFormat() (byte, bool) {
+	v, ok := msg.properties.properties[PropertyPayloadFormat].(byte)
+	return v, ok
+}
+
+// SetPayloadFormat sets Payload Format Indicator property
+func (msg *Publish) SetPayloadFormat(v byte) error {
+	return msg.PropertySet(PropertyPayloadFormat, v)
+}
+
+// MessageExpiry returns Message Expiry Interval property, false if not set
+func (msg *Publish) MessageExpiry() (time.Duration, bool) {
+	return propertyDuration(msg.properties.properties[PropertyPublicationExpiry])
+}
+
+// SetMessageExpiry sets Message Expiry Interval property
+func (msg *Publish) SetMessageExpiry(v time.Duration) error {
+	return msg.PropertySet(PropertyPublicationExpiry, durationToSeconds(v))
+}
+
+// ContentType returns Content Type property, false if not set
+func (msg *Publish) ContentType() (string, bool) {
+	v, ok := msg.properties.properties[PropertyContentType].(string)
+	return v, ok
+}
+
+// SetContentType sets Content Type property
+func (msg *Publish) SetContentType(v string) error {
+	return msg.PropertySet(PropertyContentType, v)
+}
+
+// ResponseTopic returns Response Topic property, false if not set
+func (msg *Publish) ResponseTopic() (string, bool) {
+	v, ok := msg.properties.properties[PropertyResponseTopic].(string)
+	return v, ok
+}
+
+// SetResponseTopic sets Response Topic property
+func (msg *Publish) SetResponseTopic(v string) error {
+	return msg.PropertySet(PropertyResponseTopic, v)
+}
+
+// CorrelationData returns Correlation Data property, false if not set
+func (msg *Publish) CorrelationData() ([]byte, bool) {
+	v, ok := msg.properties.properties[PropertyCorrelationData].([]byte)
+	return v, ok
+}
+
+// SetCorrelationData sets Correlation Data property
+func (msg *Publish) SetCorrelationData(v []byte) error {
+	return msg.PropertySet(PropertyCorrelationData, v)
+}
+
+// SubscriptionIDs returns Subscription Identifier property
+func (msg *Publish) SubscriptionIDs() []uint32 {
+	return propertyUint32s(msg.properties.properties[PropertySubscriptionIdentifier])
+}
+
+// SetSubscriptionIDs appends Subscription Identifier values to ones set before
+func (msg *Publish) SetSubscriptionIDs(v []uint32) error {
+	return msg.PropertySet(PropertySubscriptionIdentifier, v)
+}
+
+// WillDelay returns Will Delay Interval property, false if not set
+func (msg *Publish) WillDelay() (time.Duration, bool) {
+	return propertyDuration(msg.properties.properties[PropertyWillDelayInterval])
+}
+
+// SetWillDelay sets Will Delay Interval property
+func (msg *Publish) SetWillDelay(v time.Duration) error {
+	return msg.PropertySet(PropertyWillDelayInterval, durationToSeconds(v))
+}
+
+// TopicAlias returns Topic Alias property, false if not set
+func (msg *Publish) TopicAlias() (uint16, bool) {
+	v, ok := msg.properties.properties[PropertyTopicAlias].(uint16)
+	return v, ok
+}
+
+// SetTopicAlias sets Topic Alias property
+func (msg *Publish) SetTopicAlias(v uint16) error {
+	return msg.PropertySet(PropertyTopicAlias, v)
+}
+
+// UserProperties returns User Property property
+func (msg *Publish) UserProperties() []StringPair {
+	return propertyStringPairs(msg.properties.properties[PropertyUserProperty])
+}
+
+// SetUserProperties appends User Property values to ones set before
+func (msg *Publish) SetUserProperties(v []StringPair) error {
+	return msg.PropertySet(PropertyUserProperty, v)
+}
+
+// ReasonString returns Reason String property, false if not set
+func (msg *Ack) ReasonString() (string, bool) {
+	v, ok := msg.properties.properties[PropertyReasonString].(string)
+	return v, ok
+}
+
+// SetReasonString sets Reason String property
+func (msg *Ack) SetReasonString(v string) error {
+	return msg.PropertySet(PropertyReasonString, v)
+}
+
+// UserProperties returns User Property property
+func (msg *Ack) UserProperties() []StringPair {
+	return propertyStringPairs(msg.properties.properties[PropertyUserProperty])
+}
+
+// SetUserProperties appends User Property values to ones set before
+func (msg *Ack) SetUserProperties(v []StringPair) error {
+	return msg.PropertySet(PropertyUserProperty, v)
+}
+
+// SubscriptionID returns Subscription Identifier property, false if not set
+func (msg *Subscribe) SubscriptionID() (uint32, bool) {
+	v, ok := msg.properties.properties[PropertySubscriptionIdentifier].(uint32)
+	return v, ok
+}
+
+// SetSubscriptionID sets Subscription Identifier property
+func (msg *Subscribe) SetSubscriptionID(v uint32) error {
+	return msg.PropertySet(PropertySubscriptionIdentifier, v)
+}
+
+// UserProperties returns User Property property
+func (msg *Subscribe) UserProperties() []StringPair {
+	return propertyStringPairs(msg.properties.properties[PropertyUserProperty])
+}
+
+// SetUserProperties appends User Property values to ones set before
+func (msg *Subscribe) SetUserProperties(v []StringPair) error {
+	return msg.PropertySet(PropertyUserProperty, v)
+}
+
+// ReasonString returns Reason String property, false if not set
+func (msg *SubAck) ReasonString() (string, bool) {
+	v, ok := msg.properties.properties[PropertyReasonString].(string)
+	return v, ok
+}
+
+// SetReasonString sets Reason String property
+func (msg *SubAck) SetReasonString(v string) error {
+	return msg.PropertySet(PropertyReasonString, v)
+}
+
+// UserProperties returns User Property property
+func (msg *SubAck) UserProperties() []StringPair {
+	return propertyStringPairs(msg.properties.properties[PropertyUserProperty])
+}
+
+// SetUserProperties appends User Property values to ones set before
+func (msg *SubAck) SetUserProperties(v []StringPair) error {
+	return msg.PropertySet(PropertyUserProperty, v)
+}
+
+// UserProperties returns User Property property
+func (msg *UnSubscribe) UserProperties() []StringPair {
+	return propertyStringPairs(msg.properties.properties[PropertyUserProperty])
+}
+
+// SetUserProperties appends User Property values to ones set before
+func (msg *UnSubscribe) SetUserProperties(v []StringPair) error {
+	return msg.PropertySet(PropertyUserProperty, v)
+}
+
+// ReasonString returns Reason String property, false if not set
+func (msg *UnSubAck) ReasonString() (string, bool) {
+	v, ok := msg.properties.properties[PropertyReasonString].(string)
+	return v, ok
+}
+
+// SetReasonString sets Reason String property
+func (msg *UnSubAck) SetReasonString(v string) error {
+	return msg.PropertySet(PropertyReasonString, v)
+}
+
+// UserProperties returns User Property property
+func (msg *UnSubAck) UserProperties() []StringPair {
+	return propertyStringPairs(msg.properties.properties[PropertyUserProperty])
+}
+
+// SetUserProperties appends User Property values to ones set before
+func (msg *UnSubAck) SetUserProperties(v []StringPair) error {
+	return msg.PropertySet(PropertyUserProperty, v)
+}
+
+// SessionExpiry returns Session Expiry Interval property, false if not set
+func (msg *Disconnect) SessionExpiry() (time.Duration, bool) {
+	return propertyDuration(msg.properties.properties[PropertySessionExpiryInterval])
+}
+
+// SetSessionExpiry sets Session Expiry Interval property
+func (msg *Disconnect) SetSessionExpiry(v time.Duration) error {
+	return msg.PropertySet(PropertySessionExpiryInterval, durationToSeconds(v))
+}
+
+// ServerReference returns Server Reference property, false if not set
+func (msg *Disconnect) ServerReference() (string, bool) {
+	v, ok := msg.properties.properties[PropertyServerReverence].(string)
+	return v, ok
+}
+
+// SetServerReference sets Server Reference property
+func (msg *Disconnect) SetServerReference(v string) error {
+	return msg.PropertySet(PropertyServerReverence, v)
+}
+
+// ReasonString returns Reason String property, false if not set
+func (msg *Disconnect) ReasonString() (string, bool) {
+	v, ok := msg.properties.properties[PropertyReasonString].(string)
+	return v, ok
+}
+
+// SetReasonString sets Reason String property
+func (msg *Disconnect) SetReasonString(v string) error {
+	return msg.PropertySet(PropertyReasonString, v)
+}
+
+// UserProperties returns User Property property
+func (msg *Disconnect) UserProperties() []StringPair {
+	return propertyStringPairs(msg.properties.properties[PropertyUserProperty])
+}
+
+// SetUserProperties appends User Property values to ones set before
+func (msg *Disconnect) SetUserProperties(v []StringPair) error {
+	return msg.PropertySet(PropertyUserProperty, v)
+}
+
+// AuthMethod returns Authentication Method property, false if not set
+func (msg *Auth) AuthMethod() (string, bool) {
+	v, ok := msg.properties.properties[PropertyAuthMethod].(string)
+	return v, ok
+}
+
+// SetAuthMethod sets Authentication Method property
+func (msg *Auth) SetAuthMethod(v string) error {
+	return msg.PropertySet(PropertyAuthMethod, v)
+}
+
+// AuthData returns Authentication Data property, false if not set
+func (msg *Auth) AuthData() ([]byte, bool) {
+	v, ok := msg.properties.properties[PropertyAuthData].([]byte)
+	return v, ok
+}
+
+// SetAuthData sets Authentication Data property
+func (msg *Auth) SetAuthData(v []byte) error {
+	return msg.PropertySet(PropertyAuthData, v)
+}
+
+// ReasonString returns Reason String property, false if not set
+func (msg *Auth) ReasonString() (string, bool) {
+	v, ok := msg.properties.properties[PropertyReasonString].(string)
+	return v, ok
+}
+
+// SetReasonString sets Reason String property
+func (msg *Auth) SetReasonString(v string) error {
+	return msg.PropertySet(PropertyReasonString, v)
+}
+
+// UserProperties returns User Property property
+func (msg *Auth) UserProperties() []StringPair {
+	return propertyStringPairs(msg.properties.properties[PropertyUserProperty])
+}
+
+// SetUserProperties appends User Property values to ones set before
+func (msg *Auth) SetUserProperties(v []StringPair) error {
+	return msg.PropertySet(PropertyUserProperty, v)
+}
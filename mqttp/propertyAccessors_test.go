@@ -0,0 +1,333 @@
+package mqttp
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/format"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+var updateAccessors = flag.Bool("update", false, "regenerate propertyAccessors.go")
+
+const accessorsFile = "propertyAccessors.go"
+
+// accessorPackets packet implementations and types of packets they implement
+var accessorPackets = []struct {
+	name  string
+	types []Type
+}{
+	{"Connect", []Type{CONNECT}},
+	{"ConnAck", []Type{CONNACK}},
+	{"Publish", []Type{PUBLISH}},
+	{"Ack", []Type{PUBACK, PUBREC, PUBREL, PUBCOMP}},
+	{"Subscribe", []Type{SUBSCRIBE}},
+	{"SubAck", []Type{SUBACK}},
+	{"UnSubscribe", []Type{UNSUBSCRIBE}},
+	{"UnSubAck", []Type{UNSUBACK}},
+	{"Disconnect", []Type{DISCONNECT}},
+	{"Auth", []Type{AUTH}},
+}
+
+// accessorProperties method name, spec name and optional value semantic of each property
+// as is one of "bool", "qos" or "duration", empty means plain value of property type
+var accessorProperties = map[PropertyID]struct {
+	name string
+	desc string
+	as   string
+}{
+	PropertyPayloadFormat:                   {"PayloadFormat", "Payload Format Indicator", ""},
+	PropertyPublicationExpiry:               {"MessageExpiry", "Message Expiry Interval", "duration"},
+	PropertyContentType:                     {"ContentType", "Content Type", ""},
+	PropertyResponseTopic:                   {"ResponseTopic", "Response Topic", ""},
+	PropertyCorrelationData:                 {"CorrelationData", "Correlation Data", ""},
+	PropertySubscriptionIdentifier:          {"SubscriptionID", "Subscription Identifier", ""},
+	PropertySessionExpiryInterval:           {"SessionExpiry", "Session Expiry Interval", "duration"},
+	PropertyAssignedClientIdentifier:        {"AssignedClientID", "Assigned Client Identifier", ""},
+	PropertyServerKeepAlive:                 {"ServerKeepAlive", "Server Keep Alive", ""},
+	PropertyAuthMethod:                      {"AuthMethod", "Authentication Method", ""},
+	PropertyAuthData:                        {"AuthData", "Authentication Data", ""},
+	PropertyRequestProblemInfo:              {"RequestProblemInfo", "Request Problem Information", "bool"},
+	PropertyWillDelayInterval:               {"WillDelay", "Will Delay Interval", "duration"},
+	PropertyRequestResponseInfo:             {"RequestResponseInfo", "Request Response Information", "bool"},
+	PropertyResponseInfo:                    {"ResponseInfo", "Response Information", ""},
+	PropertyServerReverence:                 {"ServerReference", "Server Reference", ""},
+	PropertyReasonString:                    {"ReasonString", "Reason String", ""},
+	PropertyReceiveMaximum:                  {"ReceiveMaximum", "Receive Maximum", ""},
+	PropertyTopicAliasMaximum:               {"TopicAliasMaximum", "Topic Alias Maximum", ""},
+	PropertyTopicAlias:                      {"TopicAlias", "Topic Alias", ""},
+	PropertyMaximumQoS:                      {"MaximumQoS", "Maximum QoS", "qos"},
+	PropertyRetainAvailable:                 {"RetainAvailable", "Retain Available", "bool"},
+	PropertyUserProperty:                    {"UserProperties", "User Property", ""},
+	PropertyMaximumPacketSize:               {"MaximumPacketSize", "Maximum Packet Size", ""},
+	PropertyWildcardSubscriptionAvailable:   {"WildcardSubscriptionAvailable", "Wildcard Subscription Available", "bool"},
+	PropertySubscriptionIdentifierAvailable: {"SubscriptionIDAvailable", "Subscription Identifier Available", "bool"},
+	PropertySharedSubscriptionAvailable:     {"SharedSubscriptionAvailable", "Shared Subscription Available", "bool"},
+}
+
+// accessorCode go type of the value, getter body and setter argument
+type accessorCode struct {
+	typ string
+	get string
+	set string
+}
+
+func accessorFor(id PropertyID, as string, dup bool) (accessorCode, error) {
+	val := fmt.Sprintf("msg.properties.properties[%s]", propertyConst(id))
+
+	plain := func(typ string) accessorCode {
+		return accessorCode{
+			typ: typ,
+			get: fmt.Sprintf("v, ok := %s.(%s)\nreturn v, ok", val, typ),
+			set: "v",
+		}
+	}
+
+	pt := propertyTypeMap[id]
+
+	switch {
+	case dup && pt == PropertyTypeVarInt && as == "":
+		return accessorCode{typ: "[]uint32", get: "return propertyUint32s(" + val + ")", set: "v"}, nil
+	case dup && pt == PropertyTypeStringPair && as == "":
+		return accessorCode{typ: "[]StringPair", get: "return propertyStringPairs(" + val + ")", set: "v"}, nil
+	case dup:
+		return accessorCode{}, fmt.Errorf("%s: duplicates of type %d are not supported", id.Name(), pt)
+	case pt == PropertyTypeByte && as == "bool":
+		return accessorCode{typ: "bool", get: "return propertyBool(" + val + ")", set: "boolToByte(v)"}, nil
+	case pt == PropertyTypeByte && as == "qos":
+		return accessorCode{typ: "QosType", get: "v, ok := " + val + ".(byte)\nreturn QosType(v), ok", set: "byte(v)"}, nil
+	case pt == PropertyTypeInt && as == "duration":
+		return accessorCode{typ: "time.Duration", get: "return propertyDuration(" + val + ")", set: "durationToSeconds(v)"}, nil
+	case as != "":
+		return accessorCode{}, fmt.Errorf("%s: %q is not applicable to type %d", id.Name(), as, pt)
+	case pt == PropertyTypeByte:
+		return plain("byte"), nil
+	case pt == PropertyTypeShort:
+		return plain("uint16"), nil
+	case pt == PropertyTypeInt, pt == PropertyTypeVarInt:
+		return plain("uint32"), nil
+	case pt == PropertyTypeString:
+		return plain("string"), nil
+	case pt == PropertyTypeBinary:
+		return plain("[]byte"), nil
+	}
+
+	return accessorCode{}, fmt.Errorf("%s: type %d is not supported", id.Name(), pt)
+}
+
+// propertyConst name of the constant declaring property id
+func propertyConst(id PropertyID) string {
+	// keep name of constant as declared
+	if id == PropertyServerReverence {
+		return "PropertyServerReverence"
+	}
+
+	return "Property" + id.Name()
+}
+
+// allowedForAll check property allowed for every packet type and
+// either duplicates allowed for all of them or for none
+func allowedForAll(id PropertyID, types []Type) (bool, bool, error) {
+	allowed := 0
+	dups := 0
+
+	for _, t := range types {
+		if id.IsValidPacketType(t) {
+			allowed++
+		}
+
+		if id.DupAllowed(t) {
+			dups++
+		}
+	}
+
+	if allowed != 0 && allowed != len(types) {
+		return false, false, fmt.Errorf("%s: allowed only for some packets of implementation", id.Name())
+	}
+
+	if dups != 0 && dups != len(types) {
+		return false, false, fmt.Errorf("%s: duplicates allowed only for some packets of implementation", id.Name())
+	}
+
+	return allowed != 0, dups != 0, nil
+}
+
+func generateAccessors() ([]byte, error) {
+	ids := make([]PropertyID, 0, len(propertyTypeMap))
+	for id := range propertyTypeMap {
+		if _, ok := accessorProperties[id]; !ok {
+			return nil, fmt.Errorf("%s: accessor is not declared", id.Name())
+		}
+
+		ids = append(ids, id)
+	}
+
+	if len(accessorProperties) != len(propertyTypeMap) {
+		return nil, fmt.Errorf("accessors declared for unknown properties")
+	}
+
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	var buf bytes.Buffer
+
+	for _, pkt := range accessorPackets {
+		for _, id := range ids {
+			allowed, dup, err := allowedForAll(id, pkt.types)
+			if err != nil {
+				return nil, err
+			}
+
+			if !allowed {
+				continue
+			}
+
+			meta := accessorProperties[id]
+
+			code, err := accessorFor(id, meta.as, dup)
+			if err != nil {
+				return nil, err
+			}
+
+			name := meta.name
+			if dup && !strings.HasSuffix(name, "s") {
+				name += "s"
+			}
+
+			fmt.Fprintf(&buf, "\n// %s returns %s property", name, meta.desc)
+			if !dup {
+				buf.WriteString(", false if not set")
+			}
+			fmt.Fprintf(&buf, "\nfunc (msg *%s) %s() ", pkt.name, name)
+			if dup {
+				fmt.Fprintf(&buf, "%s {\n%s\n}\n", code.typ, code.get)
+			} else {
+				fmt.Fprintf(&buf, "(%s, bool) {\n%s\n}\n", code.typ, code.get)
+			}
+
+			if dup {
+				fmt.Fprintf(&buf, "\n// Set%s appends %s values to ones set before\n", name, meta.desc)
+			} else {
+				fmt.Fprintf(&buf, "\n// Set%s sets %s property\n", name, meta.desc)
+			}
+			fmt.Fprintf(&buf, "func (msg *%s) Set%s(v %s) error {\nreturn msg.PropertySet(%s, %s)\n}\n",
+				pkt.name, name, code.typ, propertyConst(id), code.set)
+		}
+	}
+
+	var res bytes.Buffer
+
+	res.WriteString("// Code generated by go generate; DO NOT EDIT.\n\npackage mqttp\n")
+	if bytes.Contains(buf.Bytes(), []byte("time.")) {
+		res.WriteString("\nimport \"time\"\n")
+	}
+
+	res.Write(buf.Bytes())
+
+	return format.Source(res.Bytes())
+}
+
+func TestPropertyAccessorsGenerated(t *testing.T) {
+	// every packet implementation is covered
+	covered := make(map[Type]string)
+	for _, pkt := range accessorPackets {
+		for _, tp := range pkt.types {
+			covered[tp] = pkt.name
+		}
+	}
+
+	for tp := CONNECT; tp <= AUTH; tp++ {
+		if tp == PINGREQ || tp == PINGRESP {
+			continue
+		}
+
+		m, err := New(ProtocolV50, tp)
+		require.NoError(t, err)
+		require.Equal(t, "*mqttp."+covered[tp], fmt.Sprintf("%T", m), tp.Name())
+	}
+
+	src, err := generateAccessors()
+	require.NoError(t, err)
+
+	if *updateAccessors {
+		require.NoError(t, ioutil.WriteFile(accessorsFile, src, 0644))
+	}
+
+	current, err := ioutil.ReadFile(accessorsFile)
+	require.NoError(t, err)
+	require.Equal(t, string(src), string(current), "%s is out of date, run go generate", accessorsFile)
+}
+
+func TestPropertyAccessors(t *testing.T) {
+	pub := NewPublish(ProtocolV50)
+	require.NoError(t, pub.Set("a", []byte("data"), QoS1, false, false))
+	pub.SetPacketID(1)
+
+	_, ok := pub.ContentType()
+	require.False(t, ok)
+
+	require.NoError(t, pub.SetContentType("application/json"))
+	require.NoError(t, pub.SetMessageExpiry(90*time.Second+time.Millisecond))
+	require.NoError(t, pub.SetSubscriptionIDs([]uint32{1, 300}))
+	require.NoError(t, pub.SetUserProperties([]StringPair{{K: "k", V: "v"}}))
+	require.NoError(t, pub.SetCorrelationData([]byte{1, 2}))
+
+	buf, err := Encode(pub)
+	require.NoError(t, err)
+
+	m, _, err := Decode(ProtocolV50, buf)
+	require.NoError(t, err)
+
+	pub = m.(*Publish)
+
+	contentType, ok := pub.ContentType()
+	require.True(t, ok)
+	require.Equal(t, "application/json", contentType)
+
+	expiry, ok := pub.MessageExpiry()
+	require.True(t, ok)
+	require.Equal(t, 90*time.Second, expiry)
+
+	require.Equal(t, []uint32{1, 300}, pub.SubscriptionIDs())
+	require.Equal(t, []StringPair{{K: "k", V: "v"}}, pub.UserProperties())
+
+	data, ok := pub.CorrelationData()
+	require.True(t, ok)
+	require.Equal(t, []byte{1, 2}, data)
+
+	ack := NewConnAck(ProtocolV50)
+	require.NoError(t, ack.SetMaximumQoS(QoS1))
+	require.NoError(t, ack.SetRetainAvailable(false))
+	require.NoError(t, ack.SetSessionExpiry(time.Duration(1<<62)))
+
+	qos, ok := ack.MaximumQoS()
+	require.True(t, ok)
+	require.Equal(t, QoS1, qos)
+
+	retain, ok := ack.RetainAvailable()
+	require.True(t, ok)
+	require.False(t, retain)
+
+	expiry, ok = ack.SessionExpiry()
+	require.True(t, ok)
+	require.Equal(t, time.Duration(0xFFFFFFFF)*time.Second, expiry)
+
+	disconnect := NewDisconnect(ProtocolV50)
+	require.NoError(t, disconnect.SetServerReference("other"))
+
+	ref, ok := disconnect.ServerReference()
+	require.True(t, ok)
+	require.Equal(t, "other", ref)
+
+	// V3.1.1 packets have no properties
+	connect := NewConnect(ProtocolV311)
+	require.Equal(t, ErrNotSupported, connect.SetSessionExpiry(time.Minute))
+
+	_, ok = connect.SessionExpiry()
+	require.False(t, ok)
+}
@@ -2,6 +2,8 @@ package mqttp
 
 import (
 	"testing"
+
+	"github.com/stretchr/testify/require"
 )
 
 func TestPropertyAllowedPacketType(t *testing.T) {
@@ -15,3 +17,85 @@ func TestPropertyDecodeValid(t *testing.T) {
 func TestPropertyEncodeValid(t *testing.T) {
 
 }
+
+func TestPropertySetReplace(t *testing.T) {
+	newAck := func() *Ack {
+		ack := NewPubAck(ProtocolV50)
+		ack.SetPacketID(1)
+		ack.SetReason(CodeNoMatchingSubscribers)
+		return ack
+	}
+
+	expected := newAck()
+	require.NoError(t, expected.PropertySet(PropertyReasonString, "replaced"))
+
+	// single value property set twice keeps the last value
+	ack := newAck()
+	require.NoError(t, ack.PropertySet(PropertyReasonString, "reason string"))
+	require.NoError(t, ack.PropertySet(PropertyReasonString, "replaced"))
+
+	// size of replaced value is not accounted
+	require.Equal(t, expected.properties.len, ack.properties.len)
+
+	expectedSize, err := expected.Size()
+	require.NoError(t, err)
+
+	size, err := ack.Size()
+	require.NoError(t, err)
+	require.Equal(t, expectedSize, size)
+
+	buf, err := Encode(ack)
+	require.NoError(t, err)
+	require.Len(t, buf, size)
+
+	m, n, err := Decode(ProtocolV50, buf)
+	require.NoError(t, err)
+	require.Equal(t, len(buf), n)
+
+	reason, ok := m.(*Ack).ReasonString()
+	require.True(t, ok)
+	require.Equal(t, "replaced", reason)
+}
+
+func TestPropertySetRepeatable(t *testing.T) {
+	pub := NewPublish(ProtocolV50)
+	require.NoError(t, pub.Set("a/b", []byte("data"), QoS1, false, false))
+	pub.SetPacketID(1)
+
+	// single value property is replaced
+	require.NoError(t, pub.PropertySet(PropertyContentType, "text/plain"))
+	require.NoError(t, pub.PropertySet(PropertyContentType, "application/json"))
+
+	// values of properties allowed to appear more than once are accumulated
+	require.NoError(t, pub.PropertySet(PropertyUserProperty, StringPair{K: "a", V: "1"}))
+	require.NoError(t, pub.SetUserProperties([]StringPair{{K: "b", V: "2"}, {K: "a", V: "3"}}))
+	require.NoError(t, pub.PropertySet(PropertySubscriptionIdentifier, uint32(1)))
+	require.NoError(t, pub.SetSubscriptionIDs([]uint32{2, 3}))
+
+	size, err := pub.Size()
+	require.NoError(t, err)
+
+	buf, err := Encode(pub)
+	require.NoError(t, err)
+	require.Len(t, buf, size)
+
+	m, _, err := Decode(ProtocolV50, buf)
+	require.NoError(t, err)
+
+	msg := m.(*Publish)
+
+	contentType, ok := msg.ContentType()
+	require.True(t, ok)
+	require.Equal(t, "application/json", contentType)
+	require.Equal(t, []StringPair{{K: "a", V: "1"}, {K: "b", V: "2"}, {K: "a", V: "3"}}, msg.UserProperties())
+	require.Equal(t, []uint32{1, 2, 3}, msg.SubscriptionIDs())
+
+	// SUBSCRIBE carries single subscription identifier
+	sub := NewSubscribe(ProtocolV50)
+	require.NoError(t, sub.SetSubscriptionID(1))
+	require.NoError(t, sub.SetSubscriptionID(2))
+
+	id, ok := sub.SubscriptionID()
+	require.True(t, ok)
+	require.Equal(t, uint32(2), id)
+}
@@ -149,3 +149,8 @@ func (msg *Ack) size() int {
 
 	return total
 }
+
+func (msg *Ack) reset() {
+	msg.resetHeader()
+	msg.reasonCode = CodeSuccess
+}
@@ -16,6 +16,15 @@ package mqttp
 
 import (
 	"time"
+	"unicode/utf8"
+)
+
+// Payload Format Indicator values [MQTT-3.3.2.3.2]
+const (
+	// PayloadFormatUnspecified payload is unspecified bytes
+	PayloadFormatUnspecified byte = 0x00
+	// PayloadFormatUTF8 payload is UTF-8 encoded character data
+	PayloadFormatUTF8 byte = 0x01
 )
 
 // Publish A PUBLISH Control Packet is sent from a Client to a Server or from Server to a Client
@@ -119,9 +128,74 @@ func (msg *Publish) Clone(v ProtocolVersion) (*Publish, error) {
 			}
 		}
 	}
+
+	// payload and binary properties are shared with msg,
+	// thus clone must not alias decode buffer either
+	if msg.noCopy {
+		pkt.noCopy = true
+		pkt.properties.noCopy = true
+		pkt.Detach()
+	}
+
+	return pkt, nil
+}
+
+// Copy clone of the message which does not share payload and property values with msg,
+// thus msg is free to be modified or released once it returns. See Clone
+func (msg *Publish) Copy(v ProtocolVersion) (*Publish, error) {
+	pkt, err := msg.Clone(v)
+	if err != nil {
+		return nil, err
+	}
+
+	pkt.noCopy = true
+	pkt.properties.noCopy = true
+	pkt.Detach()
+
 	return pkt, nil
 }
 
+// Detach makes private copy of payload and binary properties if packet has been decoded
+// with DecodeOptions.NoCopy, thus packet can outlive decode buffer.
+// It is no-op for packets owning their data
+func (msg *Publish) Detach() {
+	if !msg.noCopy {
+		return
+	}
+
+	if len(msg.payload) > 0 {
+		tmp := make([]byte, len(msg.payload))
+		copy(tmp, msg.payload)
+		msg.payload = tmp
+	}
+
+	msg.properties.detach()
+	msg.noCopy = false
+}
+
+// ValidatePayloadFormat check payload meets Payload Format Indicator
+// returns CodeInvalidPayloadFormat if payload declared as UTF-8 is not valid UTF-8
+// and CodeProtocolError if indicator has value other than defined by the spec
+func (msg *Publish) ValidatePayloadFormat() error {
+	format, ok := msg.PayloadFormat()
+	if !ok || msg.version != ProtocolV50 {
+		return nil
+	}
+
+	switch format {
+	case PayloadFormatUnspecified:
+		return nil
+	case PayloadFormatUTF8:
+		if !utf8.Valid(msg.payload) {
+			return CodeInvalidPayloadFormat
+		}
+
+		return nil
+	}
+
+	return CodeProtocolError
+}
+
 // PublishID get publish ID to check No Local
 func (msg *Publish) PublishID() uintptr {
 	return msg.publishID
@@ -235,6 +309,8 @@ func (msg *Publish) SetTopic(v string) error {
 }
 
 // Payload returns the application message that's part of the PUBLISH message.
+// If packet has been decoded with DecodeOptions.NoCopy returned slice aliases decode buffer
+// and valid only as long as buffer is not modified. Use Detach to make private copy
 func (msg *Publish) Payload() []byte {
 	return msg.payload
 }
@@ -275,7 +351,7 @@ func (msg *Publish) decodeMessage(from []byte) (int, error) {
 			rejectCode = CodeRefusedServerUnavailable
 		}
 
-		return offset, rejectCode
+		return offset, violation(rejectCode, "MQTT-3.3.1-2")
 	}
 
 	// [MQTT-3.3.2.1]
@@ -285,12 +361,14 @@ func (msg *Publish) decodeMessage(from []byte) (int, error) {
 		return offset, err
 	}
 
+	// [MQTT-3.3.2-1]
 	if len(buf) == 0 && msg.version < ProtocolV50 {
-		return offset, CodeRefusedServerUnavailable
+		return offset, violation(CodeRefusedServerUnavailable, "MQTT-3.3.2-1")
 	}
 
+	// [MQTT-3.3.2-2]
 	if !ValidTopic(buf) {
-		return offset, CodeInvalidTopicName
+		return offset, violation(CodeInvalidTopicName, "MQTT-3.3.2-2")
 	}
 
 	msg.topic = string(buf)
@@ -355,15 +433,53 @@ func (msg *Publish) decodeMessage(from []byte) (int, error) {
 	}
 
 	if pLen > 0 {
-		msg.payload = make([]byte, pLen)
-		copy(msg.payload, from[offset:offset+pLen])
+		if msg.noCopy {
+			// limit capacity so append to payload never overwrites decode buffer
+			msg.payload = from[offset : offset+pLen : offset+pLen]
+		} else {
+			msg.payload = make([]byte, pLen)
+			copy(msg.payload, from[offset:offset+pLen])
+		}
 		offset += pLen
 	}
 
 	return offset, nil
 }
 
+// encodeHead writes fixed and variable headers leaving payload out
+// and returns amount of bytes written. Used by Writer to send payload without copying
+func (msg *Publish) encodeHead(to []byte) (int, error) {
+	expectedSize, err := msg.Size()
+	if err != nil {
+		return 0, err
+	}
+
+	expectedSize -= len(msg.payload)
+	if expectedSize > len(to) {
+		return expectedSize, ErrInsufficientBufferSize
+	}
+
+	offset := msg.encodeFixed(to)
+
+	var n int
+	n, err = msg.encodeVariableHeader(to[offset:])
+	offset += n
+
+	return offset, err
+}
+
 func (msg *Publish) encodeMessage(to []byte) (int, error) {
+	offset, err := msg.encodeVariableHeader(to)
+	if err != nil {
+		return offset, err
+	}
+
+	offset += copy(to[offset:], msg.payload)
+
+	return offset, nil
+}
+
+func (msg *Publish) encodeVariableHeader(to []byte) (int, error) {
 	if !ValidTopic([]byte(msg.topic)) {
 		return 0, ErrInvalidTopic
 	}
@@ -405,8 +521,6 @@ func (msg *Publish) encodeMessage(to []byte) (int, error) {
 		}
 	}
 
-	offset += copy(to[offset:], msg.payload)
-
 	return offset, nil
 }
 
@@ -425,3 +539,11 @@ func (msg *Publish) size() int {
 
 	return total
 }
+
+func (msg *Publish) reset() {
+	msg.resetHeader()
+	msg.payload = nil
+	msg.topic = ""
+	msg.publishID = 0
+	msg.expireAt = time.Time{}
+}
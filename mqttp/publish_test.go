@@ -20,7 +20,7 @@ func TestPublishDecode(t *testing.T) {
 
 	_, _, err = Decode(ProtocolV50, raw)
 	// must fail because there is no property length
-	require.EqualError(t, err, CodeMalformedPacket.Desc())
+	requireErrorIs(t, err, CodeMalformedPacket)
 }
 
 func TestPublishDecode1(t *testing.T) {
@@ -68,3 +68,102 @@ func TestPublishExpire(t *testing.T) {
 	require.NoError(t, err)
 	require.True(t, val <= 3 && val > 0)
 }
+
+func TestPublishDecodeNoCopy(t *testing.T) {
+	pkt := NewPublish(ProtocolV50)
+	err := pkt.Set("topic", []byte("payload"), QoS0, false, false)
+	require.NoError(t, err)
+
+	err = pkt.PropertySet(PropertyCorrelationData, []byte("correlation"))
+	require.NoError(t, err)
+
+	buf, err := Encode(pkt)
+	require.NoError(t, err)
+
+	m, _, err := DecodeWithOptions(buf, DecodeOptions{Version: ProtocolV50, NoCopy: true})
+	require.NoError(t, err)
+
+	msg, ok := m.(*Publish)
+	require.True(t, ok)
+	require.Equal(t, []byte("payload"), msg.Payload())
+
+	// payload and correlation data alias decode buffer
+	for i := range buf {
+		buf[i] = 'x'
+	}
+
+	require.Equal(t, []byte("xxxxxxx"), msg.Payload())
+	data, err := msg.PropertyGet(PropertyCorrelationData).AsBinary()
+	require.NoError(t, err)
+	require.Equal(t, []byte("xxxxxxxxxxx"), data)
+	require.Equal(t, "topic", msg.Topic())
+
+	msg.Detach()
+
+	for i := range buf {
+		buf[i] = 'y'
+	}
+
+	require.Equal(t, []byte("xxxxxxx"), msg.Payload())
+	data, err = msg.PropertyGet(PropertyCorrelationData).AsBinary()
+	require.NoError(t, err)
+	require.Equal(t, []byte("xxxxxxxxxxx"), data)
+}
+
+func TestDecodeNoCopyIgnoredByNonPublish(t *testing.T) {
+	pkt := NewConnect(ProtocolV50)
+	pkt.SetClean(true)
+	require.NoError(t, pkt.SetClientID([]byte("client")))
+	require.NoError(t, pkt.SetAuthMethod("method"))
+	require.NoError(t, pkt.SetAuthData([]byte("data")))
+
+	buf, err := Encode(pkt)
+	require.NoError(t, err)
+
+	m, _, err := DecodeWithOptions(buf, DecodeOptions{Version: ProtocolV50, NoCopy: true})
+	require.NoError(t, err)
+
+	for i := range buf {
+		buf[i] = 'x'
+	}
+
+	data, ok := m.(*Connect).AuthData()
+	require.True(t, ok)
+	require.Equal(t, []byte("data"), data)
+}
+
+func TestPublishDecodeCopy(t *testing.T) {
+	pkt := NewPublish(ProtocolV311)
+	err := pkt.Set("topic", []byte("payload"), QoS0, false, false)
+	require.NoError(t, err)
+
+	buf, err := Encode(pkt)
+	require.NoError(t, err)
+
+	m, _, err := Decode(ProtocolV311, buf)
+	require.NoError(t, err)
+
+	for i := range buf {
+		buf[i] = 'x'
+	}
+
+	require.Equal(t, []byte("payload"), m.(*Publish).Payload())
+}
+
+func TestPublishValidatePayloadFormat(t *testing.T) {
+	msg := NewPublish(ProtocolV50)
+	require.NoError(t, msg.Set("a", []byte{0xff, 0xfe}, QoS0, false, false))
+	require.NoError(t, msg.ValidatePayloadFormat())
+
+	require.NoError(t, msg.SetPayloadFormat(PayloadFormatUnspecified))
+	require.NoError(t, msg.ValidatePayloadFormat())
+
+	require.NoError(t, msg.SetPayloadFormat(PayloadFormatUTF8))
+	require.Equal(t, CodeInvalidPayloadFormat, msg.ValidatePayloadFormat())
+
+	msg.SetPayload([]byte("héllo"))
+	require.NoError(t, msg.ValidatePayloadFormat())
+
+	require.NoError(t, msg.SetPayloadFormat(2))
+	require.Equal(t, CodeProtocolError, msg.ValidatePayloadFormat())
+}
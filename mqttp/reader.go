@@ -0,0 +1,170 @@
+package mqttp
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+)
+
+const (
+	// maxRemainingLengthBytes maximum amount of bytes used to encode remaining length [MQTT-2.2.3]
+	maxRemainingLengthBytes = 4
+	// readerBufferSize default size of the internal read buffer
+	readerBufferSize = 4096
+	// readerChunk packets bigger than that grow buffer as data arrives
+	readerChunk = 64 * 1024
+)
+
+// Reader decodes packets from underlying stream such as net.Conn or websocket
+// It reads fixed header and remaining length incrementally thus caller does not
+// need to know packet boundaries
+type Reader struct {
+	r    *bufio.Reader
+	opts DecodeOptions
+}
+
+// NewReader allocate new packet reader on top of r
+// v is protocol version used to decode packets, ProtocolAuto is allowed as well.
+// Version is switched automatically when CONNECT packet is decoded
+func NewReader(r io.Reader, v ProtocolVersion) *Reader {
+	br, ok := r.(*bufio.Reader)
+	if !ok {
+		br = bufio.NewReaderSize(r, readerBufferSize)
+	}
+
+	return &Reader{
+		r: br,
+		opts: DecodeOptions{
+			Version: v,
+		},
+	}
+}
+
+// SetOptions set options used to decode subsequent packets
+// Each packet is read into its own buffer thus DecodeOptions.NoCopy is safe to use
+func (r *Reader) SetOptions(opts DecodeOptions) {
+	r.opts = opts
+}
+
+// Options used to decode packets
+func (r *Reader) Options() DecodeOptions {
+	return r.opts
+}
+
+// SetVersion set protocol version used to decode subsequent packets
+func (r *Reader) SetVersion(v ProtocolVersion) {
+	r.opts.Version = v
+}
+
+// Version protocol version used to decode packets
+func (r *Reader) Version() ProtocolVersion {
+	return r.opts.Version
+}
+
+// SetMaxPacketSize set maximum size of the whole packet including fixed header
+// 0 means limit defined by the spec (256MB)
+func (r *Reader) SetMaxPacketSize(sz uint32) {
+	r.opts.MaxPacketSize = sz
+}
+
+// MaxPacketSize maximum size of the whole packet including fixed header
+func (r *Reader) MaxPacketSize() uint32 {
+	return r.opts.MaxPacketSize
+}
+
+// Read blocks until next packet is read and decoded
+// returns io.EOF if stream has been closed on packet boundary and
+// io.ErrUnexpectedEOF if stream has been closed in the middle of the packet.
+// Malformed packets are reported as *DecodeError
+func (r *Reader) Read() (IFace, error) {
+	var fh [1 + maxRemainingLengthBytes]byte
+
+	b, err := r.r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+
+	fh[0] = b
+	fhLen := 1
+
+	var remLen uint32
+	var shift uint
+
+	// [MQTT-1.5.5] variable byte integer
+	for {
+		// malformed packet is not acknowledged by CONNACK of any version,
+		// connection must be closed [MQTT-4.13.1]
+		if fhLen > maxRemainingLengthBytes {
+			return nil, newDecodeError(Type(fh[0]>>offsetPacketType), fhLen, CodeMalformedPacket)
+		}
+
+		if b, err = r.r.ReadByte(); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+
+		fh[fhLen] = b
+		fhLen++
+
+		remLen |= uint32(b&0x7F) << shift
+		shift += 7
+
+		if b < 0x80 {
+			break
+		}
+	}
+
+	total := uint64(fhLen) + uint64(remLen)
+	if remLen > uint32(maxRemainingLength) || (r.opts.MaxPacketSize > 0 && total > uint64(r.opts.MaxPacketSize)) {
+		return nil, newDecodeError(Type(fh[0]>>offsetPacketType), 0, CodePacketTooLarge)
+	}
+
+	buf, err := r.readPacket(fh[:fhLen], int64(remLen))
+	if err != nil {
+		return nil, err
+	}
+
+	pkt, _, err := DecodeWithOptions(buf, r.opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if pkt.Type() == CONNECT {
+		r.opts.Version = pkt.Version()
+	}
+
+	return pkt, nil
+}
+
+// readPacket reads remaining length bytes of the packet following fixed header fh
+// remaining length is not trusted, thus big packets grow buffer as data arrives.
+// Packet buffer must not be reused as decoded packets may reference it
+func (r *Reader) readPacket(fh []byte, remLen int64) ([]byte, error) {
+	if remLen <= readerChunk {
+		buf := make([]byte, int64(len(fh))+remLen)
+		copy(buf, fh)
+
+		if _, err := io.ReadFull(r.r, buf[len(fh):]); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+
+		return buf, nil
+	}
+
+	buf := bytes.NewBuffer(make([]byte, 0, readerChunk))
+	buf.Write(fh)
+
+	if _, err := io.CopyN(buf, r.r, remLen); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,143 @@
+package mqttp
+
+import (
+	"bytes"
+	"io"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReaderStream(t *testing.T) {
+	pub := NewPublish(ProtocolV311)
+	err := pub.Set("topic", []byte("payload"), QoS1, false, false)
+	require.NoError(t, err)
+	pub.SetPacketID(10)
+
+	ack := NewPubAck(ProtocolV311)
+	ack.SetPacketID(10)
+
+	var stream []byte
+	for _, p := range []IFace{pub, ack, NewPingReq(ProtocolV311)} {
+		buf, e := Encode(p)
+		require.NoError(t, e)
+		stream = append(stream, buf...)
+	}
+
+	// deliver stream byte by byte to make sure framing does not depend on read boundaries
+	r := NewReader(&oneByteReader{r: bytes.NewReader(stream)}, ProtocolV311)
+
+	pkt, err := r.Read()
+	require.NoError(t, err)
+	require.Equal(t, PUBLISH, pkt.Type())
+	require.Equal(t, "topic", pkt.(*Publish).Topic())
+	require.Equal(t, []byte("payload"), pkt.(*Publish).Payload())
+
+	pkt, err = r.Read()
+	require.NoError(t, err)
+	require.Equal(t, PUBACK, pkt.Type())
+
+	pkt, err = r.Read()
+	require.NoError(t, err)
+	require.Equal(t, PINGREQ, pkt.Type())
+
+	_, err = r.Read()
+	require.Equal(t, io.EOF, err)
+}
+
+func TestReaderSwitchVersionOnConnect(t *testing.T) {
+	conn := NewConnect(ProtocolV50)
+	conn.SetClean(true)
+	err := conn.SetClientID([]byte("client"))
+	require.NoError(t, err)
+
+	buf, err := Encode(conn)
+	require.NoError(t, err)
+
+	r := NewReader(bytes.NewReader(buf), ProtocolV311)
+
+	pkt, err := r.Read()
+	require.NoError(t, err)
+	require.Equal(t, CONNECT, pkt.Type())
+	require.Equal(t, ProtocolV50, r.Version())
+}
+
+func TestReaderRemainingLength(t *testing.T) {
+	// largest remaining length which fits into 4 bytes
+	r := NewReader(bytes.NewReader([]byte{byte(PUBLISH << offsetPacketType), 0xFF, 0xFF, 0xFF, 0x7F}), ProtocolV50)
+	r.SetMaxPacketSize(1024)
+	_, err := r.Read()
+	requireErrorIs(t, err, CodePacketTooLarge)
+
+	// continuation bit set in the 4th byte
+	r = NewReader(bytes.NewReader([]byte{byte(PUBLISH << offsetPacketType), 0xFF, 0xFF, 0xFF, 0xFF, 0x01}), ProtocolV50)
+	_, err = r.Read()
+	requireErrorIs(t, err, CodeMalformedPacket)
+
+	// V3.1.1 has no return code for malformed packet, connection is closed without CONNACK
+	r = NewReader(bytes.NewReader([]byte{byte(CONNECT << offsetPacketType), 0xFF, 0xFF, 0xFF, 0xFF, 0x01}), ProtocolV311)
+	_, err = r.Read()
+	requireErrorIs(t, err, CodeMalformedPacket)
+
+	r = NewReader(bytes.NewReader([]byte{byte(PUBLISH << offsetPacketType), 0xFF, 0xFF, 0xFF, 0x7F}), ProtocolV311)
+	r.SetMaxPacketSize(1024)
+	_, err = r.Read()
+	requireErrorIs(t, err, CodePacketTooLarge)
+
+	// two bytes remaining length 128
+	r = NewReader(bytes.NewReader([]byte{byte(PUBLISH << offsetPacketType), 0x80, 0x01}), ProtocolV50)
+	r.SetMaxPacketSize(130)
+	_, err = r.Read()
+	requireErrorIs(t, err, CodePacketTooLarge)
+
+	// stream closed in the middle of remaining length
+	r = NewReader(bytes.NewReader([]byte{byte(PUBLISH << offsetPacketType), 0x80}), ProtocolV50)
+	_, err = r.Read()
+	require.Equal(t, io.ErrUnexpectedEOF, err)
+}
+
+func TestReaderUnexpectedEOF(t *testing.T) {
+	r := NewReader(bytes.NewReader([]byte{byte(PUBACK << offsetPacketType), 2, 0}), ProtocolV311)
+
+	_, err := r.Read()
+	require.Equal(t, io.ErrUnexpectedEOF, err)
+}
+
+func TestReaderLargePacket(t *testing.T) {
+	// remaining length is not trusted thus truncated packet must not allocate it upfront
+	r := NewReader(bytes.NewReader([]byte{byte(PUBLISH << offsetPacketType), 0xFF, 0xFF, 0xFF, 0x7F}), ProtocolV311)
+
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+
+	_, err := r.Read()
+	require.Equal(t, io.ErrUnexpectedEOF, err)
+
+	runtime.ReadMemStats(&after)
+	require.Less(t, after.TotalAlloc-before.TotalAlloc, uint64(1024*1024))
+
+	pub := NewPublish(ProtocolV311)
+	require.NoError(t, pub.Set("topic", bytes.Repeat([]byte{0xAB}, readerChunk*3+7), QoS0, false, false))
+
+	buf, err := Encode(pub)
+	require.NoError(t, err)
+
+	r = NewReader(bytes.NewReader(buf), ProtocolV311)
+
+	pkt, err := r.Read()
+	require.NoError(t, err)
+	require.Equal(t, pub.Payload(), pkt.(*Publish).Payload())
+}
+
+type oneByteReader struct {
+	r io.Reader
+}
+
+func (r *oneByteReader) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	return r.r.Read(p[:1])
+}
@@ -241,6 +241,92 @@ var codeDescMap = map[ReasonCode]string{
 	CodeWildcardSubscriptionsNotSupported:  "Wildcard Subscriptions not supported",
 }
 
+var codeNameMap = map[ReasonCode]string{
+	CodeSuccess:                            "Success",
+	CodeRefusedUnacceptableProtocolVersion: "RefusedUnacceptableProtocolVersion",
+	CodeRefusedIdentifierRejected:          "RefusedIdentifierRejected",
+	CodeRefusedServerUnavailable:           "RefusedServerUnavailable",
+	CodeRefusedBadUsernameOrPassword:       "RefusedBadUsernameOrPassword",
+	CodeRefusedNotAuthorized:               "RefusedNotAuthorized",
+	CodeNoMatchingSubscribers:              "NoMatchingSubscribers",
+	CodeNoSubscriptionExisted:              "NoSubscriptionExisted",
+	CodeContinueAuthentication:             "ContinueAuthentication",
+	CodeReAuthenticate:                     "ReAuthenticate",
+	CodeUnspecifiedError:                   "UnspecifiedError",
+	CodeMalformedPacket:                    "MalformedPacket",
+	CodeProtocolError:                      "ProtocolError",
+	CodeImplementationSpecificError:        "ImplementationSpecificError",
+	CodeUnsupportedProtocol:                "UnsupportedProtocol",
+	CodeInvalidClientID:                    "InvalidClientID",
+	CodeBadUserOrPassword:                  "BadUserOrPassword",
+	CodeNotAuthorized:                      "NotAuthorized",
+	CodeServerUnavailable:                  "ServerUnavailable",
+	CodeServerBusy:                         "ServerBusy",
+	CodeBanned:                             "Banned",
+	CodeServerShuttingDown:                 "ServerShuttingDown",
+	CodeBadAuthMethod:                      "BadAuthMethod",
+	CodeKeepAliveTimeout:                   "KeepAliveTimeout",
+	CodeSessionTakenOver:                   "SessionTakenOver",
+	CodeInvalidTopicFilter:                 "InvalidTopicFilter",
+	CodeInvalidTopicName:                   "InvalidTopicName",
+	CodePacketIDInUse:                      "PacketIDInUse",
+	CodePacketIDNotFound:                   "PacketIDNotFound",
+	CodeReceiveMaximumExceeded:             "ReceiveMaximumExceeded",
+	CodeInvalidTopicAlias:                  "InvalidTopicAlias",
+	CodePacketTooLarge:                     "PacketTooLarge",
+	CodeMessageRateTooHigh:                 "MessageRateTooHigh",
+	CodeQuotaExceeded:                      "QuotaExceeded",
+	CodeAdministrativeAction:               "AdministrativeAction",
+	CodeInvalidPayloadFormat:               "InvalidPayloadFormat",
+	CodeRetainNotSupported:                 "RetainNotSupported",
+	CodeNotSupportedQoS:                    "NotSupportedQoS",
+	CodeUseAnotherServer:                   "UseAnotherServer",
+	CodeServerMoved:                        "ServerMoved",
+	CodeSharedSubscriptionNotSupported:     "SharedSubscriptionNotSupported",
+	CodeConnectionRateExceeded:             "ConnectionRateExceeded",
+	CodeMaximumConnectTime:                 "MaximumConnectTime",
+	CodeSubscriptionIDNotSupported:         "SubscriptionIDNotSupported",
+	CodeWildcardSubscriptionsNotSupported:  "WildcardSubscriptionsNotSupported",
+}
+
+// Name of the reason code, e.g. "MalformedPacket"
+func (c ReasonCode) Name() string {
+	if s, ok := codeNameMap[c]; ok {
+		return s
+	}
+
+	return "Unknown"
+}
+
+// NameForType name of the reason code in context of given packet type
+// SUBACK codes 0x00-0x02 named as granted QoS, e.g. "GrantedQoS1"
+func (c ReasonCode) NameForType(p Type) string {
+	if p == SUBACK && QosType(c).IsValid() {
+		return "Granted" + QosType(c).Desc()
+	}
+
+	return c.Name()
+}
+
+// reasonCodeByName reverse lookup of ReasonCode.NameForType
+func reasonCodeByName(p Type, name string) (ReasonCode, bool) {
+	if p == SUBACK {
+		for q := QoS0; q <= QoS2; q++ {
+			if name == "Granted"+q.Desc() {
+				return ReasonCode(q), true
+			}
+		}
+	}
+
+	for c, n := range codeNameMap {
+		if n == name {
+			return c, true
+		}
+	}
+
+	return 0, false
+}
+
 // PacketTypeDir check direction of packet type
 func (c ReasonCode) PacketTypeDir(p Type) (CodeIssuer, error) {
 	pT, ok := packetTypeCodeMap[p]
@@ -0,0 +1,110 @@
+package retained
+
+import (
+	"github.com/VolantMQ/vlapi/mqttp"
+	"github.com/VolantMQ/vlapi/vlpersistence"
+)
+
+// Persistent Store backed by persistence provider updating retained messages per topic
+// Messages are persisted as MQTT 5.0 packets, thus v3.1.1 ones are translated on Put.
+// Retained message has no packet ID, thus packet is encoded with QoS 0 and QoS is kept
+// in PersistedPacket.QoS.
+// Lookup returns messages with Publication Expiry set to the interval left
+type Persistent struct {
+	r vlpersistence.RetainedTopics
+}
+
+var _ Store = (*Persistent)(nil)
+
+// NewPersistent allocate store on top of r
+func NewPersistent(r vlpersistence.RetainedTopics) *Persistent {
+	return &Persistent{
+		r: r,
+	}
+}
+
+// Put retain message, see Store
+func (s *Persistent) Put(p *mqttp.Publish) error {
+	topic := p.Topic()
+
+	if !validTopic(topic) {
+		return mqttp.ErrInvalidTopic
+	}
+
+	if len(p.Payload()) == 0 {
+		return s.Delete(topic)
+	}
+
+	var msg *mqttp.Publish
+
+	if p.Version() == mqttp.ProtocolV50 {
+		var err error
+		if msg, err = p.Clone(mqttp.ProtocolV50); err != nil {
+			return err
+		}
+	} else {
+		pkt, _, err := mqttp.Translate(p, mqttp.ProtocolV50)
+		if err != nil {
+			return err
+		}
+
+		msg = pkt.(*mqttp.Publish)
+	}
+
+	// retained message has no packet ID, thus it is persisted as QoS 0 packet
+	qos := msg.QoS()
+	if err := msg.Set(topic, msg.Payload(), mqttp.QoS0, msg.Retain(), false); err != nil {
+		return err
+	}
+
+	persisted, err := vlpersistence.NewPersistedPacket(msg)
+	if err != nil {
+		return err
+	}
+
+	persisted.QoS = qos
+
+	return s.r.Put(topic, persisted)
+}
+
+// Delete retained message, see Store
+func (s *Persistent) Delete(topic string) error {
+	return s.r.Delete(topic)
+}
+
+// Lookup retained messages, see Store
+func (s *Persistent) Lookup(filter string) ([]*mqttp.Publish, error) {
+	if !validFilter(filter) {
+		return nil, mqttp.ErrInvalidTopic
+	}
+
+	packets, err := s.r.Lookup(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]*mqttp.Publish, 0, len(packets))
+
+	for _, p := range packets {
+		pkt, err := p.Decode(mqttp.ProtocolV50)
+		if err == vlpersistence.ErrExpired {
+			// might have expired since lookup
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		msg, ok := pkt.(*mqttp.Publish)
+		if !ok {
+			return nil, vlpersistence.ErrBrokenEntry
+		}
+
+		if err = msg.Set(msg.Topic(), msg.Payload(), p.QoS, msg.Retain(), false); err != nil {
+			return nil, vlpersistence.ErrBrokenEntry
+		}
+
+		res = append(res, msg)
+	}
+
+	return res, nil
+}
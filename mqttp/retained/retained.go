@@ -0,0 +1,323 @@
+// Package retained implements storage of retained messages as per [MQTT-3.3.1.3]
+// with per topic updates and lookup by subscription topic filter.
+// Memory keeps messages in memory, Persistent stores them with persistence provider
+// implementing vlpersistence.RetainedTopics.
+package retained
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/VolantMQ/vlapi/mqttp"
+)
+
+// Store of retained messages
+type Store interface {
+	// Put retain message for its topic replacing one retained before
+	// Message with empty payload removes retained message of the topic [MQTT-3.3.1-6] [MQTT-3.3.1-7]
+	// Store keeps own copy of the message, thus caller is free to modify or release p
+	Put(p *mqttp.Publish) error
+	// Delete retained message of the topic
+	Delete(topic string) error
+	// Lookup retained messages with topics matching filter, expired messages are dropped
+	Lookup(filter string) ([]*mqttp.Publish, error)
+}
+
+// ForSubscription retained messages to send on subscription as per [MQTT-3.3.1-9] - [MQTT-3.3.1-11]
+// exists reports whether subscription to the same topic filter has already existed in the session
+// Retained messages are not sent for shared subscriptions as per MQTT 5.0 section 4.8.2
+func ForSubscription(s Store, t *mqttp.Topic, exists bool) ([]*mqttp.Publish, error) {
+	if t.ShareName() != "" {
+		return nil, nil
+	}
+
+	switch t.Ops().RetainHandling() {
+	case mqttp.RetainHandlingRetain:
+	case mqttp.RetainHandlingIfNotExists:
+		if exists {
+			return nil, nil
+		}
+	default:
+		return nil, nil
+	}
+
+	return s.Lookup(t.Filter())
+}
+
+const (
+	levelSep    = "/"
+	singleLevel = "+"
+	multiLevel  = "#"
+)
+
+// Memory in-memory Store
+// Topics are kept in a tree, one node per level, thus lookup walks only branches filter matches
+type Memory struct {
+	lock  sync.RWMutex
+	root  *node
+	count int
+}
+
+type node struct {
+	children map[string]*node
+	msg      *mqttp.Publish
+}
+
+var _ Store = (*Memory)(nil)
+
+// NewMemory allocate empty in-memory store
+func NewMemory() *Memory {
+	return &Memory{
+		root: newNode(),
+	}
+}
+
+func newNode() *node {
+	return &node{
+		children: make(map[string]*node),
+	}
+}
+
+// Len number of retained messages, including expired ones not dropped yet
+func (m *Memory) Len() int {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	return m.count
+}
+
+// Put retain message, see Store
+func (m *Memory) Put(p *mqttp.Publish) error {
+	topic := p.Topic()
+
+	if !validTopic(topic) {
+		return mqttp.ErrInvalidTopic
+	}
+
+	if len(p.Payload()) == 0 {
+		return m.Delete(topic)
+	}
+
+	msg, err := p.Copy(p.Version())
+	if err != nil {
+		return err
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	n := m.root
+	for _, level := range strings.Split(topic, levelSep) {
+		child, ok := n.children[level]
+		if !ok {
+			child = newNode()
+			n.children[level] = child
+		}
+
+		n = child
+	}
+
+	if n.msg == nil {
+		m.count++
+	}
+
+	n.msg = msg
+
+	return nil
+}
+
+// Get retained message of the topic, nil if there is no one or it has expired
+func (m *Memory) Get(topic string) *mqttp.Publish {
+	m.lock.RLock()
+	n := m.root
+	for _, level := range strings.Split(topic, levelSep) {
+		if n = n.children[level]; n == nil {
+			break
+		}
+	}
+
+	var msg *mqttp.Publish
+	if n != nil {
+		msg = n.msg
+	}
+	m.lock.RUnlock()
+
+	if msg == nil {
+		return nil
+	}
+
+	if _, _, expired := msg.Expired(); expired {
+		m.deleteExpired([]string{topic})
+		return nil
+	}
+
+	return msg
+}
+
+// Delete retained message, see Store
+func (m *Memory) Delete(topic string) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.delete(topic, false)
+
+	return nil
+}
+
+// Lookup retained messages, see Store
+// Returned messages are shared with the store and must not be modified
+func (m *Memory) Lookup(filter string) ([]*mqttp.Publish, error) {
+	if !validFilter(filter) {
+		return nil, mqttp.ErrInvalidTopic
+	}
+
+	var res []*mqttp.Publish
+	var expired []string
+
+	m.lock.RLock()
+	m.root.lookup(strings.Split(filter, levelSep), 0, func(p *mqttp.Publish) {
+		if _, _, ok := p.Expired(); ok {
+			expired = append(expired, p.Topic())
+		} else {
+			res = append(res, p)
+		}
+	})
+	m.lock.RUnlock()
+
+	if len(expired) > 0 {
+		m.deleteExpired(expired)
+	}
+
+	return res, nil
+}
+
+// Purge drop expired messages, returns number of dropped ones
+func (m *Memory) Purge() int {
+	var expired []string
+
+	m.lock.RLock()
+	m.root.all(func(p *mqttp.Publish) {
+		if _, _, ok := p.Expired(); ok {
+			expired = append(expired, p.Topic())
+		}
+	})
+	m.lock.RUnlock()
+
+	return m.deleteExpired(expired)
+}
+
+// deleteExpired topics which messages have been found expired
+// message might have been replaced in between thus expiration is checked again
+func (m *Memory) deleteExpired(topics []string) int {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	count := 0
+
+	for _, topic := range topics {
+		if m.delete(topic, true) {
+			count++
+		}
+	}
+
+	return count
+}
+
+// delete message of the topic and prune branch left empty, must be called with lock held
+func (m *Memory) delete(topic string, onlyExpired bool) bool {
+	levels := strings.Split(topic, levelSep)
+	path := make([]*node, 0, len(levels)+1)
+	path = append(path, m.root)
+
+	n := m.root
+	for _, level := range levels {
+		if n = n.children[level]; n == nil {
+			return false
+		}
+
+		path = append(path, n)
+	}
+
+	if n.msg == nil {
+		return false
+	}
+
+	if _, _, expired := n.msg.Expired(); onlyExpired && !expired {
+		return false
+	}
+
+	n.msg = nil
+	m.count--
+
+	for i := len(path) - 1; i > 0; i-- {
+		if path[i].msg != nil || len(path[i].children) != 0 {
+			break
+		}
+
+		delete(path[i-1].children, levels[i-1])
+	}
+
+	return true
+}
+
+// lookup messages of topics matching filter levels starting from i
+// wildcards at first level do not match topics starting with $ [MQTT-4.7.2-1]
+func (n *node) lookup(levels []string, i int, fn func(*mqttp.Publish)) {
+	if i == len(levels) {
+		if n.msg != nil {
+			fn(n.msg)
+		}
+
+		return
+	}
+
+	switch levels[i] {
+	case multiLevel:
+		// "sport/#" matches "sport" as well [MQTT-4.7.1-2]
+		if n.msg != nil {
+			fn(n.msg)
+		}
+
+		for name, child := range n.children {
+			if i == 0 && strings.HasPrefix(name, "$") {
+				continue
+			}
+
+			child.all(fn)
+		}
+	case singleLevel:
+		for name, child := range n.children {
+			if i == 0 && strings.HasPrefix(name, "$") {
+				continue
+			}
+
+			child.lookup(levels, i+1, fn)
+		}
+	default:
+		if child, ok := n.children[levels[i]]; ok {
+			child.lookup(levels, i+1, fn)
+		}
+	}
+}
+
+func (n *node) all(fn func(*mqttp.Publish)) {
+	if n.msg != nil {
+		fn(n.msg)
+	}
+
+	for _, child := range n.children {
+		child.all(fn)
+	}
+}
+
+func validTopic(topic string) bool {
+	b := []byte(topic)
+
+	return len(b) > 0 && mqttp.IsValidUTF(b) && mqttp.TopicPublishRegexp.Match(b)
+}
+
+func validFilter(filter string) bool {
+	b := []byte(filter)
+
+	return len(b) > 0 && mqttp.IsValidUTF(b) && mqttp.TopicFilterRegexp.Match(b)
+}
@@ -0,0 +1,282 @@
+package retained
+
+import (
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/VolantMQ/vlapi/mqttp"
+	"github.com/VolantMQ/vlapi/vlpersistence"
+	"github.com/VolantMQ/vlapi/vlpersistence/mem"
+)
+
+func newRetained(t *testing.T, topic string, payload string) *mqttp.Publish {
+	p := mqttp.NewPublish(mqttp.ProtocolV50)
+	require.NoError(t, p.Set(topic, []byte(payload), mqttp.QoS1, true, false))
+
+	return p
+}
+
+func lookupTopics(t *testing.T, s Store, filter string) []string {
+	msgs, err := s.Lookup(filter)
+	require.NoError(t, err)
+
+	var res []string
+	for _, m := range msgs {
+		res = append(res, m.Topic())
+	}
+
+	sort.Strings(res)
+
+	return res
+}
+
+func TestMemoryLookup(t *testing.T) {
+	s := NewMemory()
+
+	for _, topic := range []string{"sport", "sport/tennis", "sport/tennis/player1", "sport/golf", "/a", "$SYS/uptime"} {
+		require.NoError(t, s.Put(newRetained(t, topic, "v")))
+	}
+
+	require.Equal(t, 6, s.Len())
+
+	tests := map[string][]string{
+		"#":              {"/a", "sport", "sport/golf", "sport/tennis", "sport/tennis/player1"},
+		"sport/#":        {"sport", "sport/golf", "sport/tennis", "sport/tennis/player1"},
+		"sport/+":        {"sport/golf", "sport/tennis"},
+		"+":              {"sport"},
+		"+/+":            {"/a", "sport/golf", "sport/tennis"},
+		"sport/+/+":      {"sport/tennis/player1"},
+		"sport/tennis":   {"sport/tennis"},
+		"$SYS/#":         {"$SYS/uptime"},
+		"+/uptime":       nil,
+		"sport/football": nil,
+	}
+
+	for filter, expected := range tests {
+		require.Equal(t, expected, lookupTopics(t, s, filter), filter)
+	}
+
+	_, err := s.Lookup("sport/#/a")
+	require.Equal(t, mqttp.ErrInvalidTopic, err)
+	require.Equal(t, mqttp.ErrInvalidTopic, s.Put(newRetained(t, "", "v")))
+}
+
+func TestMemoryPutDelete(t *testing.T) {
+	s := NewMemory()
+
+	require.NoError(t, s.Put(newRetained(t, "a/b", "1")))
+	require.NoError(t, s.Put(newRetained(t, "a/b", "2")))
+	require.Equal(t, 1, s.Len())
+	require.Equal(t, []byte("2"), s.Get("a/b").Payload())
+
+	// empty payload removes retained message
+	require.NoError(t, s.Put(newRetained(t, "a/b", "")))
+	require.Equal(t, 0, s.Len())
+	require.Nil(t, s.Get("a/b"))
+	require.Empty(t, s.root.children)
+
+	require.NoError(t, s.Put(newRetained(t, "a/b", "1")))
+	require.NoError(t, s.Put(newRetained(t, "a/b/c", "1")))
+	require.NoError(t, s.Delete("a/b"))
+	require.NoError(t, s.Delete("a/b"))
+	require.Equal(t, []string{"a/b/c"}, lookupTopics(t, s, "#"))
+}
+
+func TestMemoryPutCopy(t *testing.T) {
+	s := NewMemory()
+
+	p := newRetained(t, "a/b", "1")
+	require.NoError(t, s.Put(p))
+
+	// caller reuses packet
+	mqttp.Release(p)
+
+	msg := s.Get("a/b")
+	require.NotNil(t, msg)
+	require.Equal(t, "a/b", msg.Topic())
+	require.Equal(t, []byte("1"), msg.Payload())
+	require.True(t, msg.Retain())
+
+	// caller modifies payload and properties it has set
+	payload := []byte("3")
+	correlation := []byte("c")
+	users := []mqttp.StringPair{{K: "k", V: "v"}}
+
+	p = newRetained(t, "a/d", "")
+	require.NoError(t, p.Set("a/d", payload, mqttp.QoS1, true, false))
+	require.NoError(t, p.PropertySet(mqttp.PropertyCorrelationData, correlation))
+	require.NoError(t, p.PropertySet(mqttp.PropertyUserProperty, users))
+	require.NoError(t, s.Put(p))
+
+	payload[0] = 'x'
+	correlation[0] = 'x'
+	users[0].V = "x"
+
+	msg = s.Get("a/d")
+	require.Equal(t, []byte("3"), msg.Payload())
+
+	data, err := msg.PropertyGet(mqttp.PropertyCorrelationData).AsBinary()
+	require.NoError(t, err)
+	require.Equal(t, []byte("c"), data)
+
+	pairs, err := msg.PropertyGet(mqttp.PropertyUserProperty).AsStringPairs()
+	require.NoError(t, err)
+	require.Equal(t, []mqttp.StringPair{{K: "k", V: "v"}}, pairs)
+
+	// payload aliasing decode buffer is copied as well
+	p = newRetained(t, "a/c", "2")
+	p.SetPacketID(1)
+
+	buf, err := mqttp.Encode(p)
+	require.NoError(t, err)
+
+	pkt, _, err := mqttp.DecodeWithOptions(buf, mqttp.DecodeOptions{Version: mqttp.ProtocolV50, NoCopy: true})
+	require.NoError(t, err)
+	require.NoError(t, s.Put(pkt.(*mqttp.Publish)))
+
+	for i := range buf {
+		buf[i] = 'x'
+	}
+
+	require.Equal(t, []byte("2"), s.Get("a/c").Payload())
+}
+
+func TestMemoryExpiry(t *testing.T) {
+	s := NewMemory()
+
+	expired := newRetained(t, "a", "v")
+	expired.SetExpireAt(time.Now().Add(-time.Second))
+	require.NoError(t, s.Put(expired))
+
+	alive := newRetained(t, "b", "v")
+	alive.SetExpireAt(time.Now().Add(time.Hour))
+	require.NoError(t, s.Put(alive))
+
+	require.NoError(t, s.Put(newRetained(t, "c", "v")))
+	require.NoError(t, s.Put(newRetained(t, "d/e", "v")))
+
+	require.Equal(t, []string{"b", "c"}, lookupTopics(t, s, "+"))
+	require.Equal(t, 3, s.Len())
+
+	expired = newRetained(t, "d/e", "v")
+	expired.SetExpireAt(time.Now().Add(-time.Second))
+	require.NoError(t, s.Put(expired))
+
+	require.Equal(t, 1, s.Purge())
+	require.Equal(t, 2, s.Len())
+}
+
+func TestForSubscription(t *testing.T) {
+	s := NewMemory()
+	require.NoError(t, s.Put(newRetained(t, "a/b", "v")))
+
+	subscribe := func(topic string, rh mqttp.RetainHandling, exists bool) int {
+		topicObj, err := mqttp.NewSubscribeTopic([]byte(topic), mqttp.SubscriptionOptions(byte(rh)<<4))
+		require.NoError(t, err)
+
+		msgs, err := ForSubscription(s, topicObj, exists)
+		require.NoError(t, err)
+
+		return len(msgs)
+	}
+
+	require.Equal(t, 1, subscribe("a/+", mqttp.RetainHandlingRetain, false))
+	require.Equal(t, 1, subscribe("a/+", mqttp.RetainHandlingRetain, true))
+	require.Equal(t, 1, subscribe("a/+", mqttp.RetainHandlingIfNotExists, false))
+	require.Equal(t, 0, subscribe("a/+", mqttp.RetainHandlingIfNotExists, true))
+	require.Equal(t, 0, subscribe("a/+", mqttp.RetainHandlingDoNotRetain, false))
+	require.Equal(t, 0, subscribe("$share/g/a/+", mqttp.RetainHandlingRetain, false))
+}
+
+func newPersistent(t *testing.T) *Persistent {
+	r, err := mem.New().Retained()
+	require.NoError(t, err)
+
+	return NewPersistent(r.(vlpersistence.RetainedTopics))
+}
+
+func TestPersistent(t *testing.T) {
+	s := newPersistent(t)
+
+	for _, topic := range []string{"sport", "sport/tennis", "sport/golf", "$SYS/uptime"} {
+		require.NoError(t, s.Put(newRetained(t, topic, "v")))
+	}
+
+	require.Equal(t, []string{"sport", "sport/golf", "sport/tennis"}, lookupTopics(t, s, "#"))
+	require.Equal(t, []string{"sport/golf", "sport/tennis"}, lookupTopics(t, s, "sport/+"))
+	require.Equal(t, []string{"$SYS/uptime"}, lookupTopics(t, s, "$SYS/#"))
+
+	// empty payload removes retained message
+	require.NoError(t, s.Put(newRetained(t, "sport/golf", "")))
+	require.NoError(t, s.Delete("sport/tennis"))
+	require.Equal(t, []string{"sport"}, lookupTopics(t, s, "#"))
+
+	_, err := s.Lookup("sport/#/a")
+	require.Equal(t, mqttp.ErrInvalidTopic, err)
+	require.Equal(t, mqttp.ErrInvalidTopic, s.Put(newRetained(t, "", "v")))
+
+	// v3.1.1 message is persisted as v5.0 one
+	p := mqttp.NewPublish(mqttp.ProtocolV311)
+	require.NoError(t, p.Set("v3", []byte("data"), mqttp.QoS1, true, false))
+	require.NoError(t, s.Put(p))
+
+	msgs, err := s.Lookup("v3")
+	require.NoError(t, err)
+	require.Len(t, msgs, 1)
+	require.Equal(t, mqttp.ProtocolV50, msgs[0].Version())
+	require.Equal(t, []byte("data"), msgs[0].Payload())
+	require.Equal(t, mqttp.QoS1, msgs[0].QoS())
+	require.True(t, msgs[0].Retain())
+
+	// packet ID is assigned on delivery
+	_, err = msgs[0].ID()
+	require.Equal(t, mqttp.ErrNotSet, err)
+
+	// retained message is persisted without packet ID along with its QoS
+	p = newRetained(t, "q2", "data")
+	require.NoError(t, p.Set("q2", []byte("data"), mqttp.QoS2, true, false))
+	require.NoError(t, s.Put(p))
+
+	persisted, err := s.r.Lookup("q2")
+	require.NoError(t, err)
+	require.Len(t, persisted, 1)
+	require.Equal(t, mqttp.QoS2, persisted[0].QoS)
+
+	pkt, err := persisted[0].Decode(mqttp.ProtocolV50)
+	require.NoError(t, err)
+	require.Equal(t, mqttp.QoS0, pkt.(*mqttp.Publish).QoS())
+
+	msgs, err = s.Lookup("q2")
+	require.NoError(t, err)
+	require.Len(t, msgs, 1)
+	require.Equal(t, mqttp.QoS2, msgs[0].QoS())
+	require.Equal(t, []byte("data"), msgs[0].Payload())
+}
+
+func TestPersistentExpiry(t *testing.T) {
+	s := newPersistent(t)
+
+	expired := newRetained(t, "a", "v")
+	expired.SetExpireAt(time.Now().Add(-time.Second))
+	require.NoError(t, s.Put(expired))
+
+	alive := newRetained(t, "b", "v")
+	alive.SetExpireAt(time.Now().Add(time.Hour))
+	require.NoError(t, s.Put(alive))
+
+	msgs, err := s.Lookup("+")
+	require.NoError(t, err)
+	require.Len(t, msgs, 1)
+	require.Equal(t, "b", msgs[0].Topic())
+
+	// Publication Expiry is the interval left
+	_, left, isExpired := msgs[0].Expired()
+	require.False(t, isExpired)
+
+	expiry, ok := msgs[0].MessageExpiry()
+	require.True(t, ok)
+	require.Equal(t, time.Duration(left)*time.Second, expiry)
+}
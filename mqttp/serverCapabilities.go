@@ -0,0 +1,223 @@
+package mqttp
+
+import (
+	"bytes"
+)
+
+// ServerCapabilities features server announces to client in CONNACK
+// and enforces on incoming CONNECT, SUBSCRIBE and PUBLISH packets
+type ServerCapabilities struct {
+	// MaximumQoS highest QoS server accepts in PUBLISH and grants in SUBACK
+	MaximumQoS QosType
+	// RetainAvailable retained messages supported
+	RetainAvailable bool
+	// WildcardSubscriptionAvailable subscriptions with topic filters containing wildcards supported
+	WildcardSubscriptionAvailable bool
+	// SharedSubscriptionAvailable shared subscriptions supported
+	SharedSubscriptionAvailable bool
+	// SubscriptionIDAvailable subscription identifiers supported
+	SubscriptionIDAvailable bool
+	// MaximumPacketSize largest packet server accepts, 0 means limit defined by the spec
+	MaximumPacketSize uint32
+	// ServerKeepAlive keep alive client must use instead of requested one, 0 if not overridden
+	ServerKeepAlive uint16
+}
+
+// NewServerCapabilities allocate capabilities with every feature available
+// which is what client assumes if CONNACK does not state otherwise
+func NewServerCapabilities() *ServerCapabilities {
+	return &ServerCapabilities{
+		MaximumQoS:                    QoS2,
+		RetainAvailable:               true,
+		WildcardSubscriptionAvailable: true,
+		SharedSubscriptionAvailable:   true,
+		SubscriptionIDAvailable:       true,
+	}
+}
+
+// ParseServerCapabilities received by client in CONNACK
+// V3.1.1 CONNACK does not carry capabilities thus every feature considered available
+func ParseServerCapabilities(ack *ConnAck) (*ServerCapabilities, error) {
+	c := NewServerCapabilities()
+
+	if ack.Version() < ProtocolV50 {
+		return c, nil
+	}
+
+	if qos, ok := ack.MaximumQoS(); ok {
+		// [MQTT-3.2.2.3.4] value is 0 or 1
+		if qos > QoS1 {
+			return nil, CodeProtocolError
+		}
+
+		c.MaximumQoS = qos
+	}
+
+	if v, ok := ack.RetainAvailable(); ok {
+		c.RetainAvailable = v
+	}
+
+	if v, ok := ack.WildcardSubscriptionAvailable(); ok {
+		c.WildcardSubscriptionAvailable = v
+	}
+
+	if v, ok := ack.SharedSubscriptionAvailable(); ok {
+		c.SharedSubscriptionAvailable = v
+	}
+
+	if v, ok := ack.SubscriptionIDAvailable(); ok {
+		c.SubscriptionIDAvailable = v
+	}
+
+	if v, ok := ack.MaximumPacketSize(); ok {
+		// [MQTT-3.2.2.3.6] zero is not allowed
+		if v == 0 {
+			return nil, CodeProtocolError
+		}
+
+		c.MaximumPacketSize = v
+	}
+
+	if v, ok := ack.ServerKeepAlive(); ok {
+		c.ServerKeepAlive = v
+	}
+
+	return c, nil
+}
+
+// Apply capabilities to CONNACK sent by server
+// Only features which are not available are set as absence of property means available
+// No-op for V3.1.1 CONNACK
+func (c *ServerCapabilities) Apply(ack *ConnAck) error {
+	if ack.Version() < ProtocolV50 {
+		return nil
+	}
+
+	if !c.MaximumQoS.IsValid() {
+		return ErrInvalidQoS
+	}
+
+	var err error
+
+	set := func(fn func() error) {
+		if err == nil {
+			err = fn()
+		}
+	}
+
+	if c.MaximumQoS < QoS2 {
+		set(func() error { return ack.SetMaximumQoS(c.MaximumQoS) })
+	}
+
+	if !c.RetainAvailable {
+		set(func() error { return ack.SetRetainAvailable(false) })
+	}
+
+	if !c.WildcardSubscriptionAvailable {
+		set(func() error { return ack.SetWildcardSubscriptionAvailable(false) })
+	}
+
+	if !c.SharedSubscriptionAvailable {
+		set(func() error { return ack.SetSharedSubscriptionAvailable(false) })
+	}
+
+	if !c.SubscriptionIDAvailable {
+		set(func() error { return ack.SetSubscriptionIDAvailable(false) })
+	}
+
+	if c.MaximumPacketSize > 0 {
+		set(func() error { return ack.SetMaximumPacketSize(c.MaximumPacketSize) })
+	}
+
+	if c.ServerKeepAlive > 0 {
+		set(func() error { return ack.SetServerKeepAlive(c.ServerKeepAlive) })
+	}
+
+	return err
+}
+
+// ValidateConnect check will message of incoming CONNECT against capabilities
+// returns reason code server should refuse connection with
+func (c *ServerCapabilities) ValidateConnect(msg *Connect) error {
+	if msg.will == nil {
+		return nil
+	}
+
+	return c.validateQoSRetain(msg.will)
+}
+
+// ValidatePublish check incoming PUBLISH against capabilities
+// returns reason code server should disconnect with
+func (c *ServerCapabilities) ValidatePublish(p *Publish) error {
+	if err := c.validateQoSRetain(p); err != nil {
+		return err
+	}
+
+	if c.MaximumPacketSize > 0 {
+		size, err := p.Size()
+		if err != nil {
+			return err
+		}
+
+		if uint32(size) > c.MaximumPacketSize {
+			return CodePacketTooLarge
+		}
+	}
+
+	return nil
+}
+
+func (c *ServerCapabilities) validateQoSRetain(p *Publish) error {
+	if p.QoS() > c.MaximumQoS {
+		return CodeNotSupportedQoS
+	}
+
+	if p.Retain() && !c.RetainAvailable {
+		return CodeRetainNotSupported
+	}
+
+	return nil
+}
+
+// ValidateTopic check subscription topic against capabilities
+// returns QoS to grant or failure reason code to reply with in SUBACK
+func (c *ServerCapabilities) ValidateTopic(t *Topic) ReasonCode {
+	if t.ShareName() != "" && !c.SharedSubscriptionAvailable {
+		return CodeSharedSubscriptionNotSupported
+	}
+
+	if !c.WildcardSubscriptionAvailable && bytes.ContainsAny(t.filter, "+#") {
+		return CodeWildcardSubscriptionsNotSupported
+	}
+
+	// server grants lower QoS rather than rejects subscription
+	qos := t.Ops().QoS()
+	if qos > c.MaximumQoS {
+		qos = c.MaximumQoS
+	}
+
+	return ReasonCode(qos)
+}
+
+// ValidateSubscribe check incoming SUBSCRIBE against capabilities
+// returns codes to reply with in SUBACK in order of topics. For V3.1.1 packet
+// any failure reported as CodeUnspecifiedError.
+// Error means whole packet must be rejected, e.g. with CodeSubscriptionIDNotSupported
+func (c *ServerCapabilities) ValidateSubscribe(msg *Subscribe) ([]ReasonCode, error) {
+	if _, ok := msg.SubscriptionID(); ok && !c.SubscriptionIDAvailable {
+		return nil, CodeSubscriptionIDNotSupported
+	}
+
+	codes := make([]ReasonCode, 0, len(msg.topics))
+
+	for _, t := range msg.topics {
+		code := c.ValidateTopic(t)
+		if msg.version < ProtocolV50 && code >= CodeUnspecifiedError {
+			code = CodeUnspecifiedError
+		}
+
+		codes = append(codes, code)
+	}
+
+	return codes, nil
+}
@@ -0,0 +1,113 @@
+package mqttp
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestServerCapabilitiesConnAck(t *testing.T) {
+	caps := NewServerCapabilities()
+
+	ack := NewConnAck(ProtocolV50)
+	require.NoError(t, caps.Apply(ack))
+	require.Equal(t, 0, ack.properties.FullLen()-1, "defaults must not be sent")
+
+	caps.MaximumQoS = QoS1
+	caps.RetainAvailable = false
+	caps.WildcardSubscriptionAvailable = false
+	caps.SharedSubscriptionAvailable = false
+	caps.SubscriptionIDAvailable = false
+	caps.MaximumPacketSize = 1024
+	caps.ServerKeepAlive = 30
+
+	ack = NewConnAck(ProtocolV50)
+	require.NoError(t, caps.Apply(ack))
+
+	buf, err := Encode(ack)
+	require.NoError(t, err)
+
+	m, _, err := Decode(ProtocolV50, buf)
+	require.NoError(t, err)
+
+	parsed, err := ParseServerCapabilities(m.(*ConnAck))
+	require.NoError(t, err)
+	require.Equal(t, caps, parsed)
+
+	// V3.1.1 has no capabilities
+	ack = NewConnAck(ProtocolV311)
+	require.NoError(t, caps.Apply(ack))
+
+	parsed, err = ParseServerCapabilities(ack)
+	require.NoError(t, err)
+	require.Equal(t, NewServerCapabilities(), parsed)
+
+	ack = NewConnAck(ProtocolV50)
+	require.NoError(t, ack.SetMaximumQoS(QoS2))
+
+	_, err = ParseServerCapabilities(ack)
+	require.Equal(t, CodeProtocolError, err)
+}
+
+func TestServerCapabilitiesPublish(t *testing.T) {
+	caps := NewServerCapabilities()
+	caps.MaximumQoS = QoS1
+	caps.RetainAvailable = false
+	caps.MaximumPacketSize = 16
+
+	pub := NewPublish(ProtocolV50)
+	require.NoError(t, pub.Set("a/b", []byte("1"), QoS1, false, false))
+	pub.SetPacketID(1)
+	require.NoError(t, caps.ValidatePublish(pub))
+
+	require.NoError(t, pub.SetQoS(QoS2))
+	require.Equal(t, CodeNotSupportedQoS, caps.ValidatePublish(pub))
+
+	require.NoError(t, pub.SetQoS(QoS0))
+	pub.SetRetain(true)
+	require.Equal(t, CodeRetainNotSupported, caps.ValidatePublish(pub))
+
+	pub.SetRetain(false)
+	pub.SetPayload(make([]byte, 16))
+	require.Equal(t, CodePacketTooLarge, caps.ValidatePublish(pub))
+
+	will := NewPublish(ProtocolV50)
+	require.NoError(t, will.Set("will", []byte("bye"), QoS2, false, false))
+
+	connect := NewConnect(ProtocolV50)
+	require.NoError(t, caps.ValidateConnect(connect))
+	require.NoError(t, connect.SetWill(will))
+	require.Equal(t, CodeNotSupportedQoS, caps.ValidateConnect(connect))
+}
+
+func TestServerCapabilitiesSubscribe(t *testing.T) {
+	caps := NewServerCapabilities()
+	caps.MaximumQoS = QoS1
+	caps.WildcardSubscriptionAvailable = false
+	caps.SharedSubscriptionAvailable = false
+	caps.SubscriptionIDAvailable = false
+
+	for _, v := range []ProtocolVersion{ProtocolV311, ProtocolV50} {
+		msg := NewSubscribe(v)
+		msg.SetPacketID(1)
+
+		for _, topic := range []string{"a/b", "a/+", "$share/g/a/b"} {
+			tp, err := NewSubscribeTopic([]byte(topic), SubscriptionOptions(QoS2))
+			require.NoError(t, err)
+			require.NoError(t, msg.AddTopic(tp))
+		}
+
+		codes, err := caps.ValidateSubscribe(msg)
+		require.NoError(t, err)
+
+		if v == ProtocolV50 {
+			require.Equal(t, []ReasonCode{1, CodeWildcardSubscriptionsNotSupported, CodeSharedSubscriptionNotSupported}, codes)
+
+			require.NoError(t, msg.SetSubscriptionID(10))
+			_, err = caps.ValidateSubscribe(msg)
+			require.Equal(t, CodeSubscriptionIDNotSupported, err)
+		} else {
+			require.Equal(t, []ReasonCode{1, CodeUnspecifiedError, CodeUnspecifiedError}, codes)
+		}
+	}
+}
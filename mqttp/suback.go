@@ -133,3 +133,8 @@ func (msg *SubAck) size() int {
 
 	return total
 }
+
+func (msg *SubAck) reset() {
+	msg.resetHeader()
+	msg.returnCodes = msg.returnCodes[:0]
+}
@@ -97,7 +97,7 @@ func (msg *Subscribe) decodeMessage(from []byte) (int, error) {
 			if msg.version <= ProtocolV50 {
 				rejectReason = CodeRefusedServerUnavailable
 			}
-			return 0, rejectReason
+			return 0, violation(rejectReason, "MQTT-3.8.3-1")
 		}
 
 		if len(from[offset:]) < 1 {
@@ -107,9 +107,10 @@ func (msg *Subscribe) decodeMessage(from []byte) (int, error) {
 		subsOptions := SubscriptionOptions(from[offset])
 		offset++
 
+		// [MQTT-3.8.3-4] [MQTT-3.8.3-5]
 		if (msg.version == ProtocolV50 && (subsOptions.Raw()&maskSubscriptionReservedV5) != 0) ||
 			(msg.version < ProtocolV50 && (subsOptions.Raw()&maskSubscriptionReservedV3) != 0) {
-			return offset, CodeMalformedPacket
+			return offset, violation(CodeMalformedPacket, "MQTT-3.8.3-4")
 		}
 
 		var topic *Topic
@@ -128,7 +129,7 @@ func (msg *Subscribe) decodeMessage(from []byte) (int, error) {
 		if msg.version <= ProtocolV50 {
 			rejectReason = CodeRefusedServerUnavailable
 		}
-		return 0, rejectReason
+		return 0, violation(rejectReason, "MQTT-3.8.3-3")
 	}
 
 	return offset, nil
@@ -180,3 +181,13 @@ func (msg *Subscribe) size() int {
 
 	return total
 }
+
+func (msg *Subscribe) reset() {
+	msg.resetHeader()
+
+	for i := range msg.topics {
+		msg.topics[i] = nil
+	}
+
+	msg.topics = msg.topics[:0]
+}
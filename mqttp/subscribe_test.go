@@ -92,7 +92,7 @@ func TestSubscribeMessageDecodeInvalidTopics(t *testing.T) {
 	}
 
 	_, _, err := Decode(ProtocolV311, buf)
-	require.EqualError(t, err, CodeMalformedPacket.Error(), "Error decoding message.")
+	requireErrorIs(t, err, CodeMalformedPacket)
 }
 
 func TestSubscribeMessageDecodeNoTopics(t *testing.T) {
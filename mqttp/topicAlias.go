@@ -0,0 +1,211 @@
+package mqttp
+
+import (
+	"container/list"
+	"sync"
+)
+
+// TopicAliases keeps topic alias mappings of single V5.0 connection as per [MQTT-3.3.2.3.4]
+// Inbound mappings are set by the peer and used to restore topic of received PUBLISH packets,
+// outbound mappings are assigned to sent PUBLISH packets with least recently used policy
+// bounded by Topic Alias Maximum announced by the peer
+type TopicAliases struct {
+	inLock      sync.Mutex
+	inbound     map[uint16]string
+	inboundMax  uint16
+	outLock     sync.Mutex
+	outbound    map[string]*list.Element
+	lru         *list.List
+	outboundMax uint16
+}
+
+type topicAliasEntry struct {
+	topic string
+	alias uint16
+}
+
+// NewTopicAliases allocate aliases of connection
+// inbound is Topic Alias Maximum this side announced to the peer, outbound is Topic Alias Maximum
+// announced by the peer. 0 disables aliases in respective direction
+func NewTopicAliases(inbound, outbound uint16) *TopicAliases {
+	return &TopicAliases{
+		inbound:     make(map[uint16]string),
+		inboundMax:  inbound,
+		outbound:    make(map[string]*list.Element),
+		lru:         list.New(),
+		outboundMax: outbound,
+	}
+}
+
+// InboundMaximum Topic Alias Maximum accepted from the peer
+func (a *TopicAliases) InboundMaximum() uint16 {
+	a.inLock.Lock()
+	defer a.inLock.Unlock()
+
+	return a.inboundMax
+}
+
+// OutboundMaximum Topic Alias Maximum accepted by the peer
+func (a *TopicAliases) OutboundMaximum() uint16 {
+	a.outLock.Lock()
+	defer a.outLock.Unlock()
+
+	return a.outboundMax
+}
+
+// SetOutboundMaximum update Topic Alias Maximum accepted by the peer, e.g. once CONNACK received
+// mappings with aliases above new maximum are dropped
+func (a *TopicAliases) SetOutboundMaximum(v uint16) {
+	a.outLock.Lock()
+	defer a.outLock.Unlock()
+
+	a.outboundMax = v
+
+	for e := a.lru.Front(); e != nil; {
+		next := e.Next()
+
+		if entry := e.Value.(*topicAliasEntry); entry.alias > v {
+			delete(a.outbound, entry.topic)
+			a.lru.Remove(e)
+		}
+
+		e = next
+	}
+}
+
+// Reset drops all mappings
+// Topic Alias mappings exist only within a Network Connection [MQTT-3.3.2-7]
+func (a *TopicAliases) Reset() {
+	a.inLock.Lock()
+	for k := range a.inbound {
+		delete(a.inbound, k)
+	}
+	a.inLock.Unlock()
+
+	a.outLock.Lock()
+	for k := range a.outbound {
+		delete(a.outbound, k)
+	}
+	a.lru.Init()
+	a.outLock.Unlock()
+}
+
+// Resolve inbound PUBLISH packet
+// If packet carries Topic Alias along with topic, mapping is set. If topic is empty it is restored
+// from mapping set earlier. Topic Alias property is left as is.
+// Returns CodeInvalidTopicAlias if alias is 0, exceeds announced maximum or has no mapping
+// and CodeProtocolError if packet has neither topic nor alias
+func (a *TopicAliases) Resolve(p *Publish) error {
+	if p.version < ProtocolV50 {
+		return nil
+	}
+
+	alias, ok, err := topicAliasOf(p)
+	if err != nil {
+		return err
+	}
+
+	if !ok {
+		// It is a Protocol Error if the Topic Name is zero length and there is no Topic Alias
+		if len(p.topic) == 0 {
+			return CodeProtocolError
+		}
+
+		return nil
+	}
+
+	a.inLock.Lock()
+	defer a.inLock.Unlock()
+
+	// [MQTT-3.3.2-8] [MQTT-3.3.2-9]
+	if alias == 0 || alias > a.inboundMax {
+		return CodeInvalidTopicAlias
+	}
+
+	if len(p.topic) != 0 {
+		a.inbound[alias] = p.topic
+		return nil
+	}
+
+	topic, ok := a.inbound[alias]
+	if !ok {
+		return CodeInvalidTopicAlias
+	}
+
+	p.topic = topic
+
+	return nil
+}
+
+// Assign alias to outbound PUBLISH packet and rewrite it before encode
+// If topic already has an alias packet is sent with empty topic and alias only,
+// otherwise new alias is allocated, or least recently used one is reassigned once
+// peer maximum is reached, and packet carries both topic and alias to set mapping.
+// Topic Alias set by other party, e.g. retained from inbound packet, is replaced.
+// Packet must not be shared with other connections, as well as rewritten packet
+// must not be persisted for retransmission on another connection.
+func (a *TopicAliases) Assign(p *Publish) error {
+	if p.version < ProtocolV50 {
+		return nil
+	}
+
+	p.properties.delete(PropertyTopicAlias)
+
+	if len(p.topic) == 0 {
+		return CodeProtocolError
+	}
+
+	a.outLock.Lock()
+	defer a.outLock.Unlock()
+
+	if a.outboundMax == 0 {
+		return nil
+	}
+
+	if e, ok := a.outbound[p.topic]; ok {
+		a.lru.MoveToFront(e)
+
+		if err := p.properties.Set(p.mType, PropertyTopicAlias, e.Value.(*topicAliasEntry).alias); err != nil {
+			return err
+		}
+
+		p.topic = ""
+
+		return nil
+	}
+
+	var entry *topicAliasEntry
+
+	if a.lru.Len() < int(a.outboundMax) {
+		// aliases in use are always 1..Len as evicted alias is reassigned
+		// and shrinking maximum drops the ones above it
+		entry = &topicAliasEntry{
+			alias: uint16(a.lru.Len() + 1),
+		}
+	} else {
+		e := a.lru.Back()
+		entry = e.Value.(*topicAliasEntry)
+		delete(a.outbound, entry.topic)
+		a.lru.Remove(e)
+	}
+
+	entry.topic = p.topic
+	a.outbound[p.topic] = a.lru.PushFront(entry)
+
+	return p.properties.Set(p.mType, PropertyTopicAlias, entry.alias)
+}
+
+// topicAliasOf returns Topic Alias carried by packet if any
+func topicAliasOf(p *Publish) (uint16, bool, error) {
+	prop := p.properties.Get(PropertyTopicAlias)
+	if prop == nil {
+		return 0, false, nil
+	}
+
+	alias, err := prop.AsShort()
+	if err != nil {
+		return 0, false, CodeInvalidTopicAlias
+	}
+
+	return alias, true, nil
+}
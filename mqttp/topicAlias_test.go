@@ -0,0 +1,129 @@
+package mqttp
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newAliasPublish(t *testing.T, topic string) *Publish {
+	p := NewPublish(ProtocolV50)
+	require.NoError(t, p.Set(topic, []byte("data"), QoS0, false, false))
+
+	return p
+}
+
+func requireAlias(t *testing.T, p *Publish, alias uint16) {
+	prop := p.PropertyGet(PropertyTopicAlias)
+	require.NotNil(t, prop)
+
+	v, err := prop.AsShort()
+	require.NoError(t, err)
+	require.Equal(t, alias, v)
+}
+
+func TestTopicAliasesRoundTrip(t *testing.T) {
+	sender := NewTopicAliases(0, 10)
+	receiver := NewTopicAliases(10, 0)
+
+	for i, expectedTopic := range []string{"a/b", "a/b", "c/d", "a/b"} {
+		p := newAliasPublish(t, expectedTopic)
+		require.NoError(t, sender.Assign(p))
+
+		if i == 1 || i == 3 {
+			require.Empty(t, p.Topic())
+		}
+
+		buf, err := Encode(p)
+		require.NoError(t, err)
+
+		m, _, err := Decode(ProtocolV50, buf)
+		require.NoError(t, err)
+
+		received := m.(*Publish)
+		require.NoError(t, receiver.Resolve(received))
+		require.Equal(t, expectedTopic, received.Topic())
+	}
+}
+
+func TestTopicAliasesLRU(t *testing.T) {
+	a := NewTopicAliases(0, 2)
+
+	p := newAliasPublish(t, "a")
+	require.NoError(t, a.Assign(p))
+	requireAlias(t, p, 1)
+	require.Equal(t, "a", p.Topic())
+
+	p = newAliasPublish(t, "b")
+	require.NoError(t, a.Assign(p))
+	requireAlias(t, p, 2)
+
+	// touch "a" thus "b" becomes least recently used
+	p = newAliasPublish(t, "a")
+	require.NoError(t, a.Assign(p))
+	requireAlias(t, p, 1)
+	require.Empty(t, p.Topic())
+
+	p = newAliasPublish(t, "c")
+	require.NoError(t, a.Assign(p))
+	requireAlias(t, p, 2)
+	require.Equal(t, "c", p.Topic())
+
+	// shrinking maximum drops alias 2
+	a.SetOutboundMaximum(1)
+
+	p = newAliasPublish(t, "c")
+	require.NoError(t, a.Assign(p))
+	requireAlias(t, p, 1)
+	require.Equal(t, "c", p.Topic())
+
+	// aliases disabled by peer
+	a.SetOutboundMaximum(0)
+
+	p = newAliasPublish(t, "c")
+	require.NoError(t, p.PropertySet(PropertyTopicAlias, uint16(5)))
+	require.NoError(t, a.Assign(p))
+	require.Nil(t, p.PropertyGet(PropertyTopicAlias))
+	require.Equal(t, "c", p.Topic())
+
+	size, err := p.Size()
+	require.NoError(t, err)
+	require.Equal(t, 2+3+1+4, size)
+}
+
+func TestTopicAliasesResolveInvalid(t *testing.T) {
+	a := NewTopicAliases(2, 0)
+
+	p := newAliasPublish(t, "a")
+	require.NoError(t, p.PropertySet(PropertyTopicAlias, uint16(0)))
+	require.Equal(t, CodeInvalidTopicAlias, a.Resolve(p))
+
+	p = newAliasPublish(t, "a")
+	require.NoError(t, p.PropertySet(PropertyTopicAlias, uint16(3)))
+	require.Equal(t, CodeInvalidTopicAlias, a.Resolve(p))
+
+	// no mapping for alias
+	p = newAliasPublish(t, "")
+	require.NoError(t, p.PropertySet(PropertyTopicAlias, uint16(1)))
+	require.Equal(t, CodeInvalidTopicAlias, a.Resolve(p))
+
+	// neither topic nor alias
+	p = newAliasPublish(t, "")
+	require.Equal(t, CodeProtocolError, a.Resolve(p))
+
+	// mappings do not survive reconnect
+	p = newAliasPublish(t, "a")
+	require.NoError(t, p.PropertySet(PropertyTopicAlias, uint16(1)))
+	require.NoError(t, a.Resolve(p))
+
+	a.Reset()
+
+	p = newAliasPublish(t, "")
+	require.NoError(t, p.PropertySet(PropertyTopicAlias, uint16(1)))
+	require.Equal(t, CodeInvalidTopicAlias, a.Resolve(p))
+
+	// V3 packets are left as is
+	p = NewPublish(ProtocolV311)
+	require.NoError(t, a.Resolve(p))
+	require.NoError(t, a.Assign(p))
+}
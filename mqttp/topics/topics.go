@@ -0,0 +1,244 @@
+// Package topics implements matching of publish topics against subscription topic filters
+// as per [MQTT-4.7].
+//
+// Filters are kept in a trie, one node per topic level, thus single Match walks only
+// branches the topic can possibly match instead of testing every filter.
+// Each filter holds any number of values distinguished by key, e.g. subscriber as key
+// and vlsubscriber.SubscriptionParams as value.
+package topics
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/VolantMQ/vlapi/mqttp"
+)
+
+const (
+	levelSep      = "/"
+	singleLevel   = "+"
+	multiLevel    = "#"
+	dollarPrefix  = '$'
+	wildcardChars = singleLevel + multiLevel
+)
+
+// Match filter matched by topic along with key and value stored under it
+type Match struct {
+	Filter string
+	Key    interface{}
+	Value  interface{}
+}
+
+// Trie of topic filters
+// It is safe for concurrent use, any number of Match calls run in parallel
+type Trie struct {
+	lock  sync.RWMutex
+	root  *node
+	count int
+}
+
+type node struct {
+	filter   string
+	children map[string]*node
+	values   map[interface{}]interface{}
+}
+
+// New allocate empty trie
+func New() *Trie {
+	return &Trie{
+		root: newNode(""),
+	}
+}
+
+func newNode(filter string) *node {
+	return &node{
+		filter:   filter,
+		children: make(map[string]*node),
+		values:   make(map[interface{}]interface{}),
+	}
+}
+
+// Len number of values stored
+func (t *Trie) Len() int {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+
+	return t.count
+}
+
+// Insert value under filter with key, value previously stored with same key is replaced
+// Shared subscriptions must be inserted with Topic.Filter(), i.e. without $share/<name>/ prefix.
+// Returns mqttp.ErrInvalidTopic if filter is not valid
+func (t *Trie) Insert(filter string, key interface{}, value interface{}) error {
+	if !validFilter(filter) {
+		return mqttp.ErrInvalidTopic
+	}
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	n := t.root
+	levels := strings.Split(filter, levelSep)
+
+	for i, level := range levels {
+		child, ok := n.children[level]
+		if !ok {
+			child = newNode(strings.Join(levels[:i+1], levelSep))
+			n.children[level] = child
+		}
+
+		n = child
+	}
+
+	if _, ok := n.values[key]; !ok {
+		t.count++
+	}
+
+	n.values[key] = value
+
+	return nil
+}
+
+// Get value stored under filter with key
+func (t *Trie) Get(filter string, key interface{}) (interface{}, bool) {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+
+	n := t.find(filter)
+	if n == nil {
+		return nil, false
+	}
+
+	v, ok := n.values[key]
+
+	return v, ok
+}
+
+// Remove value stored under filter with key
+// returns false if there is no such value
+func (t *Trie) Remove(filter string, key interface{}) bool {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	levels := strings.Split(filter, levelSep)
+	path := make([]*node, 0, len(levels)+1)
+	path = append(path, t.root)
+
+	n := t.root
+	for _, level := range levels {
+		if n = n.children[level]; n == nil {
+			return false
+		}
+
+		path = append(path, n)
+	}
+
+	if _, ok := n.values[key]; !ok {
+		return false
+	}
+
+	delete(n.values, key)
+	t.count--
+
+	// prune branch left without values
+	for i := len(path) - 1; i > 0; i-- {
+		if len(path[i].values) != 0 || len(path[i].children) != 0 {
+			break
+		}
+
+		delete(path[i-1].children, levels[i-1])
+	}
+
+	return true
+}
+
+// Match publish topic against stored filters and return all values of matching ones
+// Filters starting with wildcard do not match topics starting with $ [MQTT-4.7.2-1].
+// Topic containing wildcard characters matches nothing
+func (t *Trie) Match(topic string) []Match {
+	var res []Match
+
+	t.MatchFunc(topic, func(m Match) bool {
+		res = append(res, m)
+		return true
+	})
+
+	return res
+}
+
+// MatchFunc same as Match but calls fn for each match instead of collecting them
+// Iteration stops once fn returns false. fn must not modify the trie
+func (t *Trie) MatchFunc(topic string, fn func(Match) bool) {
+	if len(topic) == 0 || strings.ContainsAny(topic, wildcardChars) {
+		return
+	}
+
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+
+	t.root.match(strings.Split(topic, levelSep), 0, topic[0] == dollarPrefix, fn)
+}
+
+// find node of filter, must be called with lock held
+func (t *Trie) find(filter string) *node {
+	n := t.root
+
+	for _, level := range strings.Split(filter, levelSep) {
+		if n = n.children[level]; n == nil {
+			return nil
+		}
+	}
+
+	return n
+}
+
+// match returns false once fn requested to stop
+func (n *node) match(levels []string, i int, dollar bool, fn func(Match) bool) bool {
+	// wildcards at first level do not match topic with $ prefix
+	wildcards := i > 0 || !dollar
+
+	if i == len(levels) {
+		if !n.emit(fn) {
+			return false
+		}
+
+		// "sport/#" matches "sport" as well [MQTT-4.7.1-2]
+		if child, ok := n.children[multiLevel]; ok && wildcards {
+			return child.emit(fn)
+		}
+
+		return true
+	}
+
+	if wildcards {
+		if child, ok := n.children[multiLevel]; ok && !child.emit(fn) {
+			return false
+		}
+
+		if child, ok := n.children[singleLevel]; ok && !child.match(levels, i+1, dollar, fn) {
+			return false
+		}
+	}
+
+	if child, ok := n.children[levels[i]]; ok {
+		return child.match(levels, i+1, dollar, fn)
+	}
+
+	return true
+}
+
+func (n *node) emit(fn func(Match) bool) bool {
+	for k, v := range n.values {
+		if !fn(Match{Filter: n.filter, Key: k, Value: v}) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func validFilter(filter string) bool {
+	b := []byte(filter)
+
+	return len(b) > 0 && mqttp.IsValidUTF(b) && mqttp.TopicFilterRegexp.Match(b)
+}
@@ -0,0 +1,139 @@
+package topics
+
+import (
+	"sort"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/VolantMQ/vlapi/mqttp"
+)
+
+func matchedFilters(t *Trie, topic string) []string {
+	var res []string
+
+	for _, m := range t.Match(topic) {
+		res = append(res, m.Filter)
+	}
+
+	sort.Strings(res)
+
+	return res
+}
+
+func TestTrieMatch(t *testing.T) {
+	tr := New()
+
+	filters := []string{
+		"#",
+		"+",
+		"+/+",
+		"/+",
+		"sport/#",
+		"sport/tennis/+",
+		"sport/tennis/player1",
+		"sport/+/player1",
+		"+/tennis/#",
+		"$SYS/#",
+		"$SYS/+/clients",
+		"a//b",
+	}
+
+	for _, f := range filters {
+		require.NoError(t, tr.Insert(f, "k", f))
+	}
+
+	require.Equal(t, len(filters), tr.Len())
+
+	tests := map[string][]string{
+		"sport":                      {"#", "+", "sport/#"},
+		"sport/":                     {"#", "+/+", "sport/#"},
+		"/finance":                   {"#", "+/+", "/+"},
+		"sport/tennis/player1":       {"#", "+/tennis/#", "sport/#", "sport/+/player1", "sport/tennis/+", "sport/tennis/player1"},
+		"sport/tennis/player2":       {"#", "+/tennis/#", "sport/#", "sport/tennis/+"},
+		"sport/tennis/player1/score": {"#", "+/tennis/#", "sport/#"},
+		"a//b":                       {"#", "a//b"},
+		"$SYS/broker/clients":        {"$SYS/#", "$SYS/+/clients"},
+		"$SYS":                       {"$SYS/#"},
+		"$other":                     nil,
+		"sport/+":                    nil,
+		"":                           nil,
+	}
+
+	for topic, expected := range tests {
+		require.Equal(t, expected, matchedFilters(tr, topic), topic)
+	}
+}
+
+func TestTrieValues(t *testing.T) {
+	tr := New()
+
+	require.Equal(t, mqttp.ErrInvalidTopic, tr.Insert("", 1, nil))
+	require.Equal(t, mqttp.ErrInvalidTopic, tr.Insert("a/#/b", 1, nil))
+	require.Equal(t, mqttp.ErrInvalidTopic, tr.Insert("a+", 1, nil))
+
+	require.NoError(t, tr.Insert("a/+", 1, "one"))
+	require.NoError(t, tr.Insert("a/+", 2, "two"))
+	require.NoError(t, tr.Insert("a/+", 1, "uno"))
+	require.Equal(t, 2, tr.Len())
+
+	v, ok := tr.Get("a/+", 1)
+	require.True(t, ok)
+	require.Equal(t, "uno", v)
+
+	_, ok = tr.Get("a", 1)
+	require.False(t, ok)
+
+	matches := tr.Match("a/b")
+	require.Len(t, matches, 2)
+
+	// iteration can be stopped early
+	calls := 0
+	tr.MatchFunc("a/b", func(Match) bool {
+		calls++
+		return false
+	})
+	require.Equal(t, 1, calls)
+
+	require.True(t, tr.Remove("a/+", 1))
+	require.False(t, tr.Remove("a/+", 1))
+	require.False(t, tr.Remove("a/b/c", 2))
+	require.Equal(t, []Match{{Filter: "a/+", Key: 2, Value: "two"}}, tr.Match("a/b"))
+
+	require.True(t, tr.Remove("a/+", 2))
+	require.Equal(t, 0, tr.Len())
+	require.Empty(t, tr.root.children)
+}
+
+func TestTrieConcurrent(t *testing.T) {
+	tr := New()
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+
+		go func(i int) {
+			defer wg.Done()
+
+			for j := 0; j < 100; j++ {
+				filter := "a/" + strconv.Itoa(j) + "/#"
+				require.NoError(t, tr.Insert(filter, i, j))
+				tr.Remove(filter, i)
+			}
+		}(i)
+
+		go func() {
+			defer wg.Done()
+
+			for j := 0; j < 100; j++ {
+				tr.Match("a/" + strconv.Itoa(j) + "/b")
+			}
+		}()
+	}
+
+	wg.Wait()
+	require.Equal(t, 0, tr.Len())
+}
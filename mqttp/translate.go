@@ -0,0 +1,305 @@
+package mqttp
+
+import (
+	"sort"
+	"time"
+)
+
+// Loss describes information of the source packet which could not be carried over
+// by Translate into target protocol version
+type Loss struct {
+	// Properties dropped as MQTT 3.1.1 has no properties, or connection scoped Topic Alias
+	Properties []PropertyID
+	// WillProperties dropped from will message of CONNECT
+	WillProperties []PropertyID
+	// ReasonCodes replaced with the closest ones of the target version or dropped
+	ReasonCodes bool
+	// SubscriptionOptions No Local, Retain As Published and Retain Handling dropped
+	SubscriptionOptions bool
+	// Password dropped as MQTT 3.1.1 does not allow password without user name
+	Password bool
+	// Session semantic of CONNECT changed as MQTT 3.1.1 session either ends with connection
+	// and discards previous one or never expires
+	Session bool
+}
+
+// Lossy check if any information has been lost
+func (l *Loss) Lossy() bool {
+	return len(l.Properties) > 0 || len(l.WillProperties) > 0 || l.ReasonCodes || l.SubscriptionOptions || l.Password || l.Session
+}
+
+// v5 CONNACK reason codes with exact V3.1.1 return code
+var connAckV5toV3 = map[ReasonCode]ReasonCode{
+	CodeSuccess:             CodeSuccess,
+	CodeUnsupportedProtocol: CodeRefusedUnacceptableProtocolVersion,
+	CodeInvalidClientID:     CodeRefusedIdentifierRejected,
+	CodeServerUnavailable:   CodeRefusedServerUnavailable,
+	CodeBadUserOrPassword:   CodeRefusedBadUsernameOrPassword,
+	CodeNotAuthorized:       CodeRefusedNotAuthorized,
+}
+
+// v5 CONNACK reason codes refusing client itself rather than connection
+// any other failure reported to V3.1.1 client as server unavailable
+var connAckV5toV3Closest = map[ReasonCode]ReasonCode{
+	CodeBanned:        CodeRefusedNotAuthorized,
+	CodeBadAuthMethod: CodeRefusedNotAuthorized,
+}
+
+// Translate packet into given protocol version
+// Source packet is not modified, returned one shares payload and property values with it.
+// MQTT 5.0 reason codes mapped to the closest V3.1.1 ones, SUBACK failures become 0x80,
+// properties dropped. Loss reports what has not been carried over.
+//
+// Translation from V3.1.1 synthesizes properties required to keep semantic:
+//   - Session Expiry Interval 0xFFFFFFFF for CONNECT without clean session
+//   - Publication Expiry Interval for PUBLISH with expiration set
+//
+// Translation of CONNECT into V3.1.1 sets clean session if either Clean Start is set
+// or Session Expiry Interval is 0 or absent.
+//
+// Topic Alias is connection scoped and never carried over, thus PUBLISH topic
+// must be resolved before translation.
+//
+// V3.1.1 UNSUBACK has no return codes, thus translated one has none either and
+// caller must add one per topic filter of the UNSUBSCRIBE it acknowledges.
+//
+// AUTH cannot be translated into V3.1.1 and ErrInvalidMessageType returned
+func Translate(pkt IFace, to ProtocolVersion) (IFace, *Loss, error) {
+	if pkt == nil {
+		return nil, nil, ErrInvalidArgs
+	}
+
+	if !to.IsValid() {
+		return nil, nil, ErrInvalidProtocolVersion
+	}
+
+	if !pkt.Version().IsValid() {
+		return nil, nil, ErrInvalidProtocolVersion
+	}
+
+	res, err := New(to, pkt.Type())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	loss := &Loss{}
+
+	src := pkt.getHeader()
+	dst := res.getHeader()
+
+	if len(src.packetID) > 0 {
+		dst.allocPacketID()
+		copy(dst.packetID, src.packetID)
+	}
+
+	switch m := pkt.(type) {
+	case *Connect:
+		err = translateConnect(m, res.(*Connect), loss)
+	case *ConnAck:
+		translateConnAck(m, res.(*ConnAck), loss)
+	case *Publish:
+		err = translatePublish(m, res.(*Publish))
+	case *Ack:
+		r := res.(*Ack)
+		r.reasonCode = m.reasonCode
+		if to < ProtocolV50 {
+			r.reasonCode = CodeSuccess
+			loss.ReasonCodes = m.reasonCode != CodeSuccess
+		}
+	case *Subscribe:
+		err = translateSubscribe(m, res.(*Subscribe), loss)
+	case *SubAck:
+		translateSubAck(m, res.(*SubAck), loss)
+	case *UnSubscribe:
+		res.(*UnSubscribe).topics = append(res.(*UnSubscribe).topics, m.topics...)
+	case *UnSubAck:
+		r := res.(*UnSubAck)
+		if to == ProtocolV50 && m.version == ProtocolV50 {
+			r.returnCodes = append(r.returnCodes, m.returnCodes...)
+		} else if to < ProtocolV50 {
+			for _, c := range m.returnCodes {
+				loss.ReasonCodes = loss.ReasonCodes || c != CodeSuccess
+			}
+		}
+	case *Disconnect:
+		r := res.(*Disconnect)
+		r.reasonCode = m.reasonCode
+		if to < ProtocolV50 {
+			r.reasonCode = CodeSuccess
+			loss.ReasonCodes = m.reasonCode != CodeSuccess
+		}
+	case *Auth:
+		res.(*Auth).authReason = m.authReason
+	}
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err = translateProperties(src, dst, loss); err != nil {
+		return nil, nil, err
+	}
+
+	return res, loss, nil
+}
+
+// translateProperties copy properties between V5.0 packets or report them dropped
+func translateProperties(src, dst *header, loss *Loss) error {
+	if src.version != ProtocolV50 {
+		return nil
+	}
+
+	for id, val := range src.properties.properties {
+		if dst.version == ProtocolV50 && id != PropertyTopicAlias {
+			if err := dst.properties.Set(dst.mType, id, val); err != nil {
+				return err
+			}
+		} else {
+			loss.Properties = append(loss.Properties, id)
+		}
+	}
+
+	sort.Slice(loss.Properties, func(i, j int) bool {
+		return loss.Properties[i] < loss.Properties[j]
+	})
+
+	return nil
+}
+
+func translateConnect(src, dst *Connect, loss *Loss) error {
+	dst.connectFlags = src.connectFlags
+	dst.keepAlive = src.keepAlive
+	dst.clientID = src.clientID
+	dst.username = src.username
+	dst.password = src.password
+
+	// V3.1.1 [MQTT-3.1.2-22]
+	if dst.version < ProtocolV50 && !dst.usernameFlag() && dst.passwordFlag() {
+		dst.connectFlags &= ^maskConnFlagPassword
+		dst.password = nil
+		loss.Password = true
+	}
+
+	// V3.1.1 session without clean flag lasts until it is explicitly cleaned while
+	// V5.0 one ends with connection unless Session Expiry Interval set
+	if src.version < ProtocolV50 && dst.version == ProtocolV50 && !src.IsClean() {
+		if err := dst.properties.Set(CONNECT, PropertySessionExpiryInterval, uint32(0xFFFFFFFF)); err != nil {
+			return err
+		}
+	}
+
+	// V5.0 session without Session Expiry Interval ends with connection [MQTT-3.1.2-23]
+	if src.version == ProtocolV50 && dst.version < ProtocolV50 {
+		expiry := uint32(0)
+		if prop := src.properties.Get(PropertySessionExpiryInterval); prop != nil {
+			if v, err := prop.AsInt(); err == nil {
+				expiry = v
+			}
+		}
+
+		clean := src.IsClean() || expiry == 0
+		dst.SetClean(clean)
+
+		// only session started clean and ending with connection or never expiring one
+		// match V3.1.1 semantic
+		if clean {
+			loss.Session = !src.IsClean() || expiry != 0
+		} else {
+			loss.Session = expiry != 0xFFFFFFFF
+		}
+	}
+
+	if src.will != nil {
+		will, willLoss, err := Translate(src.will, dst.version)
+		if err != nil {
+			return err
+		}
+
+		dst.will = will.(*Publish)
+		loss.WillProperties = willLoss.Properties
+	}
+
+	return nil
+}
+
+func translateConnAck(src, dst *ConnAck, loss *Loss) {
+	dst.sessionPresent = src.sessionPresent
+	dst.returnCode = src.returnCode
+
+	switch {
+	case src.version < ProtocolV50 && dst.version == ProtocolV50:
+		for v5, v3 := range connAckV5toV3 {
+			if v3 == src.returnCode {
+				dst.returnCode = v5
+			}
+		}
+	case src.version == ProtocolV50 && dst.version < ProtocolV50:
+		if c, ok := connAckV5toV3[src.returnCode]; ok {
+			dst.returnCode = c
+		} else if c, ok = connAckV5toV3Closest[src.returnCode]; ok {
+			dst.returnCode = c
+			loss.ReasonCodes = true
+		} else {
+			dst.returnCode = CodeRefusedServerUnavailable
+			loss.ReasonCodes = true
+		}
+	}
+}
+
+func translatePublish(src, dst *Publish) error {
+	// V5.0 topic might be replaced by topic alias, it must be resolved first
+	if src.version == ProtocolV50 && len(src.topic) == 0 {
+		return ErrInvalidTopic
+	}
+
+	dst.mFlags = src.mFlags
+	dst.topic = src.topic
+	dst.payload = src.payload
+	dst.publishID = src.publishID
+	dst.expireAt = src.expireAt
+
+	if src.version < ProtocolV50 && dst.version == ProtocolV50 && !src.expireAt.IsZero() {
+		expire := uint32(0)
+		if left := time.Until(src.expireAt); left > 0 {
+			expire = uint32(left / time.Second)
+		}
+
+		if err := dst.properties.Set(PUBLISH, PropertyPublicationExpiry, expire); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func translateSubscribe(src, dst *Subscribe, loss *Loss) error {
+	for _, t := range src.topics {
+		ops := t.ops
+
+		if dst.version < ProtocolV50 {
+			ops = SubscriptionOptions(t.ops.QoS())
+			loss.SubscriptionOptions = loss.SubscriptionOptions || ops != t.ops
+		}
+
+		topic, err := NewSubscribeTopic(t.full, ops)
+		if err != nil {
+			return err
+		}
+
+		dst.topics = append(dst.topics, topic)
+	}
+
+	return nil
+}
+
+func translateSubAck(src, dst *SubAck, loss *Loss) {
+	for _, c := range src.returnCodes {
+		// V3.1.1 [MQTT-3.9.3] allows only granted QoS or failure
+		if dst.version < ProtocolV50 && c >= CodeUnspecifiedError {
+			loss.ReasonCodes = loss.ReasonCodes || c != CodeUnspecifiedError
+			c = CodeUnspecifiedError
+		}
+
+		dst.returnCodes = append(dst.returnCodes, c)
+	}
+}
@@ -0,0 +1,297 @@
+package mqttp
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// encodeDecode checks translated packet is valid on the wire of its version
+func encodeDecode(t *testing.T, pkt IFace) IFace {
+	buf, err := Encode(pkt)
+	require.NoError(t, err)
+
+	res, _, err := Decode(pkt.Version(), buf)
+	require.NoError(t, err)
+
+	return res
+}
+
+func TestTranslatePublish(t *testing.T) {
+	pkt := NewPublish(ProtocolV50)
+	require.NoError(t, pkt.Set("a/b", []byte("data"), QoS1, true, true))
+	pkt.SetPacketID(10)
+	require.NoError(t, pkt.PropertySet(PropertyContentType, "text/plain"))
+	require.NoError(t, pkt.PropertySet(PropertyPayloadFormat, uint8(1)))
+
+	res, loss, err := Translate(pkt, ProtocolV311)
+	require.NoError(t, err)
+	require.True(t, loss.Lossy())
+	require.Equal(t, []PropertyID{PropertyPayloadFormat, PropertyContentType}, loss.Properties)
+
+	msg := encodeDecode(t, res).(*Publish)
+	require.Equal(t, ProtocolV311, msg.Version())
+	require.Equal(t, "a/b", msg.Topic())
+	require.Equal(t, []byte("data"), msg.Payload())
+	require.Equal(t, QoS1, msg.QoS())
+	require.True(t, msg.Retain())
+	require.True(t, msg.Dup())
+
+	id, err := msg.ID()
+	require.NoError(t, err)
+	require.Equal(t, IDType(10), id)
+
+	// source is untouched
+	require.Equal(t, ProtocolV50, pkt.Version())
+	require.NotNil(t, pkt.PropertyGet(PropertyContentType))
+
+	// v5 to v5 keeps properties
+	res, loss, err = Translate(pkt, ProtocolV50)
+	require.NoError(t, err)
+	require.False(t, loss.Lossy())
+
+	contentType, err := encodeDecode(t, res).PropertyGet(PropertyContentType).AsString()
+	require.NoError(t, err)
+	require.Equal(t, "text/plain", contentType)
+
+	// expiration synthesized as property
+	pkt = NewPublish(ProtocolV311)
+	require.NoError(t, pkt.Set("a/b", []byte("data"), QoS0, false, false))
+	pkt.SetExpireAt(time.Now().Add(time.Minute + time.Second/2))
+
+	res, loss, err = Translate(pkt, ProtocolV50)
+	require.NoError(t, err)
+	require.False(t, loss.Lossy())
+
+	expire, err := encodeDecode(t, res).PropertyGet(PropertyPublicationExpiry).AsInt()
+	require.NoError(t, err)
+	require.Equal(t, uint32(60), expire)
+
+	// topic alias must be resolved before translation
+	pkt = NewPublish(ProtocolV50)
+	require.NoError(t, pkt.PropertySet(PropertyTopicAlias, uint16(1)))
+
+	_, _, err = Translate(pkt, ProtocolV311)
+	require.Equal(t, ErrInvalidTopic, err)
+
+	_, _, err = Translate(pkt, ProtocolV50)
+	require.Equal(t, ErrInvalidTopic, err)
+
+	// topic alias is connection scoped
+	require.NoError(t, pkt.Set("a/b", []byte("data"), QoS0, false, false))
+
+	res, loss, err = Translate(pkt, ProtocolV50)
+	require.NoError(t, err)
+	require.Equal(t, []PropertyID{PropertyTopicAlias}, loss.Properties)
+	require.Nil(t, res.PropertyGet(PropertyTopicAlias))
+	require.Equal(t, "a/b", encodeDecode(t, res).(*Publish).Topic())
+}
+
+func TestTranslateConnect(t *testing.T) {
+	will := NewPublish(ProtocolV50)
+	require.NoError(t, will.Set("will", []byte("bye"), QoS1, true, false))
+	require.NoError(t, will.PropertySet(PropertyWillDelayInterval, uint32(10)))
+
+	pkt := NewConnect(ProtocolV50)
+	require.NoError(t, pkt.SetClientID([]byte("client")))
+	require.NoError(t, pkt.SetCredentials(nil, []byte("token")))
+	require.NoError(t, pkt.SetWill(will))
+	require.NoError(t, pkt.PropertySet(PropertySessionExpiryInterval, uint32(30)))
+	pkt.SetKeepAlive(15)
+	pkt.SetClean(true)
+
+	res, loss, err := Translate(pkt, ProtocolV311)
+	require.NoError(t, err)
+	require.True(t, loss.Password)
+	require.True(t, loss.Session)
+	require.Equal(t, []PropertyID{PropertySessionExpiryInterval}, loss.Properties)
+	require.Equal(t, []PropertyID{PropertyWillDelayInterval}, loss.WillProperties)
+
+	msg := encodeDecode(t, res).(*Connect)
+	require.Equal(t, []byte("client"), msg.ClientID())
+	require.Equal(t, uint16(15), msg.KeepAlive())
+	require.True(t, msg.IsClean())
+
+	user, pass := msg.Credentials()
+	require.Empty(t, user)
+	require.Empty(t, pass)
+
+	require.NotNil(t, msg.Will())
+	require.Equal(t, "will", msg.Will().Topic())
+	require.Equal(t, QoS1, msg.Will().QoS())
+	require.True(t, msg.Will().Retain())
+
+	// persistent v3 session synthesizes session expiry
+	msg.SetClean(false)
+
+	res, loss, err = Translate(msg, ProtocolV50)
+	require.NoError(t, err)
+	require.False(t, loss.Lossy())
+
+	expire, err := encodeDecode(t, res).PropertyGet(PropertySessionExpiryInterval).AsInt()
+	require.NoError(t, err)
+	require.Equal(t, uint32(0xFFFFFFFF), expire)
+}
+
+func TestTranslateConnectSession(t *testing.T) {
+	interval := func(v uint32) *uint32 { return &v }
+
+	tests := []struct {
+		cleanStart bool
+		expiry     *uint32
+		clean      bool
+		lossy      bool
+	}{
+		{cleanStart: true, clean: true},
+		{cleanStart: true, expiry: interval(0), clean: true},
+		{cleanStart: false, clean: true, lossy: true},
+		{cleanStart: false, expiry: interval(0), clean: true, lossy: true},
+		{cleanStart: true, expiry: interval(30), clean: true, lossy: true},
+		{cleanStart: false, expiry: interval(30), clean: false, lossy: true},
+		{cleanStart: false, expiry: interval(0xFFFFFFFF), clean: false},
+	}
+
+	for i, tc := range tests {
+		pkt := NewConnect(ProtocolV50)
+		require.NoError(t, pkt.SetClientID([]byte("client")))
+		pkt.SetClean(tc.cleanStart)
+
+		if tc.expiry != nil {
+			require.NoError(t, pkt.PropertySet(PropertySessionExpiryInterval, *tc.expiry))
+		}
+
+		res, loss, err := Translate(pkt, ProtocolV311)
+		require.NoError(t, err)
+		require.Equal(t, tc.clean, encodeDecode(t, res).(*Connect).IsClean(), i)
+		require.Equal(t, tc.lossy, loss.Session, i)
+	}
+}
+
+func TestTranslateConnAck(t *testing.T) {
+	for _, tc := range []struct {
+		v5    ReasonCode
+		v3    ReasonCode
+		lossy bool
+	}{
+		{CodeSuccess, CodeSuccess, false},
+		{CodeUnsupportedProtocol, CodeRefusedUnacceptableProtocolVersion, false},
+		{CodeInvalidClientID, CodeRefusedIdentifierRejected, false},
+		{CodeServerUnavailable, CodeRefusedServerUnavailable, false},
+		{CodeBadUserOrPassword, CodeRefusedBadUsernameOrPassword, false},
+		{CodeNotAuthorized, CodeRefusedNotAuthorized, false},
+		{CodeBanned, CodeRefusedNotAuthorized, true},
+		{CodeServerBusy, CodeRefusedServerUnavailable, true},
+		{CodeMalformedPacket, CodeRefusedServerUnavailable, true},
+	} {
+		pkt := NewConnAck(ProtocolV50)
+		pkt.SetSessionPresent(true)
+		require.NoError(t, pkt.SetReturnCode(tc.v5))
+
+		res, loss, err := Translate(pkt, ProtocolV311)
+		require.NoError(t, err)
+		require.Equal(t, tc.lossy, loss.Lossy(), tc.v5.Name())
+
+		msg := encodeDecode(t, res).(*ConnAck)
+		require.Equal(t, tc.v3, msg.ReturnCode(), tc.v5.Name())
+		require.True(t, msg.SessionPresent())
+
+		if tc.lossy {
+			continue
+		}
+
+		res, loss, err = Translate(msg, ProtocolV50)
+		require.NoError(t, err)
+		require.False(t, loss.Lossy())
+		require.Equal(t, tc.v5, encodeDecode(t, res).(*ConnAck).ReturnCode())
+	}
+}
+
+func TestTranslateSubscribe(t *testing.T) {
+	pkt := NewSubscribe(ProtocolV50)
+	pkt.SetPacketID(7)
+
+	topic, err := NewSubscribeTopic([]byte("a/#"), SubscriptionOptions(0x01|maskSubscriptionNL|maskSubscriptionRAP))
+	require.NoError(t, err)
+	require.NoError(t, pkt.AddTopic(topic))
+
+	topic, err = NewSubscribeTopic([]byte("b/+"), SubscriptionOptions(0x02))
+	require.NoError(t, err)
+	require.NoError(t, pkt.AddTopic(topic))
+
+	res, loss, err := Translate(pkt, ProtocolV311)
+	require.NoError(t, err)
+	require.True(t, loss.SubscriptionOptions)
+
+	var topics []string
+	var ops []SubscriptionOptions
+
+	require.NoError(t, encodeDecode(t, res).(*Subscribe).ForEachTopic(func(t *Topic) error {
+		topics = append(topics, t.Full())
+		ops = append(ops, t.Ops())
+		return nil
+	}))
+
+	require.Equal(t, []string{"a/#", "b/+"}, topics)
+	require.Equal(t, []SubscriptionOptions{0x01, 0x02}, ops)
+
+	ack := NewSubAck(ProtocolV50)
+	ack.SetPacketID(7)
+	require.NoError(t, ack.AddReturnCodes([]ReasonCode{CodeSuccess, CodeNotAuthorized, CodeUnspecifiedError, 2}))
+
+	res, loss, err = Translate(ack, ProtocolV311)
+	require.NoError(t, err)
+	require.True(t, loss.ReasonCodes)
+	require.Equal(t, []ReasonCode{0, CodeUnspecifiedError, CodeUnspecifiedError, 2}, encodeDecode(t, res).(*SubAck).ReturnCodes())
+
+	res, loss, err = Translate(res, ProtocolV50)
+	require.NoError(t, err)
+	require.False(t, loss.Lossy())
+	require.Equal(t, []ReasonCode{0, CodeUnspecifiedError, CodeUnspecifiedError, 2}, encodeDecode(t, res).(*SubAck).ReturnCodes())
+}
+
+func TestTranslateAcks(t *testing.T) {
+	ack := NewPubRec(ProtocolV50)
+	ack.SetPacketID(3)
+	ack.SetReason(CodeQuotaExceeded)
+
+	res, loss, err := Translate(ack, ProtocolV311)
+	require.NoError(t, err)
+	require.True(t, loss.ReasonCodes)
+
+	msg := encodeDecode(t, res).(*Ack)
+	require.Equal(t, PUBREC, msg.Type())
+	require.Equal(t, CodeSuccess, msg.Reason())
+
+	id, err := msg.ID()
+	require.NoError(t, err)
+	require.Equal(t, IDType(3), id)
+
+	unsuback := NewUnSubAck(ProtocolV50)
+	unsuback.SetPacketID(4)
+	unsuback.returnCodes = []ReasonCode{CodeSuccess, CodeNoSubscriptionExisted}
+
+	res, loss, err = Translate(unsuback, ProtocolV311)
+	require.NoError(t, err)
+	require.True(t, loss.ReasonCodes)
+	require.Empty(t, encodeDecode(t, res).(*UnSubAck).ReturnCodes())
+
+	disconnect := NewDisconnect(ProtocolV50)
+	disconnect.SetReasonCode(CodeServerShuttingDown)
+
+	res, loss, err = Translate(disconnect, ProtocolV311)
+	require.NoError(t, err)
+	require.True(t, loss.ReasonCodes)
+	require.Equal(t, DISCONNECT, encodeDecode(t, res).Type())
+
+	res, loss, err = Translate(NewPingReq(ProtocolV311), ProtocolV50)
+	require.NoError(t, err)
+	require.False(t, loss.Lossy())
+	require.Equal(t, PINGREQ, encodeDecode(t, res).Type())
+
+	_, _, err = Translate(NewAuth(ProtocolV50), ProtocolV311)
+	require.Equal(t, ErrInvalidMessageType, err)
+
+	_, _, err = Translate(NewPingReq(ProtocolV311), ProtocolVersion(7))
+	require.Equal(t, ErrInvalidProtocolVersion, err)
+}
@@ -10,6 +10,8 @@ import (
 type ProtocolVersion byte
 
 const (
+	// ProtocolAuto requests decoder to detect version from CONNECT packet
+	ProtocolAuto = ProtocolVersion(0x0)
 	// ProtocolV31 describes spec MQIsdp
 	ProtocolV31 = ProtocolVersion(0x3)
 	// ProtocolV311 describes spec v3.1.1
@@ -150,3 +152,28 @@ func (t *Topic) ShareName() string {
 func IsValidUTF(b []byte) bool {
 	return utf8.Valid(b) && BasicUTFRegexp.Match(b)
 }
+
+// TopicMatch reports whether topic name matches topic filter [MQTT-4.7]
+// Both are expected to be valid. Filter starting with wildcard does not match
+// topics starting with $ [MQTT-4.7.2-1]
+func TopicMatch(filter, topic string) bool {
+	if len(filter) > 0 && (filter[0] == '+' || filter[0] == '#') && len(topic) > 0 && topic[0] == '$' {
+		return false
+	}
+
+	levels := bytes.Split([]byte(topic), topicSep)
+	filters := bytes.Split([]byte(filter), topicSep)
+
+	for i, f := range filters {
+		// "sport/#" matches "sport" as well [MQTT-4.7.1-2]
+		if string(f) == "#" {
+			return true
+		}
+
+		if i >= len(levels) || (string(f) != "+" && !bytes.Equal(f, levels[i])) {
+			return false
+		}
+	}
+
+	return len(levels) == len(filters)
+}
@@ -87,3 +87,30 @@ func TestTopicNewValid1(t *testing.T) {
 	require.Equal(t, "", topic.DollarPrefix())
 	require.Equal(t, "", topic.ShareName())
 }
+
+func TestTopicMatch(t *testing.T) {
+	tests := []struct {
+		filter string
+		topic  string
+		match  bool
+	}{
+		{"#", "sport/tennis", true},
+		{"#", "$SYS/uptime", false},
+		{"+/uptime", "$SYS/uptime", false},
+		{"$SYS/#", "$SYS/uptime", true},
+		{"sport/#", "sport", true},
+		{"sport/#", "sport/tennis/player1", true},
+		{"sport/+", "sport", false},
+		{"sport/+", "sport/", true},
+		{"sport/+", "sport/tennis/player1", false},
+		{"+/+", "/a", true},
+		{"+", "/a", false},
+		{"sport/tennis", "sport/tennis", true},
+		{"sport/tennis", "sport/Tennis", false},
+		{"sport/tennis", "sport/tennis/player1", false},
+	}
+
+	for _, tt := range tests {
+		require.Equal(t, tt.match, TopicMatch(tt.filter, tt.topic), "%s %s", tt.filter, tt.topic)
+	}
+}
@@ -121,3 +121,8 @@ func (msg *UnSubAck) size() int {
 
 	return total
 }
+
+func (msg *UnSubAck) reset() {
+	msg.resetHeader()
+	msg.returnCodes = msg.returnCodes[:0]
+}
@@ -100,7 +100,7 @@ func (msg *UnSubscribe) decodeMessage(from []byte) (int, error) {
 		if msg.version <= ProtocolV50 {
 			rejectReason = CodeRefusedServerUnavailable
 		}
-		return 0, rejectReason
+		return 0, violation(rejectReason, "MQTT-3.10.3-2")
 	}
 
 	return offset, nil
@@ -148,3 +148,13 @@ func (msg *UnSubscribe) size() int {
 
 	return total
 }
+
+func (msg *UnSubscribe) reset() {
+	msg.resetHeader()
+
+	for i := range msg.topics {
+		msg.topics[i] = nil
+	}
+
+	msg.topics = msg.topics[:0]
+}
@@ -0,0 +1,249 @@
+package mqttp
+
+import (
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	// writerFlushSize default amount of pending bytes which triggers flush
+	writerFlushSize = 64 * 1024
+	// writerPayloadCopyLimit default size of PUBLISH payload which is still copied into internal buffer
+	writerPayloadCopyLimit = 1024
+)
+
+// Writer encodes packets into reusable buffer and writes them to underlying stream in batches
+// PUBLISH payloads bigger than payload copy limit are not copied but passed to the stream
+// as separate buffer with vectored write (net.Buffers). Such payload must not be modified
+// until it has been flushed.
+// Writer is safe for concurrent use
+type Writer struct {
+	w         io.Writer
+	buf       []byte
+	segments  []writerSegment
+	timer     *time.Timer
+	err       error
+	interval  time.Duration
+	flushSize int
+	copyLimit int
+	lock      sync.Mutex
+}
+
+// writerSegment either refers to region of internal buffer or to not copied payload
+type writerSegment struct {
+	payload []byte
+	start   int
+	end     int
+}
+
+// NewWriter allocate new packet writer on top of w
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{
+		w:         w,
+		flushSize: writerFlushSize,
+		copyLimit: writerPayloadCopyLimit,
+	}
+}
+
+// SetFlushSize set amount of pending bytes which triggers flush
+// 0 means flush after each write
+func (w *Writer) SetFlushSize(sz int) {
+	w.lock.Lock()
+	w.flushSize = sz
+	w.lock.Unlock()
+}
+
+// SetFlushInterval set maximum time packet may stay in buffer before it is flushed
+// 0 disables time based flush, thus caller is responsible to invoke Flush
+func (w *Writer) SetFlushInterval(d time.Duration) {
+	w.lock.Lock()
+	w.interval = d
+	w.lock.Unlock()
+}
+
+// SetPayloadCopyLimit set size of PUBLISH payload above which payload is not copied
+// into internal buffer. Negative value makes every payload to be copied
+func (w *Writer) SetPayloadCopyLimit(sz int) {
+	w.lock.Lock()
+	w.copyLimit = sz
+	w.lock.Unlock()
+}
+
+// Write encodes packets into internal buffer and flushes it when flush size reached
+// If flush failed error is sticky and returned by every subsequent call
+func (w *Writer) Write(pkts ...IFace) error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if w.err != nil {
+		return w.err
+	}
+
+	pending := w.pending()
+
+	for _, pkt := range pkts {
+		if err := w.encode(pkt); err != nil {
+			return err
+		}
+	}
+
+	if w.pending() >= w.flushSize {
+		return w.flush()
+	}
+
+	if pending == 0 && w.interval > 0 && len(w.segments) > 0 {
+		if w.timer == nil {
+			w.timer = time.AfterFunc(w.interval, w.flushOnTimer)
+		} else {
+			w.timer.Reset(w.interval)
+		}
+	}
+
+	return nil
+}
+
+// Flush writes all pending packets to the underlying stream
+func (w *Writer) Flush() error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if w.err != nil {
+		return w.err
+	}
+
+	return w.flush()
+}
+
+// Buffered amount of bytes pending to be written
+func (w *Writer) Buffered() int {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	return w.pending()
+}
+
+func (w *Writer) flushOnTimer() {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if w.err == nil {
+		w.flush() // nolint: errcheck
+	}
+}
+
+func (w *Writer) encode(pkt IFace) error {
+	if pub, ok := pkt.(*Publish); ok && w.copyLimit >= 0 && len(pub.payload) > w.copyLimit {
+		return w.encodePublish(pub)
+	}
+
+	sz, err := pkt.Size()
+	if err != nil {
+		return err
+	}
+
+	start := w.grow(sz)
+
+	if _, err = pkt.Encode(w.buf[start:]); err != nil {
+		w.buf = w.buf[:start]
+		return err
+	}
+
+	w.appendBuf(start)
+
+	return nil
+}
+
+func (w *Writer) encodePublish(pub *Publish) error {
+	sz, err := pub.Size()
+	if err != nil {
+		return err
+	}
+
+	start := w.grow(sz - len(pub.payload))
+
+	if _, err = pub.encodeHead(w.buf[start:]); err != nil {
+		w.buf = w.buf[:start]
+		return err
+	}
+
+	w.appendBuf(start)
+	w.segments = append(w.segments, writerSegment{payload: pub.payload})
+
+	return nil
+}
+
+// grow extends buffer by sz bytes and returns offset of the extension
+func (w *Writer) grow(sz int) int {
+	start := len(w.buf)
+
+	if cap(w.buf)-start < sz {
+		buf := make([]byte, start, 2*cap(w.buf)+sz)
+		copy(buf, w.buf)
+		w.buf = buf
+	}
+
+	w.buf = w.buf[:start+sz]
+
+	return start
+}
+
+// appendBuf add region of internal buffer to segments
+// merges it with previous region if they are contiguous
+func (w *Writer) appendBuf(start int) {
+	if l := len(w.segments); l > 0 && w.segments[l-1].payload == nil && w.segments[l-1].end == start {
+		w.segments[l-1].end = len(w.buf)
+		return
+	}
+
+	w.segments = append(w.segments, writerSegment{start: start, end: len(w.buf)})
+}
+
+func (w *Writer) pending() int {
+	total := len(w.buf)
+
+	for _, s := range w.segments {
+		total += len(s.payload)
+	}
+
+	return total
+}
+
+func (w *Writer) flush() error {
+	if w.timer != nil {
+		w.timer.Stop()
+	}
+
+	if len(w.segments) == 0 {
+		return nil
+	}
+
+	var err error
+
+	if len(w.segments) == 1 {
+		_, err = w.w.Write(w.buf)
+	} else {
+		bufs := make(net.Buffers, 0, len(w.segments))
+		for _, s := range w.segments {
+			if s.payload != nil {
+				bufs = append(bufs, s.payload)
+			} else {
+				bufs = append(bufs, w.buf[s.start:s.end])
+			}
+		}
+
+		_, err = bufs.WriteTo(w.w)
+	}
+
+	// release references to payloads
+	for i := range w.segments {
+		w.segments[i].payload = nil
+	}
+
+	w.segments = w.segments[:0]
+	w.buf = w.buf[:0]
+	w.err = err
+
+	return err
+}
@@ -0,0 +1,118 @@
+package mqttp
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriterBatch(t *testing.T) {
+	out := &bytes.Buffer{}
+	w := NewWriter(out)
+
+	var pkts []IFace
+	var expected []byte
+
+	for i := 1; i < 10; i++ {
+		pkt := NewPubAck(ProtocolV311)
+		pkt.SetPacketID(IDType(i))
+		pkts = append(pkts, pkt)
+
+		buf, err := Encode(pkt)
+		require.NoError(t, err)
+		expected = append(expected, buf...)
+	}
+
+	err := w.Write(pkts...)
+	require.NoError(t, err)
+	require.Equal(t, 0, out.Len())
+	require.Equal(t, len(expected), w.Buffered())
+
+	err = w.Flush()
+	require.NoError(t, err)
+	require.Equal(t, expected, out.Bytes())
+	require.Equal(t, 0, w.Buffered())
+}
+
+func TestWriterLargePayload(t *testing.T) {
+	out := &bytes.Buffer{}
+	w := NewWriter(out)
+	w.SetPayloadCopyLimit(16)
+
+	small := NewPublish(ProtocolV50)
+	err := small.Set("small", []byte("payload"), QoS0, false, false)
+	require.NoError(t, err)
+
+	large := NewPublish(ProtocolV50)
+	err = large.Set("large", bytes.Repeat([]byte{0xAA}, 1024), QoS1, true, false)
+	require.NoError(t, err)
+	large.SetPacketID(1)
+
+	err = w.Write(small, large, NewPingReq(ProtocolV50))
+	require.NoError(t, err)
+	require.Len(t, w.segments, 3)
+
+	err = w.Flush()
+	require.NoError(t, err)
+
+	r := NewReader(out, ProtocolV50)
+
+	pkt, err := r.Read()
+	require.NoError(t, err)
+	require.Equal(t, []byte("payload"), pkt.(*Publish).Payload())
+
+	pkt, err = r.Read()
+	require.NoError(t, err)
+	require.Equal(t, "large", pkt.(*Publish).Topic())
+	require.Equal(t, large.Payload(), pkt.(*Publish).Payload())
+	require.True(t, pkt.(*Publish).Retain())
+
+	pkt, err = r.Read()
+	require.NoError(t, err)
+	require.Equal(t, PINGREQ, pkt.Type())
+}
+
+func TestWriterFlushSize(t *testing.T) {
+	out := &bytes.Buffer{}
+	w := NewWriter(out)
+	w.SetFlushSize(0)
+
+	err := w.Write(NewPingResp(ProtocolV311))
+	require.NoError(t, err)
+	require.Equal(t, []byte{byte(PINGRESP << offsetPacketType), 0}, out.Bytes())
+}
+
+func TestWriterFlushInterval(t *testing.T) {
+	out := &lockedBuffer{}
+	w := NewWriter(out)
+	w.SetFlushInterval(10 * time.Millisecond)
+
+	err := w.Write(NewPingReq(ProtocolV311))
+	require.NoError(t, err)
+
+	require.Eventually(t, func() bool {
+		return out.Len() == 2
+	}, time.Second, 5*time.Millisecond)
+}
+
+type lockedBuffer struct {
+	buf  bytes.Buffer
+	lock sync.Mutex
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) Len() int {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	return b.buf.Len()
+}
@@ -19,6 +19,9 @@ type DynamicIFace interface {
 	Get() uint64
 }
 
+// Max satisfies mqttp.QuotaCounter thus can track in-flight packets of mqttp.FlowControl
+var _ mqttp.QuotaCounter = (*Max)(nil)
+
 type base struct {
 	uint64
 }
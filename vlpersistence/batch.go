@@ -0,0 +1,170 @@
+package vlpersistence
+
+// SessionTx mutations of single session grouped by Batch
+type SessionTx interface {
+	Create(state *SessionBase) error
+	Delete() error
+	SubscriptionsStore(data []byte) error
+	SubscriptionsDelete() error
+	ExpiryStore(delays *SessionDelays) error
+	ExpiryDelete() error
+	StateStore(state *SessionState) error
+	StateDelete() error
+	PacketsStore(packets PersistedPackets) error
+	PacketsDelete() error
+}
+
+// SessionsBatcher implemented by Sessions providers able to apply mutations of session atomically
+// Either all mutations issued by fn are applied or none of them, none if fn returns error
+type SessionsBatcher interface {
+	Batch(id []byte, fn func(tx SessionTx) error) error
+}
+
+// Batch group mutations of session id issued by fn into one unit
+// If s implements SessionsBatcher unit is atomic. Otherwise mutations are recorded and applied
+// in order once fn returns without error, thus error from fn leaves storage untouched
+// but failure of any mutation leaves ones applied before it in place
+func Batch(s Sessions, id []byte, fn func(tx SessionTx) error) error {
+	if b, ok := s.(SessionsBatcher); ok {
+		return b.Batch(id, fn)
+	}
+
+	tx := &recordedTx{}
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+
+	for _, op := range tx.ops {
+		if err := op(s, id); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// recordedTx records mutations to be applied one by one
+// Arguments are copied as caller might modify them before mutations are applied
+type recordedTx struct {
+	ops []func(Sessions, []byte) error
+}
+
+var _ SessionTx = (*recordedTx)(nil)
+
+func (tx *recordedTx) add(op func(Sessions, []byte) error) error {
+	tx.ops = append(tx.ops, op)
+	return nil
+}
+
+func (tx *recordedTx) Create(state *SessionBase) error {
+	if state == nil {
+		return ErrInvalidArgs
+	}
+
+	st := *state
+
+	return tx.add(func(s Sessions, id []byte) error { return s.Create(id, &st) })
+}
+
+func (tx *recordedTx) Delete() error {
+	return tx.add(func(s Sessions, id []byte) error { return s.Delete(id) })
+}
+
+func (tx *recordedTx) SubscriptionsStore(data []byte) error {
+	data = copyBytes(data)
+
+	return tx.add(func(s Sessions, id []byte) error { return s.SubscriptionsStore(id, data) })
+}
+
+func (tx *recordedTx) SubscriptionsDelete() error {
+	return tx.add(func(s Sessions, id []byte) error { return s.SubscriptionsDelete(id) })
+}
+
+func (tx *recordedTx) ExpiryStore(delays *SessionDelays) error {
+	if delays == nil {
+		return ErrInvalidArgs
+	}
+
+	delays = copyDelays(delays)
+
+	return tx.add(func(s Sessions, id []byte) error { return s.ExpiryStore(id, delays) })
+}
+
+func (tx *recordedTx) ExpiryDelete() error {
+	return tx.add(func(s Sessions, id []byte) error { return s.ExpiryDelete(id) })
+}
+
+func (tx *recordedTx) StateStore(state *SessionState) error {
+	if state == nil {
+		return ErrInvalidArgs
+	}
+
+	st := *state
+	st.Subscriptions = copyBytes(state.Subscriptions)
+	st.Errors = append([]error(nil), state.Errors...)
+	st.Expire = copyDelays(state.Expire)
+
+	return tx.add(func(s Sessions, id []byte) error { return s.StateStore(id, &st) })
+}
+
+func (tx *recordedTx) StateDelete() error {
+	return tx.add(func(s Sessions, id []byte) error { return s.StateDelete(id) })
+}
+
+func (tx *recordedTx) PacketsStore(packets PersistedPackets) error {
+	packets = PersistedPackets{
+		QoS0:  copyPackets(packets.QoS0),
+		QoS12: copyPackets(packets.QoS12),
+		UnAck: copyPackets(packets.UnAck),
+	}
+
+	return tx.add(func(s Sessions, id []byte) error { return s.PacketsStore(id, packets) })
+}
+
+func (tx *recordedTx) PacketsDelete() error {
+	return tx.add(func(s Sessions, id []byte) error { return s.PacketsDelete(id) })
+}
+
+func copyBytes(b []byte) []byte {
+	if b == nil {
+		return nil
+	}
+
+	res := make([]byte, len(b))
+	copy(res, b)
+
+	return res
+}
+
+func copyDelays(d *SessionDelays) *SessionDelays {
+	if d == nil {
+		return nil
+	}
+
+	res := *d
+	res.Will = copyBytes(d.Will)
+
+	return &res
+}
+
+func copyPackets(packets []*PersistedPacket) []*PersistedPacket {
+	if packets == nil {
+		return nil
+	}
+
+	res := make([]*PersistedPacket, 0, len(packets))
+
+	for _, p := range packets {
+		if p == nil {
+			res = append(res, nil)
+			continue
+		}
+
+		cp := *p
+		cp.Data = copyBytes(p.Data)
+		res = append(res, &cp)
+	}
+
+	return res
+}
@@ -0,0 +1,178 @@
+package mem
+
+import (
+	"github.com/VolantMQ/vlapi/vlpersistence"
+)
+
+// sessionTx records mutations applied to copy of the session on commit
+type sessionTx struct {
+	ops []func(sess *session) (*session, error)
+}
+
+var _ vlpersistence.SessionsBatcher = (*sessions)(nil)
+var _ vlpersistence.SessionTx = (*sessionTx)(nil)
+
+// Batch apply mutations of the session atomically
+// Mutations are applied to copy of the session which replaces it only if all of them succeed
+func (s *sessions) Batch(id []byte, fn func(tx vlpersistence.SessionTx) error) error {
+	if fn == nil {
+		return vlpersistence.ErrInvalidArgs
+	}
+
+	if err := s.status.check(); err != nil {
+		return err
+	}
+
+	tx := &sessionTx{}
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	sess := s.entries[string(id)].clone()
+
+	for _, op := range tx.ops {
+		var err error
+
+		if sess, err = op(sess); err != nil {
+			return err
+		}
+	}
+
+	if sess == nil {
+		delete(s.entries, string(id))
+	} else {
+		s.entries[string(id)] = sess
+	}
+
+	return nil
+}
+
+func (tx *sessionTx) add(op func(*session) (*session, error)) error {
+	tx.ops = append(tx.ops, op)
+	return nil
+}
+
+// update add mutation of existing session
+func (tx *sessionTx) update(op func(*session)) error {
+	return tx.add(func(sess *session) (*session, error) {
+		if sess == nil {
+			return nil, vlpersistence.ErrNotFound
+		}
+
+		op(sess)
+
+		return sess, nil
+	})
+}
+
+func (tx *sessionTx) Create(state *vlpersistence.SessionBase) error {
+	if state == nil {
+		return vlpersistence.ErrInvalidArgs
+	}
+
+	base := *state
+
+	return tx.add(func(sess *session) (*session, error) {
+		if sess != nil {
+			return nil, vlpersistence.ErrAlreadyExists
+		}
+
+		return &session{base: base}, nil
+	})
+}
+
+func (tx *sessionTx) Delete() error {
+	return tx.add(func(sess *session) (*session, error) {
+		if sess == nil {
+			return nil, vlpersistence.ErrNotFound
+		}
+
+		return nil, nil
+	})
+}
+
+func (tx *sessionTx) SubscriptionsStore(data []byte) error {
+	data = copyBytes(data)
+
+	return tx.update(func(sess *session) { sess.subscriptions = data })
+}
+
+func (tx *sessionTx) SubscriptionsDelete() error {
+	return tx.update(func(sess *session) { sess.subscriptions = nil })
+}
+
+func (tx *sessionTx) ExpiryStore(delays *vlpersistence.SessionDelays) error {
+	if delays == nil {
+		return vlpersistence.ErrInvalidArgs
+	}
+
+	delays = copyDelays(delays)
+
+	return tx.update(func(sess *session) { sess.expire = delays })
+}
+
+func (tx *sessionTx) ExpiryDelete() error {
+	return tx.update(func(sess *session) { sess.expire = nil })
+}
+
+func (tx *sessionTx) StateStore(state *vlpersistence.SessionState) error {
+	if state == nil {
+		return vlpersistence.ErrInvalidArgs
+	}
+
+	base := state.SessionBase
+	subscriptions := copyBytes(state.Subscriptions)
+	expire := copyDelays(state.Expire)
+
+	return tx.update(func(sess *session) {
+		sess.base = base
+		sess.subscriptions = subscriptions
+		sess.expire = expire
+	})
+}
+
+func (tx *sessionTx) StateDelete() error {
+	return tx.update(func(sess *session) {
+		sess.subscriptions = nil
+		sess.expire = nil
+	})
+}
+
+func (tx *sessionTx) PacketsStore(packets vlpersistence.PersistedPackets) error {
+	qos0 := copyPackets(packets.QoS0)
+	qos12 := copyPackets(packets.QoS12)
+	unAck := copyPackets(packets.UnAck)
+
+	return tx.update(func(sess *session) {
+		sess.qos0 = append(sess.qos0, qos0...)
+		sess.qos12 = append(sess.qos12, qos12...)
+		sess.unAck = append(sess.unAck, unAck...)
+	})
+}
+
+func (tx *sessionTx) PacketsDelete() error {
+	return tx.update(func(sess *session) {
+		sess.qos0 = nil
+		sess.qos12 = nil
+		sess.unAck = nil
+	})
+}
+
+// clone session thus mutations do not affect original until committed
+// packets are shared as they are never modified in place
+func (sess *session) clone() *session {
+	if sess == nil {
+		return nil
+	}
+
+	res := *sess
+	res.qos0 = append([]*vlpersistence.PersistedPacket(nil), sess.qos0...)
+	res.qos12 = append([]*vlpersistence.PersistedPacket(nil), sess.qos12...)
+	res.unAck = append([]*vlpersistence.PersistedPacket(nil), sess.unAck...)
+
+	return &res
+}
@@ -0,0 +1,124 @@
+// Package mem implements vlpersistence.IFace keeping everything in memory.
+// Nothing survives process restart thus it is intended for tests and
+// brokers which do not need persistence.
+//
+// Data passed to and returned by the backend is copied, thus callers are free
+// to reuse their buffers. All types are safe for concurrent use.
+package mem
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/VolantMQ/vlapi/vlpersistence"
+)
+
+// Version reported in SystemState of the fresh backend
+const Version = "1.0.0"
+
+// Backend in-memory persistence
+type Backend struct {
+	status   status
+	sessions *sessions
+	retained *retained
+	system   *system
+}
+
+// status shared by backend parts, closed once Shutdown called
+type status struct {
+	closed int32
+}
+
+var _ vlpersistence.IFace = (*Backend)(nil)
+
+// New allocate empty backend
+func New() *Backend {
+	b := &Backend{}
+
+	b.sessions = newSessions(&b.status)
+	b.retained = &retained{status: &b.status}
+	b.system = &system{
+		status: &b.status,
+		state: vlpersistence.SystemState{
+			Version:   Version,
+			CreatedAt: time.Now().Format(time.RFC3339),
+		},
+	}
+
+	return b
+}
+
+// Sessions provider
+func (b *Backend) Sessions() (vlpersistence.Sessions, error) {
+	if err := b.status.check(); err != nil {
+		return nil, err
+	}
+
+	return b.sessions, nil
+}
+
+// Retained provider
+func (b *Backend) Retained() (vlpersistence.Retained, error) {
+	if err := b.status.check(); err != nil {
+		return nil, err
+	}
+
+	return b.retained, nil
+}
+
+// System provider
+func (b *Backend) System() (vlpersistence.System, error) {
+	if err := b.status.check(); err != nil {
+		return nil, err
+	}
+
+	return b.system, nil
+}
+
+// Shutdown backend, any further call returns vlpersistence.ErrNotOpen
+func (b *Backend) Shutdown() error {
+	if !atomic.CompareAndSwapInt32(&b.status.closed, 0, 1) {
+		return vlpersistence.ErrNotOpen
+	}
+
+	return nil
+}
+
+func (s *status) check() error {
+	if atomic.LoadInt32(&s.closed) != 0 {
+		return vlpersistence.ErrNotOpen
+	}
+
+	return nil
+}
+
+func copyBytes(b []byte) []byte {
+	if b == nil {
+		return nil
+	}
+
+	res := make([]byte, len(b))
+	copy(res, b)
+
+	return res
+}
+
+func copyPacket(p *vlpersistence.PersistedPacket) *vlpersistence.PersistedPacket {
+	return &vlpersistence.PersistedPacket{
+		ExpireAt: p.ExpireAt,
+		Data:     copyBytes(p.Data),
+		QoS:      p.QoS,
+	}
+}
+
+func copyPackets(packets []*vlpersistence.PersistedPacket) []*vlpersistence.PersistedPacket {
+	res := make([]*vlpersistence.PersistedPacket, 0, len(packets))
+
+	for _, p := range packets {
+		if p != nil {
+			res = append(res, copyPacket(p))
+		}
+	}
+
+	return res
+}
@@ -0,0 +1,89 @@
+package mem
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/VolantMQ/vlapi/vlpersistence"
+	"github.com/VolantMQ/vlapi/vlpersistence/persistencetest"
+)
+
+// noBatch hides SessionsBatcher thus vlpersistence.Batch falls back to recorded mutations
+type noBatch struct {
+	*Backend
+}
+
+type noBatchSessions struct {
+	vlpersistence.Sessions
+}
+
+func (b noBatch) Sessions() (vlpersistence.Sessions, error) {
+	s, err := b.Backend.Sessions()
+	if err != nil {
+		return nil, err
+	}
+
+	return noBatchSessions{s}, nil
+}
+
+func TestSuite(t *testing.T) {
+	persistencetest.RunSuite(t, func() vlpersistence.IFace {
+		return New()
+	})
+}
+
+func TestSuiteBatchFallback(t *testing.T) {
+	persistencetest.RunSuite(t, func() vlpersistence.IFace {
+		return noBatch{New()}
+	})
+}
+
+// TestBackend walks session, retained and system providers of fresh backend the way broker does
+func TestBackend(t *testing.T) {
+	b := New()
+
+	s, err := b.Sessions()
+	require.NoError(t, err)
+
+	id := []byte("client")
+	require.NoError(t, s.Create(id, &vlpersistence.SessionBase{Timestamp: "ts", Version: 5}))
+	require.NoError(t, s.SubscriptionsStore(id, []byte("subs")))
+	require.NoError(t, s.PacketStoreQoS12(id, &vlpersistence.PersistedPacket{Data: []byte("packet")}))
+
+	count, err := s.PacketCountQoS12(id)
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), count)
+
+	var loaded []string
+	require.NoError(t, s.PacketsForEachQoS12(id, nil, func(_ interface{}, p *vlpersistence.PersistedPacket) (bool, error) {
+		loaded = append(loaded, string(p.Data))
+		return true, nil
+	}))
+	require.Equal(t, []string{"packet"}, loaded)
+
+	count, err = s.PacketCountQoS12(id)
+	require.NoError(t, err)
+	require.Zero(t, count)
+
+	r, err := b.Retained()
+	require.NoError(t, err)
+	require.NoError(t, r.Store([]*vlpersistence.PersistedPacket{{Data: []byte("retained")}}))
+
+	retained, err := r.Load()
+	require.NoError(t, err)
+	require.Len(t, retained, 1)
+
+	sys, err := b.System()
+	require.NoError(t, err)
+
+	info, err := sys.GetInfo()
+	require.NoError(t, err)
+	require.NotEmpty(t, info.CreatedAt)
+
+	require.NoError(t, s.Delete(id))
+	require.False(t, s.Exists(id))
+
+	require.NoError(t, b.Shutdown())
+	require.Equal(t, vlpersistence.ErrNotOpen, b.Shutdown())
+}
@@ -0,0 +1,141 @@
+package mem
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/VolantMQ/vlapi/mqttp"
+	"github.com/VolantMQ/vlapi/vlpersistence"
+)
+
+// retained provider
+// packets stored in bulk by Store do not carry topic, thus only ones put per topic
+// are subject of Lookup
+type retained struct {
+	lock    sync.Mutex
+	status  *status
+	packets []*vlpersistence.PersistedPacket
+	topics  map[string]*vlpersistence.PersistedPacket
+}
+
+var _ vlpersistence.Retained = (*retained)(nil)
+var _ vlpersistence.RetainedTopics = (*retained)(nil)
+
+func (r *retained) Store(packets []*vlpersistence.PersistedPacket) error {
+	if err := r.status.check(); err != nil {
+		return err
+	}
+
+	packets = copyPackets(packets)
+
+	r.lock.Lock()
+	r.packets = packets
+	r.topics = nil
+	r.lock.Unlock()
+
+	return nil
+}
+
+// Load packets stored in bulk followed by ones put per topic in order of topics
+func (r *retained) Load() ([]*vlpersistence.PersistedPacket, error) {
+	if err := r.status.check(); err != nil {
+		return nil, err
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	res := make([]*vlpersistence.PersistedPacket, 0, len(r.packets)+len(r.topics))
+
+	for _, p := range r.packets {
+		if !p.Expired() {
+			res = append(res, copyPacket(p))
+		}
+	}
+
+	return append(res, r.lookup(func(string) bool { return true })...), nil
+}
+
+func (r *retained) Wipe() error {
+	if err := r.status.check(); err != nil {
+		return err
+	}
+
+	r.lock.Lock()
+	r.packets = nil
+	r.topics = nil
+	r.lock.Unlock()
+
+	return nil
+}
+
+func (r *retained) Put(topic string, p *vlpersistence.PersistedPacket) error {
+	if p == nil || !mqttp.ValidTopic([]byte(topic)) {
+		return vlpersistence.ErrInvalidArgs
+	}
+
+	if err := r.status.check(); err != nil {
+		return err
+	}
+
+	p = copyPacket(p)
+
+	r.lock.Lock()
+	if r.topics == nil {
+		r.topics = make(map[string]*vlpersistence.PersistedPacket)
+	}
+
+	r.topics[topic] = p
+	r.lock.Unlock()
+
+	return nil
+}
+
+func (r *retained) Delete(topic string) error {
+	if err := r.status.check(); err != nil {
+		return err
+	}
+
+	r.lock.Lock()
+	delete(r.topics, topic)
+	r.lock.Unlock()
+
+	return nil
+}
+
+// Lookup packets in order of topics
+func (r *retained) Lookup(filter string) ([]*vlpersistence.PersistedPacket, error) {
+	b := []byte(filter)
+	if !mqttp.IsValidUTF(b) || !mqttp.TopicFilterRegexp.Match(b) {
+		return nil, vlpersistence.ErrInvalidArgs
+	}
+
+	if err := r.status.check(); err != nil {
+		return nil, err
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	return r.lookup(func(topic string) bool { return mqttp.TopicMatch(filter, topic) }), nil
+}
+
+// lookup copies of packets put per topic which are not expired, must be called with lock held
+func (r *retained) lookup(match func(string) bool) []*vlpersistence.PersistedPacket {
+	topics := make([]string, 0, len(r.topics))
+
+	for topic, p := range r.topics {
+		if !p.Expired() && match(topic) {
+			topics = append(topics, topic)
+		}
+	}
+
+	sort.Strings(topics)
+
+	res := make([]*vlpersistence.PersistedPacket, 0, len(topics))
+	for _, topic := range topics {
+		res = append(res, copyPacket(r.topics[topic]))
+	}
+
+	return res
+}
@@ -0,0 +1,362 @@
+package mem
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/VolantMQ/vlapi/vlpersistence"
+)
+
+// sessions provider
+// Session must be created with Create before any of its parts is stored,
+// operations on unknown session return vlpersistence.ErrNotFound
+type sessions struct {
+	lock    sync.Mutex
+	status  *status
+	entries map[string]*session
+}
+
+type session struct {
+	base          vlpersistence.SessionBase
+	subscriptions []byte
+	expire        *vlpersistence.SessionDelays
+	qos0          []*vlpersistence.PersistedPacket
+	qos12         []*vlpersistence.PersistedPacket
+	unAck         []*vlpersistence.PersistedPacket
+}
+
+var _ vlpersistence.Sessions = (*sessions)(nil)
+
+func newSessions(s *status) *sessions {
+	return &sessions{
+		status:  s,
+		entries: make(map[string]*session),
+	}
+}
+
+func (s *sessions) Create(id []byte, state *vlpersistence.SessionBase) error {
+	if state == nil {
+		return vlpersistence.ErrInvalidArgs
+	}
+
+	if err := s.status.check(); err != nil {
+		return err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if _, ok := s.entries[string(id)]; ok {
+		return vlpersistence.ErrAlreadyExists
+	}
+
+	s.entries[string(id)] = &session{base: *state}
+
+	return nil
+}
+
+// Count of sessions, 0 once provider is shut down
+func (s *sessions) Count() uint64 {
+	if s.status.check() != nil {
+		return 0
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return uint64(len(s.entries))
+}
+
+// LoadForEach pass each session to the loader in order of ids
+// loader is called without lock held thus may call back into provider
+func (s *sessions) LoadForEach(loader vlpersistence.SessionLoader, ctx interface{}) error {
+	if loader == nil {
+		return vlpersistence.ErrInvalidArgs
+	}
+
+	if err := s.status.check(); err != nil {
+		return err
+	}
+
+	type entry struct {
+		id    string
+		state *vlpersistence.SessionState
+	}
+
+	s.lock.Lock()
+	entries := make([]entry, 0, len(s.entries))
+	for id, sess := range s.entries {
+		entries = append(entries, entry{id: id, state: sess.loadState()})
+	}
+	s.lock.Unlock()
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].id < entries[j].id })
+
+	for _, e := range entries {
+		if err := loader.LoadSession(ctx, []byte(e.id), e.state); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Exists reports whether session exists, false once provider is shut down
+func (s *sessions) Exists(id []byte) bool {
+	if s.status.check() != nil {
+		return false
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	_, ok := s.entries[string(id)]
+
+	return ok
+}
+
+func (s *sessions) Delete(id []byte) error {
+	return s.with(id, func(*session) error {
+		delete(s.entries, string(id))
+		return nil
+	})
+}
+
+func (s *sessions) SubscriptionsStore(id []byte, data []byte) error {
+	data = copyBytes(data)
+
+	return s.with(id, func(sess *session) error {
+		sess.subscriptions = data
+		return nil
+	})
+}
+
+func (s *sessions) SubscriptionsDelete(id []byte) error {
+	return s.with(id, func(sess *session) error {
+		sess.subscriptions = nil
+		return nil
+	})
+}
+
+func (s *sessions) StateStore(id []byte, state *vlpersistence.SessionState) error {
+	if state == nil {
+		return vlpersistence.ErrInvalidArgs
+	}
+
+	subscriptions := copyBytes(state.Subscriptions)
+	expire := copyDelays(state.Expire)
+
+	return s.with(id, func(sess *session) error {
+		sess.base = state.SessionBase
+		sess.subscriptions = subscriptions
+		sess.expire = expire
+		return nil
+	})
+}
+
+// StateDelete delete subscriptions and expiry of the session, session itself is kept
+func (s *sessions) StateDelete(id []byte) error {
+	return s.with(id, func(sess *session) error {
+		sess.subscriptions = nil
+		sess.expire = nil
+		return nil
+	})
+}
+
+func (s *sessions) ExpiryStore(id []byte, delays *vlpersistence.SessionDelays) error {
+	if delays == nil {
+		return vlpersistence.ErrInvalidArgs
+	}
+
+	delays = copyDelays(delays)
+
+	return s.with(id, func(sess *session) error {
+		sess.expire = delays
+		return nil
+	})
+}
+
+func (s *sessions) ExpiryDelete(id []byte) error {
+	return s.with(id, func(sess *session) error {
+		sess.expire = nil
+		return nil
+	})
+}
+
+func (s *sessions) PacketCountQoS0(id []byte) (uint64, error) {
+	return s.count(id, func(sess *session) []*vlpersistence.PersistedPacket { return sess.qos0 })
+}
+
+func (s *sessions) PacketCountQoS12(id []byte) (uint64, error) {
+	return s.count(id, func(sess *session) []*vlpersistence.PersistedPacket { return sess.qos12 })
+}
+
+func (s *sessions) PacketCountUnAck(id []byte) (uint64, error) {
+	return s.count(id, func(sess *session) []*vlpersistence.PersistedPacket { return sess.unAck })
+}
+
+func (s *sessions) PacketStoreQoS0(id []byte, p *vlpersistence.PersistedPacket) error {
+	if p == nil {
+		return vlpersistence.ErrInvalidArgs
+	}
+
+	p = copyPacket(p)
+
+	return s.with(id, func(sess *session) error {
+		sess.qos0 = append(sess.qos0, p)
+		return nil
+	})
+}
+
+func (s *sessions) PacketStoreQoS12(id []byte, p *vlpersistence.PersistedPacket) error {
+	if p == nil {
+		return vlpersistence.ErrInvalidArgs
+	}
+
+	p = copyPacket(p)
+
+	return s.with(id, func(sess *session) error {
+		sess.qos12 = append(sess.qos12, p)
+		return nil
+	})
+}
+
+func (s *sessions) PacketsForEachQoS0(id []byte, ctx interface{}, loader vlpersistence.PacketLoader) error {
+	return s.forEach(id, ctx, vlpersistence.SkipExpired(loader), func(sess *session) *[]*vlpersistence.PersistedPacket { return &sess.qos0 })
+}
+
+func (s *sessions) PacketsForEachQoS12(id []byte, ctx interface{}, loader vlpersistence.PacketLoader) error {
+	return s.forEach(id, ctx, vlpersistence.SkipExpired(loader), func(sess *session) *[]*vlpersistence.PersistedPacket { return &sess.qos12 })
+}
+
+func (s *sessions) PacketsForEachUnAck(id []byte, ctx interface{}, loader vlpersistence.PacketLoader) error {
+	return s.forEach(id, ctx, loader, func(sess *session) *[]*vlpersistence.PersistedPacket { return &sess.unAck })
+}
+
+// PacketsStore append packets to ones stored before
+func (s *sessions) PacketsStore(id []byte, packets vlpersistence.PersistedPackets) error {
+	qos0 := copyPackets(packets.QoS0)
+	qos12 := copyPackets(packets.QoS12)
+	unAck := copyPackets(packets.UnAck)
+
+	return s.with(id, func(sess *session) error {
+		sess.qos0 = append(sess.qos0, qos0...)
+		sess.qos12 = append(sess.qos12, qos12...)
+		sess.unAck = append(sess.unAck, unAck...)
+		return nil
+	})
+}
+
+// PacketsDelete delete all packets of the session, session itself is kept
+func (s *sessions) PacketsDelete(id []byte) error {
+	return s.with(id, func(sess *session) error {
+		sess.qos0 = nil
+		sess.qos12 = nil
+		sess.unAck = nil
+		return nil
+	})
+}
+
+// with run fn on existing session with lock held
+func (s *sessions) with(id []byte, fn func(*session) error) error {
+	if err := s.status.check(); err != nil {
+		return err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	sess, ok := s.entries[string(id)]
+	if !ok {
+		return vlpersistence.ErrNotFound
+	}
+
+	return fn(sess)
+}
+
+func (s *sessions) count(id []byte, list func(*session) []*vlpersistence.PersistedPacket) (uint64, error) {
+	var res uint64
+
+	err := s.with(id, func(sess *session) error {
+		res = uint64(len(list(sess)))
+		return nil
+	})
+
+	return res, err
+}
+
+// forEach pass packets to the loader and delete ones loader asked for
+// loader is called without lock held thus may call back into provider,
+// packets stored meanwhile are kept and not passed to the loader
+func (s *sessions) forEach(id []byte, ctx interface{}, loader vlpersistence.PacketLoader, list func(*session) *[]*vlpersistence.PersistedPacket) error {
+	if loader == nil {
+		return vlpersistence.ErrInvalidArgs
+	}
+
+	var packets []*vlpersistence.PersistedPacket
+
+	if err := s.with(id, func(sess *session) error {
+		packets = append(packets, *list(sess)...)
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	deleted := make(map[*vlpersistence.PersistedPacket]bool)
+
+	var err error
+
+	for _, p := range packets {
+		var del bool
+
+		del, err = loader(ctx, copyPacket(p))
+		if del {
+			deleted[p] = true
+		}
+
+		if err != nil {
+			break
+		}
+	}
+
+	if len(deleted) > 0 {
+		// session might have been deleted by the loader
+		_ = s.with(id, func(sess *session) error {
+			l := list(sess)
+			left := (*l)[:0]
+
+			for _, p := range *l {
+				if !deleted[p] {
+					left = append(left, p)
+				}
+			}
+
+			*l = left
+
+			return nil
+		})
+	}
+
+	return err
+}
+
+// loadState state passed to SessionLoader, must be called with lock held
+func (sess *session) loadState() *vlpersistence.SessionState {
+	return &vlpersistence.SessionState{
+		Subscriptions: copyBytes(sess.subscriptions),
+		Expire:        copyDelays(sess.expire),
+		SessionBase:   sess.base,
+	}
+}
+
+func copyDelays(d *vlpersistence.SessionDelays) *vlpersistence.SessionDelays {
+	if d == nil {
+		return nil
+	}
+
+	return &vlpersistence.SessionDelays{
+		Since:    d.Since,
+		ExpireIn: d.ExpireIn,
+		Will:     copyBytes(d.Will),
+	}
+}
@@ -0,0 +1,45 @@
+package mem
+
+import (
+	"sync"
+
+	"github.com/VolantMQ/vlapi/vlpersistence"
+)
+
+type system struct {
+	lock   sync.Mutex
+	status *status
+	state  vlpersistence.SystemState
+}
+
+var _ vlpersistence.System = (*system)(nil)
+var _ vlpersistence.SystemInfoSetter = (*system)(nil)
+
+func (s *system) GetInfo() (*vlpersistence.SystemState, error) {
+	if err := s.status.check(); err != nil {
+		return nil, err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	state := s.state
+
+	return &state, nil
+}
+
+func (s *system) SetInfo(state *vlpersistence.SystemState) error {
+	if state == nil {
+		return vlpersistence.ErrInvalidArgs
+	}
+
+	if err := s.status.check(); err != nil {
+		return err
+	}
+
+	s.lock.Lock()
+	s.state = *state
+	s.lock.Unlock()
+
+	return nil
+}
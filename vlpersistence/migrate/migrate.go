@@ -0,0 +1,179 @@
+// Package migrate upgrades persistence storage schema with ordered migrations.
+//
+// Backend registers its migrations, numbered from 1 without gaps, in a Registry.
+// Schema version applied last is recorded in SystemState.SchemaVersion via
+// vlpersistence.SystemInfoSetter right after each migration, thus interrupted upgrade resumes where it stopped.
+// On start broker calls Registry.Run which either refuses storage with schema other
+// than the latest one or upgrades it, depending on policy.
+package migrate
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/VolantMQ/vlapi/vlpersistence"
+)
+
+// nolint: golint
+var (
+	ErrOutOfOrder = errors.New("migrate: migration out of order")
+	ErrOutdated   = errors.New("migrate: storage schema is outdated")
+	ErrTooNew     = errors.New("migrate: storage schema is newer than supported")
+	ErrNoSetInfo  = errors.New("migrate: backend System does not implement SetInfo, schema version can't be recorded")
+)
+
+// Policy on schema mismatch
+type Policy int
+
+const (
+	// Refuse return ErrOutdated if storage schema is older than the latest migration
+	Refuse Policy = iota
+	// AutoUpgrade apply pending migrations
+	AutoUpgrade
+)
+
+// Migration upgrades storage from schema Version-1 to Version
+type Migration struct {
+	Version uint32
+	Name    string
+	Up      func(p vlpersistence.IFace) error
+}
+
+// Registry ordered migrations of the backend
+type Registry struct {
+	lock       sync.Mutex
+	migrations []Migration
+}
+
+// NewRegistry allocate registry with migrations
+func NewRegistry(migrations ...Migration) (*Registry, error) {
+	r := &Registry{}
+
+	for _, m := range migrations {
+		if err := r.Register(m); err != nil {
+			return nil, err
+		}
+	}
+
+	return r, nil
+}
+
+// Register append migration, its version must follow the latest one registered
+func (r *Registry) Register(m Migration) error {
+	if m.Up == nil {
+		return vlpersistence.ErrInvalidArgs
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if m.Version != uint32(len(r.migrations))+1 {
+		return fmt.Errorf("%w: %d %q follows %d", ErrOutOfOrder, m.Version, m.Name, len(r.migrations))
+	}
+
+	r.migrations = append(r.migrations, m)
+
+	return nil
+}
+
+// Latest schema version, 0 if there are no migrations
+func (r *Registry) Latest() uint32 {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	return uint32(len(r.migrations))
+}
+
+// Check storage schema is the latest one
+// Returns ErrOutdated or ErrTooNew wrapped with versions on mismatch
+func (r *Registry) Check(p vlpersistence.IFace) error {
+	current, err := Current(p)
+	if err != nil {
+		return err
+	}
+
+	return r.compare(current)
+}
+
+// Upgrade apply migrations newer than storage schema in order
+// Returns ErrTooNew if storage schema is newer than the latest migration and
+// ErrNoSetInfo if backend is not able to record schema version
+func (r *Registry) Upgrade(p vlpersistence.IFace) error {
+	sys, err := p.System()
+	if err != nil {
+		return err
+	}
+
+	info, err := sys.GetInfo()
+	if err != nil {
+		return err
+	}
+
+	current := info.SchemaVersion
+
+	if err = r.compare(current); !errors.Is(err, ErrOutdated) {
+		return err
+	}
+
+	setter, ok := sys.(vlpersistence.SystemInfoSetter)
+	if !ok {
+		return ErrNoSetInfo
+	}
+
+	r.lock.Lock()
+	pending := append([]Migration(nil), r.migrations[current:]...)
+	r.lock.Unlock()
+
+	for _, m := range pending {
+		if err = m.Up(p); err != nil {
+			return fmt.Errorf("migrate: %d %q: %w", m.Version, m.Name, err)
+		}
+
+		info.SchemaVersion = m.Version
+
+		if err = setter.SetInfo(info); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Run check storage schema on start and upgrade it if policy allows
+func (r *Registry) Run(p vlpersistence.IFace, policy Policy) error {
+	err := r.Check(p)
+	if errors.Is(err, ErrOutdated) && policy == AutoUpgrade {
+		return r.Upgrade(p)
+	}
+
+	return err
+}
+
+func (r *Registry) compare(current uint32) error {
+	latest := r.Latest()
+
+	switch {
+	case current < latest:
+		return fmt.Errorf("%w: %d, expected %d", ErrOutdated, current, latest)
+	case current > latest:
+		return fmt.Errorf("%w: %d, expected %d", ErrTooNew, current, latest)
+	}
+
+	return nil
+}
+
+// Current storage schema version
+func Current(p vlpersistence.IFace) (uint32, error) {
+	sys, err := p.System()
+	if err != nil {
+		return 0, err
+	}
+
+	info, err := sys.GetInfo()
+	if err != nil {
+		return 0, err
+	}
+
+	return info.SchemaVersion, nil
+}
@@ -0,0 +1,151 @@
+package migrate
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/VolantMQ/vlapi/vlpersistence"
+	"github.com/VolantMQ/vlapi/vlpersistence/mem"
+)
+
+func TestRegistryOrder(t *testing.T) {
+	up := func(vlpersistence.IFace) error { return nil }
+
+	_, err := NewRegistry(Migration{Version: 2, Up: up})
+	require.True(t, errors.Is(err, ErrOutOfOrder))
+
+	r, err := NewRegistry(Migration{Version: 1, Up: up}, Migration{Version: 2, Up: up})
+	require.NoError(t, err)
+	require.Equal(t, uint32(2), r.Latest())
+
+	require.True(t, errors.Is(r.Register(Migration{Version: 2, Up: up}), ErrOutOfOrder))
+	require.Equal(t, vlpersistence.ErrInvalidArgs, r.Register(Migration{Version: 3}))
+}
+
+func TestRegistryRun(t *testing.T) {
+	var applied []string
+
+	migration := func(v uint32, name string, fail bool) Migration {
+		return Migration{
+			Version: v,
+			Name:    name,
+			Up: func(p vlpersistence.IFace) error {
+				if fail {
+					return vlpersistence.ErrBrokenEntry
+				}
+
+				applied = append(applied, name)
+				return nil
+			},
+		}
+	}
+
+	p := mem.New()
+
+	r, err := NewRegistry(migration(1, "first", false), migration(2, "second", false))
+	require.NoError(t, err)
+
+	require.True(t, errors.Is(r.Run(p, Refuse), ErrOutdated))
+	require.Empty(t, applied)
+
+	require.NoError(t, r.Run(p, AutoUpgrade))
+	require.Equal(t, []string{"first", "second"}, applied)
+
+	v, err := Current(p)
+	require.NoError(t, err)
+	require.Equal(t, uint32(2), v)
+
+	require.NoError(t, r.Run(p, Refuse))
+
+	// failed migration keeps version of the last successful one
+	require.NoError(t, r.Register(migration(3, "third", false)))
+	require.NoError(t, r.Register(migration(4, "broken", true)))
+
+	err = r.Upgrade(p)
+	require.True(t, errors.Is(err, vlpersistence.ErrBrokenEntry))
+	require.Equal(t, []string{"first", "second", "third"}, applied)
+
+	v, err = Current(p)
+	require.NoError(t, err)
+	require.Equal(t, uint32(3), v)
+
+	// older broker must not touch newer storage
+	older, err := NewRegistry(migration(1, "first", false))
+	require.NoError(t, err)
+	require.True(t, errors.Is(older.Run(p, AutoUpgrade), ErrTooNew))
+}
+
+func TestRegistryLegacyVersion(t *testing.T) {
+	p := mem.New()
+
+	sys, err := p.System()
+	require.NoError(t, err)
+
+	// storage created before schema versioning holds release version only
+	info, err := sys.GetInfo()
+	require.NoError(t, err)
+	require.Equal(t, "1.0.0", info.Version)
+
+	v, err := Current(p)
+	require.NoError(t, err)
+	require.Equal(t, uint32(0), v)
+
+	empty, err := NewRegistry()
+	require.NoError(t, err)
+	require.NoError(t, empty.Run(p, Refuse))
+
+	r, err := NewRegistry(Migration{Version: 1, Up: func(vlpersistence.IFace) error { return nil }})
+	require.NoError(t, err)
+	require.True(t, errors.Is(r.Run(p, Refuse), ErrOutdated))
+	require.NoError(t, r.Run(p, AutoUpgrade))
+
+	info, err = sys.GetInfo()
+	require.NoError(t, err)
+	require.Equal(t, "1.0.0", info.Version)
+	require.Equal(t, uint32(1), info.SchemaVersion)
+}
+
+// readOnly backend with System not implementing SystemInfoSetter
+type readOnly struct {
+	vlpersistence.IFace
+}
+
+type readOnlySystem struct {
+	sys vlpersistence.System
+}
+
+func (p readOnly) System() (vlpersistence.System, error) {
+	sys, err := p.IFace.System()
+	if err != nil {
+		return nil, err
+	}
+
+	return readOnlySystem{sys: sys}, nil
+}
+
+func (s readOnlySystem) GetInfo() (*vlpersistence.SystemState, error) {
+	return s.sys.GetInfo()
+}
+
+func TestRegistryNoSetInfo(t *testing.T) {
+	applied := false
+
+	r, err := NewRegistry(Migration{Version: 1, Up: func(vlpersistence.IFace) error {
+		applied = true
+		return nil
+	}})
+	require.NoError(t, err)
+
+	p := readOnly{IFace: mem.New()}
+
+	require.True(t, errors.Is(r.Run(p, Refuse), ErrOutdated))
+	require.Equal(t, ErrNoSetInfo, r.Run(p, AutoUpgrade))
+	require.False(t, applied)
+
+	// storage up to date needs no upgrade
+	empty, err := NewRegistry()
+	require.NoError(t, err)
+	require.NoError(t, empty.Run(p, AutoUpgrade))
+}
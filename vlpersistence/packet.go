@@ -0,0 +1,110 @@
+package vlpersistence
+
+import (
+	"time"
+
+	"github.com/VolantMQ/vlapi/mqttp"
+)
+
+// NewPersistedPacket encode packet to be persisted
+// Expiration time of PUBLISH set with SetExpireAt is carried in ExpireAt
+func NewPersistedPacket(pkt mqttp.IFace) (*PersistedPacket, error) {
+	if pkt == nil {
+		return nil, ErrInvalidArgs
+	}
+
+	buf, err := mqttp.Encode(pkt)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &PersistedPacket{
+		Data: buf,
+	}
+
+	if msg, ok := pkt.(*mqttp.Publish); ok {
+		p.ExpireAt, _, _ = msg.Expired()
+	}
+
+	return p, nil
+}
+
+// Expired check if packet has elapsed it's time
+// same as mqttp.Publish.Expired packet with less than a second left is considered expired
+// returns false if does not expire
+func (p *PersistedPacket) Expired() bool {
+	if p.ExpireAt.IsZero() {
+		return false
+	}
+
+	return time.Until(p.ExpireAt) < time.Second
+}
+
+// Decode packet persisted with NewPersistedPacket
+// Expiration time of PUBLISH is restored and for v5.0 Publication Expiry is rewritten
+// to the interval left thus packet is ready for redelivery
+// returns ErrExpired if packet has expired and ErrBrokenEntry if it cannot be decoded,
+// the latter wraps *mqttp.DecodeError if any
+func (p *PersistedPacket) Decode(v mqttp.ProtocolVersion) (mqttp.IFace, error) {
+	pkt, n, err := mqttp.Decode(v, p.Data)
+	if err != nil {
+		return nil, &brokenEntry{err: err}
+	}
+
+	if n != len(p.Data) {
+		return nil, ErrBrokenEntry
+	}
+
+	msg, ok := pkt.(*mqttp.Publish)
+	if !ok || p.ExpireAt.IsZero() {
+		return pkt, nil
+	}
+
+	msg.SetExpireAt(p.ExpireAt)
+
+	_, left, expired := msg.Expired()
+	if expired {
+		return nil, ErrExpired
+	}
+
+	if msg.Version() == mqttp.ProtocolV50 {
+		if err = msg.SetMessageExpiry(time.Duration(left) * time.Second); err != nil {
+			return nil, err
+		}
+	}
+
+	return msg, nil
+}
+
+// SkipExpired wraps loader thus expired packets are deleted without being passed to it
+// Backends apply it to PacketsForEachQoS0 and PacketsForEachQoS12
+func SkipExpired(loader PacketLoader) PacketLoader {
+	if loader == nil {
+		return nil
+	}
+
+	return func(ctx interface{}, p *PersistedPacket) (bool, error) {
+		if p.Expired() {
+			return true, nil
+		}
+
+		return loader(ctx, p)
+	}
+}
+
+// brokenEntry annotates decode failure of persisted packet with ErrBrokenEntry
+type brokenEntry struct {
+	err error
+}
+
+func (e *brokenEntry) Error() string {
+	return ErrBrokenEntry.Error() + ": " + e.err.Error()
+}
+
+func (e *brokenEntry) Unwrap() error {
+	return e.err
+}
+
+func (e *brokenEntry) Is(target error) bool {
+	return target == ErrBrokenEntry
+}
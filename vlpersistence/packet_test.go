@@ -0,0 +1,132 @@
+package vlpersistence
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/VolantMQ/vlapi/mqttp"
+)
+
+func newPublish(t *testing.T, v mqttp.ProtocolVersion, expireAt time.Time) *mqttp.Publish {
+	msg := mqttp.NewPublish(v)
+	require.NoError(t, msg.Set("a/b", []byte("payload"), mqttp.QoS1, false, false))
+	msg.SetPacketID(1)
+
+	if v == mqttp.ProtocolV50 {
+		require.NoError(t, msg.SetMessageExpiry(time.Hour))
+	}
+
+	msg.SetExpireAt(expireAt)
+
+	return msg
+}
+
+func TestPersistedPacketPublish(t *testing.T) {
+	expireAt := time.Now().Add(30 * time.Second).Truncate(time.Second)
+
+	for _, v := range []mqttp.ProtocolVersion{mqttp.ProtocolV311, mqttp.ProtocolV50} {
+		p, err := NewPersistedPacket(newPublish(t, v, expireAt))
+		require.NoError(t, err)
+		require.True(t, expireAt.Equal(p.ExpireAt))
+		require.False(t, p.Expired())
+
+		pkt, err := p.Decode(v)
+		require.NoError(t, err)
+
+		msg, ok := pkt.(*mqttp.Publish)
+		require.True(t, ok)
+		require.Equal(t, "a/b", msg.Topic())
+
+		tm, left, expired := msg.Expired()
+		require.False(t, expired)
+		require.True(t, expireAt.Equal(tm))
+
+		expiry, ok := msg.MessageExpiry()
+		if v == mqttp.ProtocolV50 {
+			// rewritten to the interval left
+			require.True(t, ok)
+			require.Equal(t, time.Duration(left)*time.Second, expiry)
+			require.True(t, expiry <= 30*time.Second)
+		} else {
+			require.False(t, ok)
+		}
+	}
+}
+
+func TestPersistedPacketExpired(t *testing.T) {
+	p, err := NewPersistedPacket(newPublish(t, mqttp.ProtocolV50, time.Now().Add(-time.Second)))
+	require.NoError(t, err)
+	require.True(t, p.Expired())
+
+	_, err = p.Decode(mqttp.ProtocolV50)
+	require.Equal(t, ErrExpired, err)
+
+	// no expiration
+	p, err = NewPersistedPacket(newPublish(t, mqttp.ProtocolV50, time.Time{}))
+	require.NoError(t, err)
+	require.True(t, p.ExpireAt.IsZero())
+	require.False(t, p.Expired())
+
+	pkt, err := p.Decode(mqttp.ProtocolV50)
+	require.NoError(t, err)
+
+	expiry, ok := pkt.(*mqttp.Publish).MessageExpiry()
+	require.True(t, ok)
+	require.Equal(t, time.Hour, expiry)
+}
+
+func TestPersistedPacketOther(t *testing.T) {
+	ack := mqttp.NewPubAck(mqttp.ProtocolV50)
+	ack.SetPacketID(10)
+
+	p, err := NewPersistedPacket(ack)
+	require.NoError(t, err)
+	require.True(t, p.ExpireAt.IsZero())
+
+	pkt, err := p.Decode(mqttp.ProtocolV50)
+	require.NoError(t, err)
+	require.Equal(t, mqttp.PUBACK, pkt.Type())
+
+	_, err = NewPersistedPacket(nil)
+	require.Equal(t, ErrInvalidArgs, err)
+
+	p.Data = p.Data[:1]
+	_, err = p.Decode(mqttp.ProtocolV50)
+	require.True(t, errors.Is(err, ErrBrokenEntry))
+
+	// decode failure is carried over
+	var decodeErr *mqttp.DecodeError
+	require.True(t, errors.As(err, &decodeErr))
+	require.Equal(t, mqttp.PUBACK, decodeErr.Type)
+	require.True(t, errors.Is(err, mqttp.ErrInsufficientDataSize))
+}
+
+func TestSkipExpired(t *testing.T) {
+	require.Nil(t, SkipExpired(nil))
+
+	var loaded []*PersistedPacket
+
+	loader := SkipExpired(func(_ interface{}, p *PersistedPacket) (bool, error) {
+		loaded = append(loaded, p)
+		return false, nil
+	})
+
+	live := &PersistedPacket{ExpireAt: time.Now().Add(time.Hour)}
+	forever := &PersistedPacket{}
+	expired := &PersistedPacket{ExpireAt: time.Now().Add(-time.Hour)}
+
+	for _, p := range []*PersistedPacket{live, forever} {
+		del, err := loader(nil, p)
+		require.NoError(t, err)
+		require.False(t, del)
+	}
+
+	del, err := loader(nil, expired)
+	require.NoError(t, err)
+	require.True(t, del)
+
+	require.Equal(t, []*PersistedPacket{live, forever}, loaded)
+}
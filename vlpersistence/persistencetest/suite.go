@@ -0,0 +1,796 @@
+// Package persistencetest provides conformance tests for vlpersistence backends.
+//
+// Backend is expected to
+//
+//	keep packets in order they have been stored, PacketsStore appends to packets stored before
+//	delete packet once PacketLoader returns true, even along with error
+//	skip and delete expired QoS0 and QoS12 packets, pass expired UnAck packets
+//	keep ExpireAt of packets, skip expired retained messages on Load
+//	stop iteration right after PacketLoader or SessionLoader returned error and return that error
+//	return ErrAlreadyExists from Create of existing session
+//	return ErrNotFound for any operation on session which does not exist
+//	replace all retained messages with Retained.Store
+//	if it implements RetainedTopics, update retained messages per topic and look them up by filter
+//	copy data passed in, thus caller may reuse buffers
+//	be safe for concurrent use
+//	apply Batch atomically if it implements SessionsBatcher
+//	return ErrNotOpen from IFace methods once shut down
+//
+// Usage
+//
+//	func TestBackend(t *testing.T) {
+//		persistencetest.RunSuite(t, func() vlpersistence.IFace {
+//			return mybackend.New()
+//		})
+//	}
+package persistencetest
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/VolantMQ/vlapi/mqttp"
+	"github.com/VolantMQ/vlapi/vlpersistence"
+)
+
+// RunSuite run conformance tests, factory must return fresh empty backend on each call
+func RunSuite(t *testing.T, factory func() vlpersistence.IFace) {
+	tests := []struct {
+		name string
+		fn   func(*testing.T, vlpersistence.IFace)
+	}{
+		{"SessionsCreate", testSessionsCreate},
+		{"SessionsNotFound", testSessionsNotFound},
+		{"SessionsLoadForEach", testSessionsLoadForEach},
+		{"SessionsLoaderError", testSessionsLoaderError},
+		{"PacketsOrder", testPacketsOrder},
+		{"PacketsDeleteDuringIteration", testPacketsDeleteDuringIteration},
+		{"PacketsLoaderError", testPacketsLoaderError},
+		{"PacketsDelete", testPacketsDelete},
+		{"PacketsExpired", testPacketsExpired},
+		{"DataIsCopied", testDataIsCopied},
+		{"Batch", testBatch},
+		{"BatchDataIsCopied", testBatchDataIsCopied},
+		{"Retained", testRetained},
+		{"RetainedTopics", testRetainedTopics},
+		{"System", testSystem},
+		{"Concurrent", testConcurrent},
+		{"Shutdown", testShutdown},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+
+		t.Run(tt.name, func(t *testing.T) {
+			p := factory()
+			require.NotNil(t, p)
+
+			tt.fn(t, p)
+		})
+	}
+}
+
+var errLoader = errors.New("persistencetest: loader error")
+
+type sessionLoader func(ctx interface{}, id []byte, state *vlpersistence.SessionState) error
+
+func (l sessionLoader) LoadSession(ctx interface{}, id []byte, state *vlpersistence.SessionState) error {
+	return l(ctx, id, state)
+}
+
+func sessions(t *testing.T, p vlpersistence.IFace) vlpersistence.Sessions {
+	s, err := p.Sessions()
+	require.NoError(t, err)
+	require.NotNil(t, s)
+
+	return s
+}
+
+func createSession(t *testing.T, s vlpersistence.Sessions, id string) []byte {
+	require.NoError(t, s.Create([]byte(id), &vlpersistence.SessionBase{Timestamp: "ts-" + id, Version: 5}))
+
+	return []byte(id)
+}
+
+func newPacket(i int) *vlpersistence.PersistedPacket {
+	return &vlpersistence.PersistedPacket{
+		ExpireAt: time.Date(2100, 1, 1, 0, 0, i, 0, time.UTC),
+		Data:     []byte("packet-" + strconv.Itoa(i)),
+	}
+}
+
+func newExpiredPacket(i int) *vlpersistence.PersistedPacket {
+	return &vlpersistence.PersistedPacket{
+		ExpireAt: time.Date(2000, 1, 1, 0, 0, i, 0, time.UTC),
+		Data:     []byte("expired-" + strconv.Itoa(i)),
+	}
+}
+
+func newPackets(from, to int) []*vlpersistence.PersistedPacket {
+	var res []*vlpersistence.PersistedPacket
+
+	for i := from; i < to; i++ {
+		res = append(res, newPacket(i))
+	}
+
+	return res
+}
+
+// collect all packets of the list without deleting them
+func collect(t *testing.T, forEach func([]byte, interface{}, vlpersistence.PacketLoader) error, id []byte) []*vlpersistence.PersistedPacket {
+	var res []*vlpersistence.PersistedPacket
+
+	require.NoError(t, forEach(id, nil, func(_ interface{}, p *vlpersistence.PersistedPacket) (bool, error) {
+		res = append(res, p)
+		return false, nil
+	}))
+
+	return res
+}
+
+func testSessionsCreate(t *testing.T, p vlpersistence.IFace) {
+	s := sessions(t, p)
+
+	require.Equal(t, uint64(0), s.Count())
+	require.False(t, s.Exists([]byte("a")))
+
+	id := createSession(t, s, "a")
+	createSession(t, s, "b")
+
+	require.True(t, s.Exists(id))
+	require.Equal(t, uint64(2), s.Count())
+	require.Equal(t, vlpersistence.ErrAlreadyExists, s.Create(id, &vlpersistence.SessionBase{}))
+
+	require.NoError(t, s.Delete(id))
+	require.False(t, s.Exists(id))
+	require.Equal(t, uint64(1), s.Count())
+	require.Equal(t, vlpersistence.ErrNotFound, s.Delete(id))
+
+	// deleted session can be created again
+	createSession(t, s, "a")
+	require.Equal(t, uint64(2), s.Count())
+}
+
+func testSessionsNotFound(t *testing.T, p vlpersistence.IFace) {
+	s := sessions(t, p)
+	id := []byte("unknown")
+
+	loader := func(interface{}, *vlpersistence.PersistedPacket) (bool, error) {
+		return false, nil
+	}
+
+	_, err := s.PacketCountQoS0(id)
+	require.Equal(t, vlpersistence.ErrNotFound, err)
+	_, err = s.PacketCountQoS12(id)
+	require.Equal(t, vlpersistence.ErrNotFound, err)
+	_, err = s.PacketCountUnAck(id)
+	require.Equal(t, vlpersistence.ErrNotFound, err)
+
+	require.Equal(t, vlpersistence.ErrNotFound, s.PacketStoreQoS0(id, newPacket(0)))
+	require.Equal(t, vlpersistence.ErrNotFound, s.PacketStoreQoS12(id, newPacket(0)))
+	require.Equal(t, vlpersistence.ErrNotFound, s.PacketsForEachQoS0(id, nil, loader))
+	require.Equal(t, vlpersistence.ErrNotFound, s.PacketsForEachQoS12(id, nil, loader))
+	require.Equal(t, vlpersistence.ErrNotFound, s.PacketsForEachUnAck(id, nil, loader))
+	require.Equal(t, vlpersistence.ErrNotFound, s.PacketsStore(id, vlpersistence.PersistedPackets{}))
+	require.Equal(t, vlpersistence.ErrNotFound, s.PacketsDelete(id))
+	require.Equal(t, vlpersistence.ErrNotFound, s.SubscriptionsStore(id, []byte("subs")))
+	require.Equal(t, vlpersistence.ErrNotFound, s.SubscriptionsDelete(id))
+	require.Equal(t, vlpersistence.ErrNotFound, s.ExpiryStore(id, &vlpersistence.SessionDelays{}))
+	require.Equal(t, vlpersistence.ErrNotFound, s.ExpiryDelete(id))
+	require.Equal(t, vlpersistence.ErrNotFound, s.StateStore(id, &vlpersistence.SessionState{}))
+	require.Equal(t, vlpersistence.ErrNotFound, s.StateDelete(id))
+	require.Equal(t, vlpersistence.ErrNotFound, s.Delete(id))
+}
+
+func testSessionsLoadForEach(t *testing.T, p vlpersistence.IFace) {
+	s := sessions(t, p)
+
+	a := createSession(t, s, "a")
+	b := createSession(t, s, "b")
+	c := createSession(t, s, "c")
+
+	require.NoError(t, s.SubscriptionsStore(a, []byte("subs-a")))
+	require.NoError(t, s.ExpiryStore(a, &vlpersistence.SessionDelays{
+		Since:    "since-a",
+		ExpireIn: "10",
+		Will:     []byte("will-a"),
+	}))
+
+	require.NoError(t, s.StateStore(b, &vlpersistence.SessionState{
+		Subscriptions: []byte("subs-b"),
+		Expire: &vlpersistence.SessionDelays{
+			Since:    "since-b",
+			ExpireIn: "20",
+		},
+		SessionBase: vlpersistence.SessionBase{Timestamp: "ts-b2", Version: 4},
+	}))
+
+	require.NoError(t, s.SubscriptionsStore(c, []byte("subs-c")))
+	require.NoError(t, s.ExpiryStore(c, &vlpersistence.SessionDelays{Since: "since-c"}))
+	require.NoError(t, s.SubscriptionsDelete(c))
+	require.NoError(t, s.ExpiryDelete(c))
+
+	ctx := &struct{}{}
+	loaded := make(map[string]*vlpersistence.SessionState)
+
+	require.NoError(t, s.LoadForEach(sessionLoader(func(lctx interface{}, id []byte, state *vlpersistence.SessionState) error {
+		require.True(t, lctx == ctx, "context must be passed to loader as is")
+		require.NotContains(t, loaded, string(id), "session loaded twice")
+
+		loaded[string(id)] = state
+
+		return nil
+	}), ctx))
+
+	require.Len(t, loaded, 3)
+
+	require.Equal(t, []byte("subs-a"), loaded["a"].Subscriptions)
+	require.NotNil(t, loaded["a"].Expire)
+	require.Equal(t, "since-a", loaded["a"].Expire.Since)
+	require.Equal(t, "10", loaded["a"].Expire.ExpireIn)
+	require.Equal(t, []byte("will-a"), loaded["a"].Expire.Will)
+	require.Equal(t, "ts-a", loaded["a"].Timestamp)
+	require.Equal(t, byte(5), loaded["a"].Version)
+
+	require.Equal(t, []byte("subs-b"), loaded["b"].Subscriptions)
+	require.NotNil(t, loaded["b"].Expire)
+	require.Equal(t, "since-b", loaded["b"].Expire.Since)
+	require.Equal(t, "20", loaded["b"].Expire.ExpireIn)
+	require.Equal(t, "ts-b2", loaded["b"].Timestamp)
+	require.Equal(t, byte(4), loaded["b"].Version)
+
+	require.Empty(t, loaded["c"].Subscriptions)
+	require.Nil(t, loaded["c"].Expire)
+
+	// state removal keeps session
+	require.NoError(t, s.StateDelete(b))
+	require.True(t, s.Exists(b))
+}
+
+func testSessionsLoaderError(t *testing.T, p vlpersistence.IFace) {
+	s := sessions(t, p)
+
+	for i := 0; i < 5; i++ {
+		createSession(t, s, strconv.Itoa(i))
+	}
+
+	calls := 0
+
+	err := s.LoadForEach(sessionLoader(func(interface{}, []byte, *vlpersistence.SessionState) error {
+		calls++
+
+		if calls == 2 {
+			return errLoader
+		}
+
+		return nil
+	}), nil)
+
+	require.Equal(t, errLoader, err)
+	require.Equal(t, 2, calls)
+}
+
+func testPacketsOrder(t *testing.T, p vlpersistence.IFace) {
+	s := sessions(t, p)
+	id := createSession(t, s, "a")
+
+	for _, pkt := range newPackets(0, 3) {
+		require.NoError(t, s.PacketStoreQoS0(id, pkt))
+		require.NoError(t, s.PacketStoreQoS12(id, pkt))
+	}
+
+	require.NoError(t, s.PacketsStore(id, vlpersistence.PersistedPackets{
+		QoS0:  newPackets(3, 5),
+		QoS12: newPackets(3, 6),
+		UnAck: newPackets(0, 4),
+	}))
+
+	count, err := s.PacketCountQoS0(id)
+	require.NoError(t, err)
+	require.Equal(t, uint64(5), count)
+
+	count, err = s.PacketCountQoS12(id)
+	require.NoError(t, err)
+	require.Equal(t, uint64(6), count)
+
+	count, err = s.PacketCountUnAck(id)
+	require.NoError(t, err)
+	require.Equal(t, uint64(4), count)
+
+	require.Equal(t, newPackets(0, 5), collect(t, s.PacketsForEachQoS0, id))
+	require.Equal(t, newPackets(0, 6), collect(t, s.PacketsForEachQoS12, id))
+	require.Equal(t, newPackets(0, 4), collect(t, s.PacketsForEachUnAck, id))
+
+	// packets of other sessions are not affected
+	other := createSession(t, s, "b")
+	require.Empty(t, collect(t, s.PacketsForEachQoS0, other))
+}
+
+func testPacketsDeleteDuringIteration(t *testing.T, p vlpersistence.IFace) {
+	s := sessions(t, p)
+	id := createSession(t, s, "a")
+
+	require.NoError(t, s.PacketsStore(id, vlpersistence.PersistedPackets{
+		QoS0:  newPackets(0, 6),
+		QoS12: newPackets(0, 6),
+		UnAck: newPackets(0, 6),
+	}))
+
+	lists := []struct {
+		forEach func([]byte, interface{}, vlpersistence.PacketLoader) error
+		count   func([]byte) (uint64, error)
+	}{
+		{s.PacketsForEachQoS0, s.PacketCountQoS0},
+		{s.PacketsForEachQoS12, s.PacketCountQoS12},
+		{s.PacketsForEachUnAck, s.PacketCountUnAck},
+	}
+
+	for _, l := range lists {
+		i := 0
+
+		require.NoError(t, l.forEach(id, nil, func(_ interface{}, pkt *vlpersistence.PersistedPacket) (bool, error) {
+			require.Equal(t, newPacket(i), pkt)
+			i++
+
+			// delete even ones
+			return (i-1)%2 == 0, nil
+		}))
+
+		require.Equal(t, 6, i)
+
+		count, err := l.count(id)
+		require.NoError(t, err)
+		require.Equal(t, uint64(3), count)
+
+		require.Equal(t, []*vlpersistence.PersistedPacket{newPacket(1), newPacket(3), newPacket(5)}, collect(t, l.forEach, id))
+	}
+}
+
+func testPacketsLoaderError(t *testing.T, p vlpersistence.IFace) {
+	s := sessions(t, p)
+	id := createSession(t, s, "a")
+
+	require.NoError(t, s.PacketsStore(id, vlpersistence.PersistedPackets{
+		QoS12: newPackets(0, 5),
+	}))
+
+	calls := 0
+
+	err := s.PacketsForEachQoS12(id, nil, func(interface{}, *vlpersistence.PersistedPacket) (bool, error) {
+		calls++
+
+		// packet is deleted even though load is interrupted
+		if calls == 2 {
+			return true, errLoader
+		}
+
+		return false, nil
+	})
+
+	require.Equal(t, errLoader, err)
+	require.Equal(t, 2, calls)
+
+	require.Equal(t, []*vlpersistence.PersistedPacket{newPacket(0), newPacket(2), newPacket(3), newPacket(4)},
+		collect(t, s.PacketsForEachQoS12, id))
+}
+
+func testPacketsDelete(t *testing.T, p vlpersistence.IFace) {
+	s := sessions(t, p)
+	id := createSession(t, s, "a")
+
+	require.NoError(t, s.PacketsStore(id, vlpersistence.PersistedPackets{
+		QoS0:  newPackets(0, 2),
+		QoS12: newPackets(0, 2),
+		UnAck: newPackets(0, 2),
+	}))
+
+	require.NoError(t, s.PacketsDelete(id))
+	require.True(t, s.Exists(id))
+
+	require.Empty(t, collect(t, s.PacketsForEachQoS0, id))
+	require.Empty(t, collect(t, s.PacketsForEachQoS12, id))
+	require.Empty(t, collect(t, s.PacketsForEachUnAck, id))
+
+	// deleting session deletes its packets
+	require.NoError(t, s.PacketStoreQoS0(id, newPacket(0)))
+	require.NoError(t, s.Delete(id))
+	createSession(t, s, "a")
+	require.Empty(t, collect(t, s.PacketsForEachQoS0, id))
+}
+
+func testPacketsExpired(t *testing.T, p vlpersistence.IFace) {
+	s := sessions(t, p)
+	id := createSession(t, s, "a")
+
+	packets := []*vlpersistence.PersistedPacket{newPacket(0), newExpiredPacket(1), newPacket(2), newExpiredPacket(3)}
+
+	require.NoError(t, s.PacketsStore(id, vlpersistence.PersistedPackets{
+		QoS0:  packets,
+		QoS12: packets,
+		UnAck: packets,
+	}))
+
+	live := []*vlpersistence.PersistedPacket{newPacket(0), newPacket(2)}
+
+	for _, l := range []struct {
+		forEach func([]byte, interface{}, vlpersistence.PacketLoader) error
+		count   func([]byte) (uint64, error)
+	}{
+		{s.PacketsForEachQoS0, s.PacketCountQoS0},
+		{s.PacketsForEachQoS12, s.PacketCountQoS12},
+	} {
+		require.Equal(t, live, collect(t, l.forEach, id))
+
+		// expired packets are deleted
+		count, err := l.count(id)
+		require.NoError(t, err)
+		require.Equal(t, uint64(2), count)
+	}
+
+	require.Equal(t, packets, collect(t, s.PacketsForEachUnAck, id))
+}
+
+func testBatch(t *testing.T, p vlpersistence.IFace) {
+	s := sessions(t, p)
+	id := []byte("a")
+
+	// error from fn leaves storage untouched regardless of backend
+	require.Equal(t, errLoader, vlpersistence.Batch(s, id, func(tx vlpersistence.SessionTx) error {
+		require.NoError(t, tx.Create(&vlpersistence.SessionBase{Version: 5}))
+		return errLoader
+	}))
+	require.False(t, s.Exists(id))
+
+	require.NoError(t, vlpersistence.Batch(s, id, func(tx vlpersistence.SessionTx) error {
+		require.NoError(t, tx.Create(&vlpersistence.SessionBase{Timestamp: "ts", Version: 5}))
+		require.NoError(t, tx.SubscriptionsStore([]byte("subs")))
+		require.NoError(t, tx.ExpiryStore(&vlpersistence.SessionDelays{Since: "since"}))
+		require.NoError(t, tx.PacketsStore(vlpersistence.PersistedPackets{QoS12: newPackets(0, 2)}))
+
+		return nil
+	}))
+
+	require.True(t, s.Exists(id))
+	require.Equal(t, newPackets(0, 2), collect(t, s.PacketsForEachQoS12, id))
+
+	require.NoError(t, s.LoadForEach(sessionLoader(func(_ interface{}, _ []byte, state *vlpersistence.SessionState) error {
+		require.Equal(t, []byte("subs"), state.Subscriptions)
+		require.NotNil(t, state.Expire)
+		require.Equal(t, "since", state.Expire.Since)
+		require.Equal(t, "ts", state.Timestamp)
+
+		return nil
+	}), nil))
+
+	// session deleted and created again within one batch
+	require.NoError(t, vlpersistence.Batch(s, id, func(tx vlpersistence.SessionTx) error {
+		require.NoError(t, tx.Delete())
+		require.NoError(t, tx.Create(&vlpersistence.SessionBase{Version: 4}))
+
+		return nil
+	}))
+
+	require.True(t, s.Exists(id))
+	require.Empty(t, collect(t, s.PacketsForEachQoS12, id))
+
+	if _, ok := s.(vlpersistence.SessionsBatcher); !ok {
+		return
+	}
+
+	// failed mutation discards ones before it
+	err := vlpersistence.Batch(s, id, func(tx vlpersistence.SessionTx) error {
+		require.NoError(t, tx.PacketsStore(vlpersistence.PersistedPackets{QoS0: newPackets(0, 1)}))
+		require.NoError(t, tx.Create(&vlpersistence.SessionBase{}))
+
+		return nil
+	})
+	require.Equal(t, vlpersistence.ErrAlreadyExists, err)
+	require.Empty(t, collect(t, s.PacketsForEachQoS0, id))
+
+	err = vlpersistence.Batch(s, []byte("b"), func(tx vlpersistence.SessionTx) error {
+		require.NoError(t, tx.Create(&vlpersistence.SessionBase{}))
+		require.NoError(t, tx.Delete())
+
+		return tx.Delete()
+	})
+	require.Equal(t, vlpersistence.ErrNotFound, err)
+	require.False(t, s.Exists([]byte("b")))
+}
+
+// recordingSessions hides SessionsBatcher of backend, thus Batch falls back to recording mutations
+type recordingSessions struct {
+	vlpersistence.Sessions
+}
+
+func testBatchDataIsCopied(t *testing.T, p vlpersistence.IFace) {
+	backend := sessions(t, p)
+
+	for _, s := range []vlpersistence.Sessions{backend, recordingSessions{Sessions: backend}} {
+		id := []byte(fmt.Sprintf("%T", s))
+
+		require.NoError(t, vlpersistence.Batch(s, id, func(tx vlpersistence.SessionTx) error {
+			subs := []byte("subs")
+			delays := &vlpersistence.SessionDelays{Since: "since", Will: []byte("will")}
+			state := &vlpersistence.SessionState{Subscriptions: []byte("state"), SessionBase: vlpersistence.SessionBase{Timestamp: "ts"}}
+			pkt := newPacket(0)
+
+			require.NoError(t, tx.Create(&vlpersistence.SessionBase{Timestamp: "ts", Version: 5}))
+			require.NoError(t, tx.StateStore(state))
+			require.NoError(t, tx.SubscriptionsStore(subs))
+			require.NoError(t, tx.ExpiryStore(delays))
+			require.NoError(t, tx.PacketsStore(vlpersistence.PersistedPackets{UnAck: []*vlpersistence.PersistedPacket{pkt}}))
+
+			// caller is free to modify arguments before batch is applied
+			subs[0] = 'X'
+			delays.Since = "X"
+			delays.Will[0] = 'X'
+			state.Subscriptions[0] = 'X'
+			state.Timestamp = "X"
+			pkt.Data[0] = 'X'
+
+			return nil
+		}), "%T", s)
+
+		require.Equal(t, []*vlpersistence.PersistedPacket{newPacket(0)}, collect(t, s.PacketsForEachUnAck, id), "%T", s)
+	}
+
+	loaded := 0
+
+	require.NoError(t, backend.LoadForEach(sessionLoader(func(_ interface{}, _ []byte, state *vlpersistence.SessionState) error {
+		loaded++
+
+		require.Equal(t, []byte("subs"), state.Subscriptions)
+		require.Equal(t, "ts", state.Timestamp)
+		require.NotNil(t, state.Expire)
+		require.Equal(t, "since", state.Expire.Since)
+		require.Equal(t, []byte("will"), state.Expire.Will)
+
+		return nil
+	}), nil))
+
+	require.Equal(t, 2, loaded)
+}
+
+func testDataIsCopied(t *testing.T, p vlpersistence.IFace) {
+	s := sessions(t, p)
+	id := createSession(t, s, "a")
+
+	pkt := newPacket(0)
+	subs := []byte("subs")
+
+	require.NoError(t, s.PacketStoreQoS0(id, pkt))
+	require.NoError(t, s.SubscriptionsStore(id, subs))
+
+	pkt.Data[0] = 'X'
+	subs[0] = 'X'
+
+	require.Equal(t, []*vlpersistence.PersistedPacket{newPacket(0)}, collect(t, s.PacketsForEachQoS0, id))
+
+	require.NoError(t, s.LoadForEach(sessionLoader(func(_ interface{}, _ []byte, state *vlpersistence.SessionState) error {
+		require.Equal(t, []byte("subs"), state.Subscriptions)
+		return nil
+	}), nil))
+
+	r, err := p.Retained()
+	require.NoError(t, err)
+
+	retained := newPackets(0, 1)
+	require.NoError(t, r.Store(retained))
+	retained[0].Data[0] = 'X'
+
+	loaded, err := r.Load()
+	require.NoError(t, err)
+	require.Equal(t, newPackets(0, 1), loaded)
+}
+
+func testRetained(t *testing.T, p vlpersistence.IFace) {
+	r, err := p.Retained()
+	require.NoError(t, err)
+	require.NotNil(t, r)
+
+	loaded, err := r.Load()
+	require.NoError(t, err)
+	require.Empty(t, loaded)
+
+	require.NoError(t, r.Store(newPackets(0, 3)))
+
+	loaded, err = r.Load()
+	require.NoError(t, err)
+	require.ElementsMatch(t, newPackets(0, 3), loaded)
+
+	// store wipes previous values
+	require.NoError(t, r.Store(newPackets(3, 5)))
+
+	loaded, err = r.Load()
+	require.NoError(t, err)
+	require.ElementsMatch(t, newPackets(3, 5), loaded)
+
+	// expired messages are not loaded
+	require.NoError(t, r.Store([]*vlpersistence.PersistedPacket{newExpiredPacket(0), newPacket(1)}))
+
+	loaded, err = r.Load()
+	require.NoError(t, err)
+	require.Equal(t, []*vlpersistence.PersistedPacket{newPacket(1)}, loaded)
+
+	require.NoError(t, r.Wipe())
+
+	loaded, err = r.Load()
+	require.NoError(t, err)
+	require.Empty(t, loaded)
+}
+
+func testRetainedTopics(t *testing.T, p vlpersistence.IFace) {
+	r, err := p.Retained()
+	require.NoError(t, err)
+
+	rt, ok := r.(vlpersistence.RetainedTopics)
+	if !ok {
+		t.Skip("backend does not implement RetainedTopics")
+	}
+
+	lookup := func(filter string) []*vlpersistence.PersistedPacket {
+		res, err := rt.Lookup(filter)
+		require.NoError(t, err)
+
+		return res
+	}
+
+	for i, topic := range []string{"sport", "sport/tennis", "sport/tennis/player1", "$SYS/uptime"} {
+		require.NoError(t, rt.Put(topic, newPacket(i)))
+	}
+
+	require.ElementsMatch(t, newPackets(0, 3), lookup("#"))
+	require.ElementsMatch(t, newPackets(0, 3), lookup("sport/#"))
+	require.ElementsMatch(t, []*vlpersistence.PersistedPacket{newPacket(1)}, lookup("sport/+"))
+	require.ElementsMatch(t, []*vlpersistence.PersistedPacket{newPacket(3)}, lookup("$SYS/+"))
+	require.Empty(t, lookup("+/uptime"))
+
+	_, err = rt.Lookup("sport/#/a")
+	require.Equal(t, vlpersistence.ErrInvalidArgs, err)
+	require.Equal(t, vlpersistence.ErrInvalidArgs, rt.Put("sport/+", newPacket(0)))
+
+	// put replaces, delete removes single topic
+	require.NoError(t, rt.Put("sport", newPacket(5)))
+	require.NoError(t, rt.Delete("sport/tennis"))
+	require.NoError(t, rt.Delete("sport/tennis"))
+	require.ElementsMatch(t, []*vlpersistence.PersistedPacket{newPacket(5), newPacket(2)}, lookup("sport/#"))
+
+	// expired packets are not returned
+	require.NoError(t, rt.Put("expired", newExpiredPacket(0)))
+	require.Empty(t, lookup("expired"))
+
+	loaded, err := r.Load()
+	require.NoError(t, err)
+	require.ElementsMatch(t, []*vlpersistence.PersistedPacket{newPacket(5), newPacket(2), newPacket(3)}, loaded)
+
+	// data is copied
+	pkt := newPacket(6)
+	require.NoError(t, rt.Put("a", pkt))
+	pkt.Data[0] = 'X'
+	require.Equal(t, []*vlpersistence.PersistedPacket{newPacket(6)}, lookup("a"))
+
+	// QoS of retained message is kept
+	pkt = newPacket(7)
+	pkt.QoS = mqttp.QoS2
+	require.NoError(t, rt.Put("a", pkt))
+	require.Equal(t, []*vlpersistence.PersistedPacket{pkt}, lookup("a"))
+
+	// bulk store wipes packets put per topic
+	require.NoError(t, r.Store(newPackets(7, 8)))
+	require.Empty(t, lookup("#"))
+
+	loaded, err = r.Load()
+	require.NoError(t, err)
+	require.Equal(t, newPackets(7, 8), loaded)
+
+	require.NoError(t, rt.Put("a", newPacket(8)))
+	require.NoError(t, r.Wipe())
+	require.Empty(t, lookup("#"))
+}
+
+func testSystem(t *testing.T, p vlpersistence.IFace) {
+	s, err := p.System()
+	require.NoError(t, err)
+	require.NotNil(t, s)
+
+	info, err := s.GetInfo()
+	require.NoError(t, err)
+	require.NotNil(t, info)
+
+	setter, ok := s.(vlpersistence.SystemInfoSetter)
+	if !ok {
+		return
+	}
+
+	info.Version = "7"
+	info.SchemaVersion = 7
+	require.NoError(t, setter.SetInfo(info))
+
+	// returned state is a copy
+	info.Version = "8"
+	info.SchemaVersion = 8
+
+	info, err = s.GetInfo()
+	require.NoError(t, err)
+	require.Equal(t, "7", info.Version)
+	require.Equal(t, uint32(7), info.SchemaVersion)
+}
+
+func testConcurrent(t *testing.T, p vlpersistence.IFace) {
+	s := sessions(t, p)
+	shared := createSession(t, s, "shared")
+
+	const workers = 8
+	const packets = 50
+
+	var wg sync.WaitGroup
+
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+
+		go func(w int) {
+			defer wg.Done()
+
+			id := []byte("worker-" + strconv.Itoa(w))
+			if err := s.Create(id, &vlpersistence.SessionBase{}); err != nil {
+				t.Error(err)
+				return
+			}
+
+			for i := 0; i < packets; i++ {
+				if err := s.PacketStoreQoS12(id, newPacket(i)); err != nil {
+					t.Error(err)
+					return
+				}
+
+				if err := s.PacketStoreQoS0(shared, newPacket(i)); err != nil {
+					t.Error(err)
+					return
+				}
+
+				s.Exists(shared)
+				s.Count()
+			}
+		}(w)
+	}
+
+	wg.Wait()
+
+	require.Equal(t, uint64(workers+1), s.Count())
+
+	count, err := s.PacketCountQoS0(shared)
+	require.NoError(t, err)
+	require.Equal(t, uint64(workers*packets), count)
+
+	for w := 0; w < workers; w++ {
+		id := []byte("worker-" + strconv.Itoa(w))
+		require.Equal(t, newPackets(0, packets), collect(t, s.PacketsForEachQoS12, id))
+	}
+}
+
+func testShutdown(t *testing.T, p vlpersistence.IFace) {
+	s := sessions(t, p)
+	id := createSession(t, s, "a")
+
+	require.NoError(t, p.Shutdown())
+
+	_, err := p.Sessions()
+	require.Equal(t, vlpersistence.ErrNotOpen, err)
+
+	_, err = p.Retained()
+	require.Equal(t, vlpersistence.ErrNotOpen, err)
+
+	_, err = p.System()
+	require.Equal(t, vlpersistence.ErrNotOpen, err)
+
+	// providers obtained before shutdown must not work either
+	require.Error(t, s.PacketStoreQoS0(id, newPacket(0)))
+	require.False(t, s.Exists(id))
+	require.Equal(t, uint64(0), s.Count())
+}
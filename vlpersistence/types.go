@@ -1,5 +1,11 @@
 package vlpersistence
 
+import (
+	"time"
+
+	"github.com/VolantMQ/vlapi/mqttp"
+)
+
 // Errors persistence errors
 type Errors int
 
@@ -20,6 +26,8 @@ const (
 	ErrNotOpen
 	// ErrBrokenEntry persisted entry does not meet requirements
 	ErrBrokenEntry
+	// ErrExpired packet expiration time has elapsed
+	ErrExpired
 )
 
 var errorsDesc = map[Errors]string{
@@ -31,6 +39,7 @@ var errorsDesc = map[Errors]string{
 	ErrNotFound:        "persistence: not found",
 	ErrNotOpen:         "persistence: not open",
 	ErrBrokenEntry:     "persistence: broken entry",
+	ErrExpired:         "persistence: expired",
 }
 
 // Errors description during persistence
@@ -44,10 +53,12 @@ func (e Errors) Error() string {
 
 // PersistedPacket wraps packet to handle misc cases like expiration
 type PersistedPacket struct {
-	// ExpireAt shows either packet has expiration value
-	ExpireAt string
+	// ExpireAt time packet expires at, zero if it does not expire
+	ExpireAt time.Time
 	// Data is encoded byte stream as it goes over network
 	Data []byte
+	// QoS retained message is delivered with, see RetainedTopics, 0 for other packets
+	QoS mqttp.QosType
 }
 
 // PersistedPackets array of persisted packets
@@ -72,6 +83,7 @@ type SessionBase struct {
 
 // SessionState object
 type SessionState struct {
+	// Subscriptions encoded with vlsubscriber.Subscriptions.MarshalBinary
 	Subscriptions []byte
 	Errors        []error
 	Expire        *SessionDelays
@@ -82,9 +94,11 @@ type SessionState struct {
 type SystemState struct {
 	Version   string
 	CreatedAt string
+	// SchemaVersion of the storage recorded by vlpersistence/migrate, 0 for storage never migrated
+	SchemaVersion uint32
 }
 
-// PacketLoader application callback doing packed decode
+// PacketLoader application callback doing packet decode
 // when return true in first return packet will be deleted
 // if error presented load interrupted after current packet
 type PacketLoader func(interface{}, *PersistedPacket) (bool, error)
@@ -95,6 +109,9 @@ type SessionLoader interface {
 }
 
 // Packets interface for connection to handle packets
+// PacketsForEachQoS0 and PacketsForEachQoS12 do not pass expired packets to the loader
+// and delete them, see SkipExpired. Packets of unacknowledged flows are passed regardless
+// of expiration as delivery has been started already
 type Packets interface {
 	PacketCountQoS0(id []byte) (uint64, error)
 	PacketCountQoS12(id []byte) (uint64, error)
@@ -109,6 +126,7 @@ type Packets interface {
 }
 
 // Subscriptions session subscriptions interface
+// data is expected to be encoded with vlsubscriber.Subscriptions.MarshalBinary
 type Subscriptions interface {
 	SubscriptionsStore([]byte, []byte) error
 	SubscriptionsDelete([]byte) error
@@ -131,12 +149,26 @@ type Retained interface {
 	// Store persist retained message
 	// it wipes previously set values
 	Store([]*PersistedPacket) error
-	// Load load retained messages
+	// Load load retained messages, expired ones are not returned
 	Load() ([]*PersistedPacket, error)
 	// Wipe retained storage
 	Wipe() error
 }
 
+// RetainedTopics implemented by Retained providers able to update retained messages one topic
+// at a time, thus broker does not rewrite whole set on each update.
+// Packets put per topic are returned by Load as well and wiped by Store and Wipe.
+// Retained message has no packet ID, thus it is persisted as QoS 0 packet and its QoS is
+// carried in PersistedPacket.QoS which provider must keep
+type RetainedTopics interface {
+	// Put packet retained for the topic replacing one put before
+	Put(topic string, p *PersistedPacket) error
+	// Delete packet retained for the topic, no-op if there is no one
+	Delete(topic string) error
+	// Lookup packets retained for topics matching filter, expired ones are not returned
+	Lookup(filter string) ([]*PersistedPacket, error)
+}
+
 // Sessions interface allows operating with sessions inside backend
 type Sessions interface {
 	Packets
@@ -144,9 +176,10 @@ type Sessions interface {
 	State
 	Expiry
 	Create(id []byte, state *SessionBase) error
+	// Count of sessions in storage, 0 once provider is shut down
 	Count() uint64
 	LoadForEach(loader SessionLoader, ctx interface{}) error
-	// Exists check session if presented in storage
+	// Exists check session if presented in storage, false once provider is shut down
 	Exists(id []byte) bool
 	Delete(id []byte) error
 }
@@ -157,6 +190,12 @@ type System interface {
 	// SetInfo(*SystemState) error
 }
 
+// SystemInfoSetter implemented by System providers able to update system state,
+// e.g. to record storage schema version by vlpersistence/migrate
+type SystemInfoSetter interface {
+	SetInfo(*SystemState) error
+}
+
 // IFace interface implemented by different backends
 type IFace interface {
 	Sessions() (Sessions, error)
@@ -0,0 +1,291 @@
+package vlsubscriber
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"sort"
+
+	"github.com/VolantMQ/vlapi/mqttp"
+)
+
+// SubscriptionsEncodingVersion version of binary and JSON encoding of Subscriptions produced by this package
+const SubscriptionsEncodingVersion byte = 1
+
+// nolint: golint
+var (
+	ErrInvalidEncoding    = errors.New("subscriber: invalid subscriptions encoding")
+	ErrUnsupportedVersion = errors.New("subscriber: unsupported subscriptions encoding version")
+)
+
+// encodingMagic starts versioned binary encoding. Legacy encoding starts with length of
+// the first topic which is never 0 thus two leading zero bytes tell encodings apart
+var encodingMagic = [3]byte{0x00, 0x00, 'S'}
+
+// MarshalBinary encode subscriptions, e.g. for vlpersistence.Subscriptions.SubscriptionsStore
+//
+//	magic    0x00 0x00 'S'
+//	version  byte, SubscriptionsEncodingVersion
+//	count    uvarint
+//
+// followed by count entries ordered by topic
+//
+//	topic    uvarint length, UTF-8 bytes
+//	id       uvarint, SubscriptionParams.ID
+//	ops      byte, SubscriptionParams.Ops as per [MQTT-3.8.3.1]
+//	granted  byte, SubscriptionParams.Granted
+func (s Subscriptions) MarshalBinary() ([]byte, error) {
+	topics := s.topics()
+
+	size := len(encodingMagic) + 1 + binary.MaxVarintLen64
+	for _, topic := range topics {
+		size += binary.MaxVarintLen64 + len(topic) + binary.MaxVarintLen32 + 2
+	}
+
+	buf := make([]byte, size)
+	offset := copy(buf, encodingMagic[:])
+
+	buf[offset] = SubscriptionsEncodingVersion
+	offset++
+
+	offset += binary.PutUvarint(buf[offset:], uint64(len(topics)))
+
+	for _, topic := range topics {
+		params := s[topic]
+
+		offset += binary.PutUvarint(buf[offset:], uint64(len(topic)))
+		offset += copy(buf[offset:], topic)
+		offset += binary.PutUvarint(buf[offset:], uint64(params.ID))
+		buf[offset] = byte(params.Ops)
+		buf[offset+1] = byte(params.Granted)
+		offset += 2
+	}
+
+	return buf[:offset], nil
+}
+
+// UnmarshalBinary decode subscriptions encoded by MarshalBinary or in legacy encoding
+// Legacy encoding is sequence of entries with no header
+//
+//	topic    uint16 big endian length, UTF-8 bytes
+//	ops      byte
+//	id       uvarint
+//
+// Granted QoS is not part of it and set to QoS requested in ops.
+// Empty data decodes into empty subscriptions
+func (s *Subscriptions) UnmarshalBinary(data []byte) error {
+	res := make(Subscriptions)
+
+	var err error
+
+	if len(data) > len(encodingMagic) && string(data[:len(encodingMagic)]) == string(encodingMagic[:]) {
+		err = res.decodeVersioned(data[len(encodingMagic):])
+	} else {
+		err = res.decodeLegacy(data)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	*s = res
+
+	return nil
+}
+
+type jsonSubscription struct {
+	Topic             string               `json:"topic"`
+	ID                uint32               `json:"id,omitempty"`
+	QoS               mqttp.QosType        `json:"qos"`
+	NoLocal           bool                 `json:"noLocal,omitempty"`
+	RetainAsPublished bool                 `json:"retainAsPublished,omitempty"`
+	RetainHandling    mqttp.RetainHandling `json:"retainHandling,omitempty"`
+	Granted           mqttp.QosType        `json:"granted"`
+}
+
+type jsonSubscriptions struct {
+	Version       byte               `json:"version"`
+	Subscriptions []jsonSubscription `json:"subscriptions"`
+}
+
+// MarshalJSON encode subscriptions as
+//
+//	{"version":1,"subscriptions":[{"topic":"a/#","id":1,"qos":1,"noLocal":true,"granted":1}]}
+//
+// Entries are ordered by topic, fields with zero values except qos and granted are omitted
+func (s Subscriptions) MarshalJSON() ([]byte, error) {
+	res := jsonSubscriptions{
+		Version:       SubscriptionsEncodingVersion,
+		Subscriptions: make([]jsonSubscription, 0, len(s)),
+	}
+
+	for _, topic := range s.topics() {
+		params := s[topic]
+
+		res.Subscriptions = append(res.Subscriptions, jsonSubscription{
+			Topic:             topic,
+			ID:                params.ID,
+			QoS:               params.Ops.QoS(),
+			NoLocal:           params.Ops.NL(),
+			RetainAsPublished: params.Ops.RAP(),
+			RetainHandling:    params.Ops.RetainHandling(),
+			Granted:           params.Granted,
+		})
+	}
+
+	return json.Marshal(&res)
+}
+
+// UnmarshalJSON decode subscriptions encoded by MarshalJSON
+func (s *Subscriptions) UnmarshalJSON(data []byte) error {
+	var in jsonSubscriptions
+
+	if err := json.Unmarshal(data, &in); err != nil {
+		return err
+	}
+
+	if in.Version != SubscriptionsEncodingVersion {
+		return ErrUnsupportedVersion
+	}
+
+	res := make(Subscriptions, len(in.Subscriptions))
+
+	for _, sub := range in.Subscriptions {
+		ops := byte(sub.QoS) | byte(sub.RetainHandling)<<4
+		if sub.NoLocal {
+			ops |= 0x04
+		}
+
+		if sub.RetainAsPublished {
+			ops |= 0x08
+		}
+
+		if err := res.add(sub.Topic, SubscriptionParams{
+			ID:      sub.ID,
+			Ops:     mqttp.SubscriptionOptions(ops),
+			Granted: sub.Granted,
+		}); err != nil {
+			return err
+		}
+	}
+
+	*s = res
+
+	return nil
+}
+
+// topics sorted thus encoding is deterministic
+func (s Subscriptions) topics() []string {
+	topics := make([]string, 0, len(s))
+	for topic := range s {
+		topics = append(topics, topic)
+	}
+
+	sort.Strings(topics)
+
+	return topics
+}
+
+// add validated entry, duplicates are not allowed
+// topic must be valid topic filter, shared subscription one included
+func (s Subscriptions) add(topic string, params SubscriptionParams) error {
+	if !params.Ops.QoS().IsValid() || !params.Granted.IsValid() {
+		return ErrInvalidEncoding
+	}
+
+	if _, err := mqttp.NewTopic([]byte(topic)); err != nil {
+		return ErrInvalidEncoding
+	}
+
+	if _, ok := s[topic]; ok {
+		return ErrInvalidEncoding
+	}
+
+	s[topic] = params
+
+	return nil
+}
+
+func (s Subscriptions) decodeVersioned(data []byte) error {
+	if data[0] != SubscriptionsEncodingVersion {
+		return ErrUnsupportedVersion
+	}
+
+	offset := 1
+
+	count, n := binary.Uvarint(data[offset:])
+	if n <= 0 {
+		return ErrInvalidEncoding
+	}
+	offset += n
+
+	for i := uint64(0); i < count; i++ {
+		size, n := binary.Uvarint(data[offset:])
+		if n <= 0 || size > uint64(len(data[offset+n:])) {
+			return ErrInvalidEncoding
+		}
+		offset += n
+
+		topic := string(data[offset : offset+int(size)])
+		offset += int(size)
+
+		id, n := binary.Uvarint(data[offset:])
+		if n <= 0 || id > 0xFFFFFFFF || len(data[offset+n:]) < 2 {
+			return ErrInvalidEncoding
+		}
+		offset += n
+
+		if err := s.add(topic, SubscriptionParams{
+			ID:      uint32(id),
+			Ops:     mqttp.SubscriptionOptions(data[offset]),
+			Granted: mqttp.QosType(data[offset+1]),
+		}); err != nil {
+			return err
+		}
+
+		offset += 2
+	}
+
+	if offset != len(data) {
+		return ErrInvalidEncoding
+	}
+
+	return nil
+}
+
+func (s Subscriptions) decodeLegacy(data []byte) error {
+	for offset := 0; offset < len(data); {
+		if len(data[offset:]) < 2 {
+			return ErrInvalidEncoding
+		}
+
+		size := int(binary.BigEndian.Uint16(data[offset:]))
+		offset += 2
+
+		if len(data[offset:]) < size+1 {
+			return ErrInvalidEncoding
+		}
+
+		topic := string(data[offset : offset+size])
+		offset += size
+
+		ops := mqttp.SubscriptionOptions(data[offset])
+		offset++
+
+		id, n := binary.Uvarint(data[offset:])
+		if n <= 0 || id > 0xFFFFFFFF {
+			return ErrInvalidEncoding
+		}
+		offset += n
+
+		if err := s.add(topic, SubscriptionParams{
+			ID:      uint32(id),
+			Ops:     ops,
+			Granted: ops.QoS(),
+		}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
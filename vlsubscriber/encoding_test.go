@@ -0,0 +1,139 @@
+package vlsubscriber
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/VolantMQ/vlapi/mqttp"
+)
+
+func testSubscriptions() Subscriptions {
+	return Subscriptions{
+		"a/#": {
+			ID:      300,
+			Ops:     mqttp.SubscriptionOptions(0x01 | 0x04 | 0x20),
+			Granted: mqttp.QoS1,
+		},
+		"$share/g/b/+": {
+			Ops:     mqttp.SubscriptionOptions(0x02 | 0x08),
+			Granted: mqttp.QoS0,
+		},
+	}
+}
+
+func TestSubscriptionsBinary(t *testing.T) {
+	subs := testSubscriptions()
+
+	data, err := subs.MarshalBinary()
+	require.NoError(t, err)
+	require.Equal(t, []byte{0x00, 0x00, 'S', SubscriptionsEncodingVersion, 0x02}, data[:5])
+
+	// encoding is deterministic
+	again, err := subs.MarshalBinary()
+	require.NoError(t, err)
+	require.Equal(t, data, again)
+
+	var res Subscriptions
+	require.NoError(t, res.UnmarshalBinary(data))
+	require.Equal(t, subs, res)
+
+	require.NoError(t, res.UnmarshalBinary(nil))
+	require.Empty(t, res)
+
+	empty, err := Subscriptions{}.MarshalBinary()
+	require.NoError(t, err)
+	require.NoError(t, res.UnmarshalBinary(empty))
+	require.Empty(t, res)
+
+	data[3] = 2
+	require.Equal(t, ErrUnsupportedVersion, res.UnmarshalBinary(data))
+
+	require.Equal(t, ErrInvalidEncoding, res.UnmarshalBinary(again[:len(again)-1]))
+}
+
+func TestSubscriptionsLegacy(t *testing.T) {
+	var data []byte
+
+	for _, entry := range []struct {
+		topic string
+		ops   byte
+		id    uint64
+	}{
+		{"a/b", 0x02, 0},
+		{"c/#", 0x01 | 0x04, 1000},
+	} {
+		data = append(data, byte(len(entry.topic)>>8), byte(len(entry.topic)))
+		data = append(data, entry.topic...)
+		data = append(data, entry.ops)
+
+		var id [binary.MaxVarintLen64]byte
+		data = append(data, id[:binary.PutUvarint(id[:], entry.id)]...)
+	}
+
+	var res Subscriptions
+	require.NoError(t, res.UnmarshalBinary(data))
+	require.Equal(t, Subscriptions{
+		"a/b": {Ops: 0x02, Granted: mqttp.QoS2},
+		"c/#": {ID: 1000, Ops: 0x05, Granted: mqttp.QoS1},
+	}, res)
+
+	// migration is decode followed by encode
+	migrated, err := res.MarshalBinary()
+	require.NoError(t, err)
+
+	var decoded Subscriptions
+	require.NoError(t, decoded.UnmarshalBinary(migrated))
+	require.Equal(t, res, decoded)
+
+	require.Equal(t, ErrInvalidEncoding, res.UnmarshalBinary(data[:len(data)-3]))
+}
+
+func TestSubscriptionsJSON(t *testing.T) {
+	subs := testSubscriptions()
+
+	data, err := json.Marshal(subs)
+	require.NoError(t, err)
+	require.JSONEq(t, `{"version":1,"subscriptions":[
+		{"topic":"$share/g/b/+","qos":2,"retainAsPublished":true,"granted":0},
+		{"topic":"a/#","id":300,"qos":1,"noLocal":true,"retainHandling":2,"granted":1}
+	]}`, string(data))
+
+	var res Subscriptions
+	require.NoError(t, json.Unmarshal(data, &res))
+	require.Equal(t, subs, res)
+
+	require.Equal(t, ErrUnsupportedVersion, json.Unmarshal([]byte(`{"version":2,"subscriptions":[]}`), &res))
+	require.Equal(t, ErrInvalidEncoding, json.Unmarshal([]byte(`{"version":1,"subscriptions":[{"topic":"","qos":1,"granted":1}]}`), &res))
+}
+
+func TestSubscriptionsInvalidTopic(t *testing.T) {
+	for _, topic := range []string{"", "a/#/b", "a+", "$share/g", "\xff\xfe", "a/\u0000"} {
+		data, err := Subscriptions{topic: {Granted: mqttp.QoS0}}.MarshalBinary()
+		require.NoError(t, err)
+
+		var res Subscriptions
+		require.Equal(t, ErrInvalidEncoding, res.UnmarshalBinary(data), "%q", topic)
+
+		// JSON replaces invalid UTF-8
+		if !utf8.ValidString(topic) {
+			continue
+		}
+
+		data, err = json.Marshal(jsonSubscriptions{
+			Version:       SubscriptionsEncodingVersion,
+			Subscriptions: []jsonSubscription{{Topic: topic}},
+		})
+		require.NoError(t, err)
+		require.Equal(t, ErrInvalidEncoding, res.UnmarshalJSON(data), "%q", topic)
+	}
+
+	// legacy encoding
+	data := []byte{0x00, 0x03, 'a', '#', 'b', 0x00, 0x00}
+
+	var res Subscriptions
+	require.Equal(t, ErrInvalidEncoding, res.UnmarshalBinary(data))
+}
@@ -0,0 +1,454 @@
+package vlsubscriber
+
+import (
+	"errors"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+
+	"github.com/VolantMQ/vlapi/mqttp"
+)
+
+// nolint: golint
+var (
+	ErrNoMembers     = errors.New("subscriber: shared group has no online members")
+	ErrNotMember     = errors.New("subscriber: not a member of shared group")
+	ErrAlreadyMember = errors.New("subscriber: already a member of shared group")
+)
+
+// Member of the shared group as seen by Strategy
+type Member struct {
+	Subscriber IFace
+	Params     SubscriptionParams
+	// InFlight number of QoS 1 and QoS 2 messages dispatched to member and not acknowledged yet
+	InFlight int
+}
+
+// Strategy selects member of the shared group message is dispatched to
+// Pick is called with online members only, in order they joined the group, members is never empty.
+// It returns index of selected member
+type Strategy interface {
+	Pick(members []Member, p *mqttp.Publish) int
+}
+
+// Redelivery policy of messages not acknowledged by shared group member
+type Redelivery int
+
+const (
+	// RedeliverOnOffline QoS 1 and QoS 2 messages not acknowledged by member going offline or
+	// leaving the group are dispatched to other members. Member's session must not retransmit
+	// them on reconnect, otherwise message might be delivered twice
+	RedeliverOnOffline Redelivery = iota
+	// RedeliverOnLeave messages stay with member gone offline as its session delivers them once
+	// it reconnects [MQTT-4.8.2-4]. Once member leaves the group QoS 1 messages are dispatched
+	// to other members and QoS 2 ones are dropped [MQTT-4.8.2-5]
+	RedeliverOnLeave
+)
+
+// SharedGroup dispatches each message published to shared subscription $share/<name>/<filter>
+// to only one of the group members as per [MQTT-4.8.2].
+// Each member receives its own clone of the message. QoS 1 and QoS 2 messages are tracked until
+// member acknowledges them, ones member has not acknowledged are redelivered to other members
+// according to Redelivery policy, RedeliverOnOffline by default
+type SharedGroup struct {
+	lock     sync.Mutex
+	topic    string
+	strategy Strategy
+	policy   Redelivery
+	members  []*sharedMember
+	pending  []*mqttp.Publish
+}
+
+type sharedMember struct {
+	sub    IFace
+	params SubscriptionParams
+	pub    Publisher
+	online bool
+	unAck  []*sharedMessage
+}
+
+// sharedMessage dispatched to member and not acknowledged yet
+type sharedMessage struct {
+	// msg as published to the group
+	msg *mqttp.Publish
+	// sent clone of msg passed to member Publisher
+	sent *mqttp.Publish
+	// qos message is delivered to member with
+	qos mqttp.QosType
+}
+
+// NewSharedGroup allocate group of shared subscription topic, e.g. $share/workers/jobs/#
+// Strategy defaults to round-robin if nil
+func NewSharedGroup(topic string, s Strategy) *SharedGroup {
+	if s == nil {
+		s = NewRoundRobin()
+	}
+
+	return &SharedGroup{
+		topic:    topic,
+		strategy: s,
+	}
+}
+
+// Topic of shared subscription, it is passed to members Publisher along with message
+func (g *SharedGroup) Topic() string {
+	return g.topic
+}
+
+// SetRedelivery set policy of messages not acknowledged by members
+func (g *SharedGroup) SetRedelivery(p Redelivery) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	g.policy = p
+}
+
+// Redelivery policy of messages not acknowledged by members
+func (g *SharedGroup) Redelivery() Redelivery {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	return g.policy
+}
+
+// Len number of members, online and offline
+func (g *SharedGroup) Len() int {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	return len(g.members)
+}
+
+// Join add online member to the group, messages are delivered through pub
+// Messages awaiting online member are dispatched right away.
+// pub is called with group locked thus must not call back into the group
+func (g *SharedGroup) Join(sub IFace, params SubscriptionParams, pub Publisher) error {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	if g.find(sub) >= 0 {
+		return ErrAlreadyMember
+	}
+
+	g.members = append(g.members, &sharedMember{
+		sub:    sub,
+		params: params,
+		pub:    pub,
+		online: true,
+	})
+
+	g.flushPending()
+
+	return nil
+}
+
+// Leave remove member from the group once its session ends, e.g. on unsubscribe or session expiry
+// Messages it has not acknowledged are dispatched to other members, except QoS 2 ones
+// with RedeliverOnLeave policy which are dropped [MQTT-4.8.2-5]
+func (g *SharedGroup) Leave(sub IFace) error {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	idx := g.find(sub)
+	if idx < 0 {
+		return ErrNotMember
+	}
+
+	m := g.members[idx]
+	g.members = append(g.members[:idx], g.members[idx+1:]...)
+
+	g.redistribute(m)
+
+	return nil
+}
+
+// Online mark member online, messages are delivered through pub from now on
+// With RedeliverOnLeave policy messages it has not acknowledged are expected to be
+// retransmitted by its session
+func (g *SharedGroup) Online(sub IFace, pub Publisher) error {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	idx := g.find(sub)
+	if idx < 0 {
+		return ErrNotMember
+	}
+
+	g.members[idx].online = true
+	g.members[idx].pub = pub
+
+	g.flushPending()
+
+	return nil
+}
+
+// Offline mark member offline, no new messages are dispatched to it
+// With RedeliverOnOffline policy messages it has not acknowledged are dispatched to other members,
+// otherwise they stay with the member as its session completes their delivery on reconnect [MQTT-4.8.2-4]
+func (g *SharedGroup) Offline(sub IFace) error {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	idx := g.find(sub)
+	if idx < 0 {
+		return ErrNotMember
+	}
+
+	m := g.members[idx]
+	m.online = false
+
+	if g.policy == RedeliverOnOffline {
+		g.redistribute(m)
+	}
+
+	return nil
+}
+
+// Publish dispatch clone of the message to one of online members selected by the strategy
+// Returns ErrNoMembers if there is no member online, message is not kept then
+func (g *SharedGroup) Publish(p *mqttp.Publish) (IFace, error) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	m, err := g.dispatch(p)
+	if err != nil {
+		return nil, err
+	}
+
+	if m == nil {
+		return nil, ErrNoMembers
+	}
+
+	return m.sub, nil
+}
+
+// Acknowledge release message dispatched to member once its QoS 1 or QoS 2 flow is completed
+// p is the clone passed to member Publisher. Returns false if message is not awaited from member
+func (g *SharedGroup) Acknowledge(sub IFace, p *mqttp.Publish) bool {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	idx := g.find(sub)
+	if idx < 0 {
+		return false
+	}
+
+	m := g.members[idx]
+
+	for i, msg := range m.unAck {
+		if msg.sent == p {
+			m.unAck = append(m.unAck[:i], m.unAck[i+1:]...)
+			return true
+		}
+	}
+
+	return false
+}
+
+// InFlight number of messages not acknowledged by member
+func (g *SharedGroup) InFlight(sub IFace) int {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	if idx := g.find(sub); idx >= 0 {
+		return len(g.members[idx].unAck)
+	}
+
+	return 0
+}
+
+// Pending number of messages awaiting online member
+func (g *SharedGroup) Pending() int {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	return len(g.pending)
+}
+
+// find index of member, must be called with lock held
+func (g *SharedGroup) find(sub IFace) int {
+	for i, m := range g.members {
+		if m.sub == sub {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// dispatch clone of message to member picked by strategy, must be called with lock held
+// returns nil member if there is no member online
+func (g *SharedGroup) dispatch(p *mqttp.Publish) (*sharedMember, error) {
+	online := make([]*sharedMember, 0, len(g.members))
+	candidates := make([]Member, 0, len(g.members))
+
+	for _, m := range g.members {
+		if m.online {
+			online = append(online, m)
+			candidates = append(candidates, Member{
+				Subscriber: m.sub,
+				Params:     m.params,
+				InFlight:   len(m.unAck),
+			})
+		}
+	}
+
+	if len(online) == 0 {
+		return nil, nil
+	}
+
+	idx := g.strategy.Pick(candidates, p)
+	if idx < 0 || idx >= len(online) {
+		idx = 0
+	}
+
+	m := online[idx]
+
+	// member's Publisher may alter packet, e.g. set packet ID or downgrade QoS,
+	// thus it gets own copy and message stays intact for redistribution
+	sent, err := p.Clone(p.Version())
+	if err != nil {
+		return nil, err
+	}
+
+	// QoS is downgraded to the granted one on delivery, thus QoS 0 subscription does not acknowledge
+	qos := p.QoS()
+	if m.params.Granted < qos {
+		qos = m.params.Granted
+	}
+
+	if qos != mqttp.QoS0 {
+		m.unAck = append(m.unAck, &sharedMessage{
+			msg:  p,
+			sent: sent,
+			qos:  qos,
+		})
+	}
+
+	m.pub(g.topic, sent)
+
+	return m, nil
+}
+
+// redistribute messages not acknowledged by member, must be called with lock held
+// If there is no member online they are kept until one comes online.
+// Messages which can't be cloned can't be delivered to anyone thus are dropped
+func (g *SharedGroup) redistribute(from *sharedMember) {
+	unAck := from.unAck
+	from.unAck = nil
+
+	for _, msg := range unAck {
+		// [MQTT-4.8.2-5]
+		if g.policy == RedeliverOnLeave && msg.qos == mqttp.QoS2 {
+			continue
+		}
+
+		if m, err := g.dispatch(msg.msg); err == nil && m == nil {
+			g.pending = append(g.pending, msg.msg)
+		}
+	}
+}
+
+// flushPending dispatch messages awaiting online member, must be called with lock held
+func (g *SharedGroup) flushPending() {
+	pending := g.pending
+	g.pending = nil
+
+	for i, p := range pending {
+		if m, err := g.dispatch(p); err == nil && m == nil {
+			g.pending = append(g.pending, pending[i:]...)
+			return
+		}
+	}
+}
+
+type roundRobin struct {
+	next uint64
+}
+
+// NewRoundRobin strategy selecting online members in turn
+func NewRoundRobin() Strategy {
+	return &roundRobin{}
+}
+
+func (s *roundRobin) Pick(members []Member, _ *mqttp.Publish) int {
+	return int((atomic.AddUint64(&s.next, 1) - 1) % uint64(len(members)))
+}
+
+type random struct {
+	lock sync.Mutex
+	rnd  *rand.Rand
+}
+
+// NewRandom strategy selecting online member at random
+func NewRandom(seed int64) Strategy {
+	return &random{
+		rnd: rand.New(rand.NewSource(seed)),
+	}
+}
+
+func (s *random) Pick(members []Member, _ *mqttp.Publish) int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.rnd.Intn(len(members))
+}
+
+type sticky struct{}
+
+// NewSticky strategy delivering messages of the same publisher, identified by Publish.PublishID(),
+// to the same member as long as it stays online.
+// Member is selected by rendezvous hashing over IFace.Hash() of members thus member going
+// offline moves only publishers which have been assigned to it
+func NewSticky() Strategy {
+	return sticky{}
+}
+
+func (sticky) Pick(members []Member, p *mqttp.Publish) int {
+	var best uint64
+	idx := 0
+
+	for i, m := range members {
+		if score := mix64(uint64(m.Subscriber.Hash()) ^ mix64(uint64(p.PublishID()))); i == 0 || score > best {
+			best = score
+			idx = i
+		}
+	}
+
+	return idx
+}
+
+// mix64 finalizer of splitmix64
+func mix64(v uint64) uint64 {
+	v ^= v >> 30
+	v *= 0xbf58476d1ce4e5b9
+	v ^= v >> 27
+	v *= 0x94d049bb133111eb
+	v ^= v >> 31
+
+	return v
+}
+
+type leastInFlight struct {
+	rr roundRobin
+}
+
+// NewLeastInFlight strategy selecting member with fewest unacknowledged messages,
+// ties are broken in round-robin fashion
+func NewLeastInFlight() Strategy {
+	return &leastInFlight{}
+}
+
+func (s *leastInFlight) Pick(members []Member, p *mqttp.Publish) int {
+	start := s.rr.Pick(members, p)
+	idx := start
+
+	for i := 1; i < len(members); i++ {
+		j := (start + i) % len(members)
+		if members[j].InFlight < members[idx].InFlight {
+			idx = j
+		}
+	}
+
+	return idx
+}
@@ -0,0 +1,288 @@
+package vlsubscriber
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/VolantMQ/vlapi/mqttp"
+)
+
+type testSubscriber struct {
+	IFace
+	hash     uintptr
+	received []*mqttp.Publish
+}
+
+func (s *testSubscriber) Hash() uintptr {
+	return s.hash
+}
+
+func (s *testSubscriber) publish(_ string, p *mqttp.Publish) {
+	s.received = append(s.received, p)
+}
+
+func newTestPublish(t *testing.T, q mqttp.QosType, publisher uintptr) *mqttp.Publish {
+	p := mqttp.NewPublish(mqttp.ProtocolV50)
+	require.NoError(t, p.Set("jobs/a", []byte("data"), q, false, false))
+	p.SetPublishID(publisher)
+
+	return p
+}
+
+func newTestGroup(t *testing.T, s Strategy, n int) (*SharedGroup, []*testSubscriber) {
+	g := NewSharedGroup("$share/workers/jobs/#", s)
+
+	subs := make([]*testSubscriber, n)
+	for i := range subs {
+		subs[i] = &testSubscriber{hash: uintptr(i + 1)}
+		require.NoError(t, g.Join(subs[i], SubscriptionParams{Granted: mqttp.QoS1}, subs[i].publish))
+	}
+
+	return g, subs
+}
+
+func TestSharedGroupRoundRobin(t *testing.T) {
+	g, subs := newTestGroup(t, nil, 3)
+
+	require.Equal(t, ErrAlreadyMember, g.Join(subs[0], SubscriptionParams{}, subs[0].publish))
+
+	for i := 0; i < 6; i++ {
+		sub, err := g.Publish(newTestPublish(t, mqttp.QoS0, 0))
+		require.NoError(t, err)
+		require.Equal(t, subs[i%3], sub)
+	}
+
+	for _, s := range subs {
+		require.Len(t, s.received, 2)
+	}
+}
+
+func TestSharedGroupRandom(t *testing.T) {
+	g, subs := newTestGroup(t, NewRandom(1), 3)
+
+	for i := 0; i < 300; i++ {
+		_, err := g.Publish(newTestPublish(t, mqttp.QoS0, 0))
+		require.NoError(t, err)
+	}
+
+	for _, s := range subs {
+		require.NotEmpty(t, s.received)
+	}
+}
+
+func TestSharedGroupSticky(t *testing.T) {
+	g, subs := newTestGroup(t, NewSticky(), 4)
+
+	assigned := make(map[uintptr]IFace)
+
+	for publisher := uintptr(1); publisher <= 20; publisher++ {
+		for i := 0; i < 3; i++ {
+			sub, err := g.Publish(newTestPublish(t, mqttp.QoS0, publisher))
+			require.NoError(t, err)
+
+			if prev, ok := assigned[publisher]; ok {
+				require.Equal(t, prev, sub)
+			}
+
+			assigned[publisher] = sub
+		}
+	}
+
+	// only publishers of the member gone offline move
+	require.NoError(t, g.Offline(subs[0]))
+
+	for publisher, prev := range assigned {
+		sub, err := g.Publish(newTestPublish(t, mqttp.QoS0, publisher))
+		require.NoError(t, err)
+		require.NotEqual(t, subs[0], sub)
+
+		if prev != subs[0] {
+			require.Equal(t, prev, sub)
+		}
+	}
+}
+
+func TestSharedGroupLeastInFlight(t *testing.T) {
+	g, subs := newTestGroup(t, NewLeastInFlight(), 2)
+
+	p1 := newTestPublish(t, mqttp.QoS1, 0)
+	first, err := g.Publish(p1)
+	require.NoError(t, err)
+
+	// second message goes to other member as first one is busy
+	second, err := g.Publish(newTestPublish(t, mqttp.QoS1, 0))
+	require.NoError(t, err)
+	require.NotEqual(t, first, second)
+
+	// member acknowledges packet it has received
+	sent := first.(*testSubscriber).received[0]
+	require.False(t, g.Acknowledge(first, p1))
+	require.True(t, g.Acknowledge(first, sent))
+	require.False(t, g.Acknowledge(first, sent))
+
+	// the only idle member
+	sub, err := g.Publish(newTestPublish(t, mqttp.QoS1, 0))
+	require.NoError(t, err)
+	require.Equal(t, first, sub)
+	require.Equal(t, 1, g.InFlight(subs[0]))
+	require.Equal(t, 1, g.InFlight(subs[1]))
+}
+
+// payloads of messages received by subscriber
+func received(s *testSubscriber) []string {
+	var res []string
+
+	for _, p := range s.received {
+		res = append(res, string(p.Payload()))
+	}
+
+	return res
+}
+
+func newTestPayload(t *testing.T, q mqttp.QosType, payload string) *mqttp.Publish {
+	p := mqttp.NewPublish(mqttp.ProtocolV50)
+	require.NoError(t, p.Set("jobs/a", []byte(payload), q, false, false))
+
+	return p
+}
+
+func TestSharedGroupClone(t *testing.T) {
+	g, subs := newTestGroup(t, nil, 1)
+
+	p := newTestPayload(t, mqttp.QoS2, "p")
+
+	_, err := g.Publish(p)
+	require.NoError(t, err)
+	require.Len(t, subs[0].received, 1)
+
+	// member got own copy which it is free to alter
+	sent := subs[0].received[0]
+	require.True(t, sent != p)
+	require.Equal(t, p.Payload(), sent.Payload())
+	require.Equal(t, p.Topic(), sent.Topic())
+
+	sent.SetPacketID(10)
+	require.NoError(t, sent.SetQoS(mqttp.QoS1))
+
+	_, err = p.ID()
+	require.Equal(t, mqttp.ErrNotSet, err)
+	require.Equal(t, mqttp.QoS2, p.QoS())
+}
+
+func TestSharedGroupOffline(t *testing.T) {
+	g, subs := newTestGroup(t, nil, 2)
+	require.Equal(t, RedeliverOnOffline, g.Redelivery())
+
+	// round-robin delivers p1 and p2 to subs[0]
+	for _, p := range []*mqttp.Publish{
+		newTestPayload(t, mqttp.QoS1, "p1"),
+		newTestPayload(t, mqttp.QoS1, "x1"),
+		newTestPayload(t, mqttp.QoS2, "p2"),
+	} {
+		_, err := g.Publish(p)
+		require.NoError(t, err)
+	}
+
+	require.Equal(t, []string{"p1", "p2"}, received(subs[0]))
+	require.Equal(t, 2, g.InFlight(subs[0]))
+
+	// QoS 1 and QoS 2 messages are redelivered to member online
+	require.NoError(t, g.Offline(subs[0]))
+	require.Equal(t, 0, g.InFlight(subs[0]))
+	require.Equal(t, []string{"x1", "p1", "p2"}, received(subs[1]))
+	require.Equal(t, 3, g.InFlight(subs[1]))
+	require.False(t, g.Acknowledge(subs[0], subs[0].received[0]))
+	require.True(t, g.Acknowledge(subs[1], subs[1].received[1]))
+
+	// nobody online, messages wait for member
+	require.NoError(t, g.Offline(subs[1]))
+	require.Equal(t, 2, g.Pending())
+
+	require.NoError(t, g.Online(subs[0], subs[0].publish))
+	require.Equal(t, 0, g.Pending())
+	require.Equal(t, []string{"p1", "p2", "x1", "p2"}, received(subs[0]))
+	require.Equal(t, 2, g.InFlight(subs[0]))
+}
+
+func TestSharedGroupOfflineKeep(t *testing.T) {
+	g, subs := newTestGroup(t, nil, 2)
+	g.SetRedelivery(RedeliverOnLeave)
+
+	_, err := g.Publish(newTestPayload(t, mqttp.QoS1, "p1"))
+	require.NoError(t, err)
+	require.Equal(t, 1, g.InFlight(subs[0]))
+
+	// messages stay with member gone offline, its session redelivers them on reconnect
+	require.NoError(t, g.Offline(subs[0]))
+	require.Empty(t, subs[1].received)
+	require.Equal(t, 1, g.InFlight(subs[0]))
+	require.Equal(t, 0, g.Pending())
+
+	// offline member does not get new messages
+	_, err = g.Publish(newTestPayload(t, mqttp.QoS1, "p2"))
+	require.NoError(t, err)
+	require.Equal(t, []string{"p2"}, received(subs[1]))
+
+	require.NoError(t, g.Online(subs[0], subs[0].publish))
+	require.Equal(t, []string{"p1"}, received(subs[0]))
+	require.True(t, g.Acknowledge(subs[0], subs[0].received[0]))
+	require.Equal(t, 0, g.InFlight(subs[0]))
+}
+
+func TestSharedGroupRedistribute(t *testing.T) {
+	g := NewSharedGroup("$share/workers/jobs/#", nil)
+	g.SetRedelivery(RedeliverOnLeave)
+
+	subs := []*testSubscriber{{hash: 1}, {hash: 2}, {hash: 3}}
+	for _, s := range subs {
+		require.NoError(t, g.Join(s, SubscriptionParams{Granted: mqttp.QoS2}, s.publish))
+	}
+
+	// round-robin delivers p0, p1 and p2 to subs[0]
+	for _, p := range []*mqttp.Publish{
+		newTestPayload(t, mqttp.QoS0, "p0"),
+		newTestPayload(t, mqttp.QoS1, "x1"),
+		newTestPayload(t, mqttp.QoS1, "x2"),
+		newTestPayload(t, mqttp.QoS1, "p1"),
+		newTestPayload(t, mqttp.QoS1, "x3"),
+		newTestPayload(t, mqttp.QoS1, "x4"),
+		newTestPayload(t, mqttp.QoS2, "p2"),
+	} {
+		_, err := g.Publish(p)
+		require.NoError(t, err)
+	}
+
+	require.Equal(t, []string{"p0", "p1", "p2"}, received(subs[0]))
+	require.Equal(t, 2, g.InFlight(subs[0]))
+
+	// nobody else online, QoS 1 message waits for member
+	// QoS 0 is not redelivered and QoS 2 must not be sent to other client
+	require.NoError(t, g.Offline(subs[1]))
+	require.NoError(t, g.Offline(subs[2]))
+	require.NoError(t, g.Leave(subs[0]))
+	require.Equal(t, 1, g.Pending())
+
+	_, err := g.Publish(newTestPayload(t, mqttp.QoS1, "x5"))
+	require.Equal(t, ErrNoMembers, err)
+
+	require.NoError(t, g.Online(subs[1], subs[1].publish))
+	require.Equal(t, 0, g.Pending())
+	require.Equal(t, []string{"x1", "x3", "p1"}, received(subs[1]))
+	require.Equal(t, 3, g.InFlight(subs[1]))
+
+	// QoS 2 delivered with QoS 1 to member granted QoS 1 is redistributed
+	sub := &testSubscriber{hash: 4}
+	require.NoError(t, g.Join(sub, SubscriptionParams{Granted: mqttp.QoS1}, sub.publish))
+	require.NoError(t, g.Offline(subs[1]))
+
+	_, err = g.Publish(newTestPayload(t, mqttp.QoS2, "p3"))
+	require.NoError(t, err)
+	require.NoError(t, g.Online(subs[1], subs[1].publish))
+	require.NoError(t, g.Leave(sub))
+	require.Equal(t, []string{"x1", "x3", "p1", "p3"}, received(subs[1]))
+
+	require.Equal(t, ErrNotMember, g.Leave(sub))
+	require.Equal(t, ErrNotMember, g.Offline(sub))
+	require.Equal(t, 2, g.Len())
+}